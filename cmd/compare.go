@@ -0,0 +1,75 @@
+/*
+Copyright © 2021 Sentry
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/getsentry/go-load-tester/web_server"
+)
+
+var compareParams struct {
+	masterUrl             string
+	maxLatencyIncrease    float64
+	latencyPercentiles    []string
+	maxThroughputDecrease float64
+	maxErrorRateIncrease  float64
+}
+
+// compareCmd compares two run reports
+var compareCmd = &cobra.Command{
+	Use:   "compare BASE CURRENT",
+	Short: "Compare the reports of two runs",
+	Long: `Compares the report of a run (CURRENT) against the report of a base run (BASE).
+BASE and CURRENT are either files containing saved run reports or, when --master-url is specified,
+the ids of two runs on the master.
+Prints the latency percentiles, throughput and error rate of the two runs side by side and exits with
+a non-zero status if any of the configured regression thresholds is exceeded.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		base, err := getRunReport(args[0])
+		if err != nil {
+			return err
+		}
+		current, err := getRunReport(args[1])
+		if err != nil {
+			return err
+		}
+		comparison := web_server.CompareRunReports(base, current, web_server.RegressionThresholds{
+			MaxLatencyIncrease:    compareParams.maxLatencyIncrease,
+			LatencyPercentiles:    compareParams.latencyPercentiles,
+			MaxThroughputDecrease: compareParams.maxThroughputDecrease,
+			MaxErrorRateIncrease:  compareParams.maxErrorRateIncrease,
+		})
+		if err = comparison.Write(os.Stdout); err != nil {
+			return err
+		}
+		if regressions := comparison.Regressions(); len(regressions) > 0 {
+			return fmt.Errorf("regression thresholds exceeded:\n  %s", strings.Join(regressions, "\n  "))
+		}
+		return nil
+	},
+}
+
+// getRunReport loads a run report from a file or, if a master url was specified, from the master
+func getRunReport(reference string) (web_server.RunReport, error) {
+	if len(compareParams.masterUrl) > 0 {
+		return web_server.FetchRunReport(compareParams.masterUrl, reference)
+	}
+	return web_server.LoadRunReport(reference)
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().StringVarP(&compareParams.masterUrl, "master-url", "m", "", "get the reports of the runs with the specified ids from the master")
+	compareCmd.Flags().Float64Var(&compareParams.maxLatencyIncrease, "max-latency-increase", 0, "maximum latency increase in percent (0 disables the check)")
+	compareCmd.Flags().StringSliceVar(&compareParams.latencyPercentiles, "latency-percentiles", []string{"p95", "p99"}, "latencies checked against max-latency-increase (mean, p50, p90, p95, p99, max)")
+	compareCmd.Flags().Float64Var(&compareParams.maxThroughputDecrease, "max-throughput-decrease", 0, "maximum throughput decrease in percent (0 disables the check)")
+	compareCmd.Flags().Float64Var(&compareParams.maxErrorRateIncrease, "max-error-rate-increase", 0, "maximum error rate increase in percentage points (0 disables the check)")
+}
@@ -187,6 +187,7 @@ func updateReadme() {
 	runUsage := runCmd.UsageString()
 	workerUsage := workerCmd.UsageString()
 	masterUsage := masterCmd.UsageString()
+	compareUsage := compareCmd.UsageString()
 
 	readmeFile, err := os.Create("README.md")
 	if err != nil {
@@ -196,15 +197,17 @@ func updateReadme() {
 	defer func() { _ = readmeFile.Close() }()
 
 	params := struct {
-		RootUsage   string
-		RunUsage    string
-		WorkerUsage string
-		MasterUsage string
+		RootUsage    string
+		RunUsage     string
+		WorkerUsage  string
+		MasterUsage  string
+		CompareUsage string
 	}{
-		RootUsage:   usage,
-		RunUsage:    runUsage,
-		WorkerUsage: workerUsage,
-		MasterUsage: masterUsage,
+		RootUsage:    usage,
+		RunUsage:     runUsage,
+		WorkerUsage:  workerUsage,
+		MasterUsage:  masterUsage,
+		CompareUsage: compareUsage,
 	}
 
 	err = parsedTemplate.Execute(readmeFile, params)
@@ -8,10 +8,12 @@ import (
 )
 
 type runCliParams struct {
-	port       string
-	targetUrl  string
-	statsdAddr string
-	workers    int
+	port           string
+	targetUrl      string
+	statsdAddr     string
+	otlpEndpoint   string
+	annotationsUrl string
+	workers        int
 }
 
 var runConfig runCliParams
@@ -32,4 +34,6 @@ func init() {
 	runCmd.PersistentFlags().IntVarP(&runConfig.workers, "workers", "w", 10, "threads to use to build load")
 	runCmd.PersistentFlags().StringVarP(&runConfig.targetUrl, "target-url", "t", "", "target URL for the attack")
 	runCmd.PersistentFlags().StringVar(&runConfig.statsdAddr, "statsd-server", "", "ip:port for the statsd server")
+	runCmd.PersistentFlags().StringVar(&runConfig.otlpEndpoint, "otlp-endpoint", "", "base url of an OTLP/HTTP collector for metrics and traces (e.g. http://localhost:4318)")
+	runCmd.PersistentFlags().StringVar(&runConfig.annotationsUrl, "annotations-url", "", "url of a webhook that receives start/stop events for each test run")
 }
@@ -14,7 +14,8 @@ import (
 )
 
 var runWorkerParams struct {
-	masterUrl string
+	masterUrl         string
+	requestSampleRate float64
 }
 
 // workerCmd represents the worker command
@@ -36,11 +37,13 @@ var workerCmd = &cobra.Command{
 			log.Info().Msgf("No file found at %s using the default RandomProjectProvider", fileProjectPath)
 		}
 
-		web_server.RunWorkerWebServer(runConfig.port, runConfig.targetUrl, runWorkerParams.masterUrl, runConfig.statsdAddr, runConfig.workers)
+		web_server.RunWorkerWebServer(runConfig.port, runConfig.targetUrl, runWorkerParams.masterUrl, runConfig.statsdAddr,
+			runConfig.workers, runConfig.otlpEndpoint, runWorkerParams.requestSampleRate, runConfig.annotationsUrl)
 	},
 }
 
 func init() {
 	runCmd.AddCommand(workerCmd)
 	workerCmd.Flags().StringVarP(&runWorkerParams.masterUrl, "master-url", "m", "", "Registers worker with the specified master")
+	workerCmd.Flags().Float64Var(&runWorkerParams.requestSampleRate, "otlp-request-sample-rate", 0, "ratio of requests (between 0 and 1) exported as OTLP spans")
 }
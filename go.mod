@@ -4,13 +4,16 @@ go 1.18
 
 require (
 	github.com/DataDog/datadog-go/v5 v5.1.0
+	github.com/andybalholm/brotli v1.0.5
 	github.com/gin-gonic/gin v1.7.7
 	github.com/google/go-cmp v0.5.6
 	github.com/google/uuid v1.1.2
+	github.com/klauspost/compress v1.15.15
 	github.com/rs/zerolog v1.26.1
 	github.com/spf13/cobra v1.3.0
 	github.com/spf13/viper v1.10.1
 	github.com/tsenart/vegeta v12.7.0+incompatible
+	google.golang.org/protobuf v1.27.1
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -52,6 +55,5 @@ require (
 	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/tools v0.1.10 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	google.golang.org/protobuf v1.27.1 // indirect
 	gopkg.in/ini.v1 v1.66.2 // indirect
 )
@@ -0,0 +1,128 @@
+// Live dashboard for the go-load-tester master (see web_server/dashboard.go)
+
+// text escapes a value to be used in the page markup (quotes are escaped so it can be used in attributes too)
+function text(value) {
+    const span = document.createElement("span");
+    span.textContent = value === undefined || value === null ? "" : value;
+    return span.innerHTML.replace(/"/g, "&quot;").replace(/'/g, "&#39;");
+}
+
+function formatRate(rate) {
+    return (rate || 0).toFixed(1) + "/s";
+}
+
+function formatRatio(ratio) {
+    return ((ratio || 0) * 100).toFixed(1) + "%";
+}
+
+function formatPayload(stats) {
+    return (stats.unitRate || 0).toFixed(1) + ` ${stats.unit || "units"}/s`;
+}
+
+function formatByteRate(rate) {
+    const units = ["B", "KB", "MB", "GB"];
+    let idx = 0;
+    rate = rate || 0;
+    while (rate >= 1024 && idx < units.length - 1) {
+        rate /= 1024;
+        idx++;
+    }
+    return rate.toFixed(1) + ` ${units[idx]}/s`;
+}
+
+function describeAttack(attack) {
+    if (!attack) {
+        return "";
+    }
+    return `${attack.testType}: ${attack.numMessages} per ${attack.per} for ${attack.attackDuration}`;
+}
+
+function latencyCells(latencies) {
+    latencies = latencies || {};
+    return ["mean", "p50", "p90", "p95", "p99", "max"]
+        .map(name => `<td>${text(latencies[name])}</td>`).join("");
+}
+
+function renderRun(run) {
+    const element = document.getElementById("run");
+    if (!run) {
+        element.innerHTML = "No run in progress";
+        return;
+    }
+    const attack = run.attack;
+    const labels = Object.entries(attack.labels || {}).map(([k, v]) => `${k}=${v}`).join(", ");
+    element.innerHTML = `<b>${text(attack.name || attack.testType)}</b> ${text(attack.description)}<br>` +
+        `run ${text(run.id)}: ${text(describeAttack(attack))}, started at ${text(run.started)}` +
+        (labels ? `<br>labels: ${text(labels)}` : "");
+}
+
+function renderTotal(snapshot) {
+    const total = snapshot.total;
+    document.getElementById("total").innerHTML = `<tr>` +
+        `<td>${formatRate(snapshot.desiredRate)}</td>` +
+        `<td>${formatRate(total.rate)}</td>` +
+        `<td>${formatRatio(total.success)}</td>` +
+        `<td>${total.requests}</td>` +
+        `<td>${text(formatPayload(total))}</td>` +
+        `<td>${formatByteRate(total.byteRate)}</td>` +
+        latencyCells(total.latencies) +
+        `</tr>`;
+}
+
+function renderWorkers(workers) {
+    document.getElementById("workers").innerHTML = workers.map(worker => {
+        const stats = worker.stats || {};
+        const health = worker.healthy ?
+            `<span class="healthy">healthy</span>` :
+            `<span class="unhealthy" title="${text(worker.error)}">unhealthy</span>`;
+        return `<tr>` +
+            `<td>${text(worker.url)}</td>` +
+            `<td>${health}</td>` +
+            `<td>${text(describeAttack(worker.attack))}</td>` +
+            `<td>${formatRate(stats.rate)}</td>` +
+            `<td>${formatRatio(stats.success)}</td>` +
+            `<td>${stats.requests || 0}</td>` +
+            `<td>${text(formatPayload(stats))}</td>` +
+            `<td>${formatByteRate(stats.byteRate)}</td>` +
+            latencyCells(stats.latencies) +
+            `</tr>`;
+    }).join("");
+}
+
+function setControlStatus(message) {
+    document.getElementById("controlStatus").textContent = message;
+}
+
+async function sendControl(url, body) {
+    try {
+        const response = await fetch(url, {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: body,
+        });
+        setControlStatus(response.ok ? "ok" : `error: ${response.status} ${await response.text()}`);
+    } catch (e) {
+        setControlStatus(`error: ${e}`);
+    }
+}
+
+document.getElementById("start").addEventListener("click", () => {
+    const command = document.getElementById("command").value;
+    try {
+        JSON.parse(command);
+    } catch (e) {
+        setControlStatus(`invalid JSON: ${e}`);
+        return;
+    }
+    sendControl("/command/", command);
+});
+
+document.getElementById("stop").addEventListener("click", () => sendControl("/stop/", ""));
+
+const events = new EventSource("/ui/events");
+events.addEventListener("stats", event => {
+    const snapshot = JSON.parse(event.data);
+    renderRun(snapshot.run);
+    renderTotal(snapshot);
+    renderWorkers(snapshot.workers || []);
+});
@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// AttachmentJob is how an attachment load test is parameterized
+//
+// Attachments are sent in envelopes (to the envelope endpoint) and, for the ratio of the requests
+// specified by minidumpRatio, as minidump multipart uploads (to the minidump endpoint).
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "attachmentsPerEnvelope": 2,
+//  "sizes": [
+//    {"minSize": 1000, "maxSize": 10000, "weight": 8},
+//    {"minSize": 100000, "maxSize": 1000000, "weight": 2}
+//  ],
+//  "contentType": "text/plain",
+//  "attachToError": true,
+//  "error": {"numIssues": 10},
+//  "minidumpRatio": 0.2
+// }
+// ```
+type AttachmentJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// AttachmentsPerEnvelope the number of attachments sent in an envelope (default 1)
+	AttachmentsPerEnvelope int `json:"attachmentsPerEnvelope,omitempty" yaml:"attachmentsPerEnvelope,omitempty"`
+	// Sizes the distribution of the attachment sizes (default between 1KB and 100KB)
+	Sizes []AttachmentSize `json:"sizes,omitempty" yaml:"sizes,omitempty"`
+	// ContentType the content type of the attachments (default application/octet-stream)
+	ContentType string `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	// AttachmentType the attachment type of the attachments sent in envelopes (default event.attachment)
+	AttachmentType string `json:"attachmentType,omitempty" yaml:"attachmentType,omitempty"`
+	// AttachToError sends a generated error event together with the attachments
+	AttachToError bool `json:"attachToError,omitempty" yaml:"attachToError,omitempty"`
+	// Error the parameters used to generate the error events (see ErrorJob, numProjects is ignored)
+	Error ErrorJob `json:"error,omitempty" yaml:"error,omitempty"`
+	// MinidumpRatio the ratio of requests (between 0 and 1) sent as minidump uploads
+	MinidumpRatio float64 `json:"minidumpRatio,omitempty" yaml:"minidumpRatio,omitempty"`
+}
+
+// AttachmentSize is a bucket of the attachment size distribution
+type AttachmentSize struct {
+	// MinSize the minimum size of the attachments in bytes
+	MinSize int `json:"minSize" yaml:"minSize"`
+	// MaxSize the maximum size of the attachments in bytes
+	MaxSize int `json:"maxSize" yaml:"maxSize"`
+	// Weight the relative weight of the bucket, a bucket with weight 0 is not used (if all the weights are 0 the
+	// buckets are equally likely)
+	Weight int64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// minidumpMagic is the signature minidump files start with (Relay rejects minidumps without it)
+const minidumpMagic = "MDMP"
+
+// attachmentLoadTester is used to drive an attachment load test
+type attachmentLoadTester struct {
+	PayloadCounter
+	url             string
+	attachmentJob   AttachmentJob
+	attachmentGen   func() []byte
+	errorGenerator  func() ErrorEvent
+	eventIdProvider func() string
+}
+
+func newAttachmentLoadTester(url string, rawAttachment json.RawMessage) LoadTester {
+	var attachmentParams AttachmentJob
+	err := json.Unmarshal(rawAttachment, &attachmentParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid attachment params received\nraw data\n%s", rawAttachment)
+	}
+	attachmentParams = attachmentJobWithDefaults(attachmentParams)
+	log.Trace().Msgf("Attachment generation for:\n%+v", attachmentParams)
+
+	return &attachmentLoadTester{
+		PayloadCounter:  NewPayloadCounter(PayloadAttachments),
+		url:             url,
+		attachmentJob:   attachmentParams,
+		attachmentGen:   AttachmentGenerator(attachmentParams.Sizes),
+		errorGenerator:  ErrorGenerator(attachmentParams.Error),
+		eventIdProvider: EventIdGenerator(),
+	}
+}
+
+func (alt *attachmentLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = alt.attachmentJob.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		var err error
+		if rand.Float64() < alt.attachmentJob.MinidumpRatio {
+			err = alt.minidumpTarget(tgt, projectId, projectKey)
+		} else {
+			err = alt.envelopeTarget(tgt, projectId, projectKey)
+		}
+		if err != nil {
+			return err
+		}
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+// envelopeTarget sets up a request that sends attachments (and optionally an error event) in an envelope
+func (alt *attachmentLoadTester) envelopeTarget(tgt *vegeta.Target, projectId string, projectKey string) error {
+	job := alt.attachmentJob
+	tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", alt.url, projectId)
+	tgt.Header = make(http.Header)
+	tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+	tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+	items := make([]utils.EnvelopeItem, 0, job.AttachmentsPerEnvelope+1)
+	var eventId string
+	if job.AttachToError {
+		event := alt.errorGenerator()
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		eventId = event.EventId
+		items = append(items, utils.EnvelopeItem{Type: "event", Payload: body})
+	} else {
+		eventId = alt.eventIdProvider()
+	}
+	for idx := 0; idx < job.AttachmentsPerEnvelope; idx++ {
+		items = append(items, utils.EnvelopeItem{
+			Type: "attachment",
+			Headers: map[string]interface{}{
+				"filename":        fmt.Sprintf("attachment%d.bin", idx),
+				"content_type":    job.ContentType,
+				"attachment_type": job.AttachmentType,
+			},
+			Payload: alt.attachmentGen(),
+		})
+	}
+
+	extraEnvelopeHeaders := map[string]string{
+		"public_key": projectKey,
+	}
+	buff, err := utils.EnvelopeFromItems(eventId, time.Now().UTC(), extraEnvelopeHeaders, items...)
+	if err != nil {
+		return err
+	}
+	tgt.Body = buff.Bytes()
+	alt.AddUnits(job.AttachmentsPerEnvelope)
+	return nil
+}
+
+// minidumpTarget sets up a multipart request that uploads a minidump (the way crash reporters do)
+func (alt *attachmentLoadTester) minidumpTarget(tgt *vegeta.Target, projectId string, projectKey string) error {
+	tgt.URL = fmt.Sprintf("%s/api/%s/minidump/?sentry_key=%s", alt.url, projectId, projectKey)
+
+	var buff bytes.Buffer
+	writer := multipart.NewWriter(&buff)
+	if alt.attachmentJob.AttachToError {
+		event := alt.errorGenerator()
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err = writer.WriteField("sentry", string(body)); err != nil {
+			return err
+		}
+	}
+	part, err := writer.CreateFormFile("upload_file_minidump", "upload.dmp")
+	if err != nil {
+		return err
+	}
+	if _, err = part.Write(MinidumpPayload(alt.attachmentGen())); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	tgt.Header = make(http.Header)
+	tgt.Header.Set("Content-Type", writer.FormDataContentType())
+	tgt.Body = buff.Bytes()
+	alt.AddUnits(1)
+	return nil
+}
+
+func (alt *attachmentLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// TargetUnits returns the number of attachments of a request (a minidump upload carries one attachment)
+func (alt *attachmentLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	if strings.HasSuffix(tgt.URL, "/envelope/") {
+		return countEnvelopeItems(tgt.Body, "attachment")
+	}
+	return 1
+}
+
+// attachmentJobWithDefaults fills in the defaults for the parameters that were not specified
+func attachmentJobWithDefaults(job AttachmentJob) AttachmentJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.AttachmentsPerEnvelope <= 0 {
+		job.AttachmentsPerEnvelope = 1
+	}
+	if len(job.Sizes) == 0 {
+		job.Sizes = []AttachmentSize{{MinSize: 1000, MaxSize: 100000}}
+	}
+	if len(job.ContentType) == 0 {
+		job.ContentType = "application/octet-stream"
+	}
+	if len(job.AttachmentType) == 0 {
+		job.AttachmentType = "event.attachment"
+	}
+	return job
+}
+
+// AttachmentGenerator returns a function that generates attachments with sizes following the specified distribution
+//
+// Generating random content for every attachment is expensive, so the attachments are slices (at random
+// offsets) of a random buffer generated once.
+func AttachmentGenerator(sizes []AttachmentSize) func() []byte {
+	if len(sizes) == 0 {
+		sizes = []AttachmentSize{{MinSize: 1000, MaxSize: 100000}}
+	}
+	sizes = append([]AttachmentSize(nil), sizes...)
+	// without weights all the buckets are equally likely
+	weighted := false
+	for _, size := range sizes {
+		if size.Weight > 0 {
+			weighted = true
+		}
+	}
+	// cumulative weights of the buckets
+	cumulativeWeights := make([]int64, len(sizes))
+	var totalWeight int64
+	maxSize := 0
+	for idx, size := range sizes {
+		if size.MaxSize < size.MinSize {
+			sizes[idx].MaxSize = size.MinSize
+		}
+		if sizes[idx].MaxSize > maxSize {
+			maxSize = sizes[idx].MaxSize
+		}
+		weight := size.Weight
+		if !weighted {
+			weight = 1
+		} else if weight < 0 {
+			weight = 0
+		}
+		totalWeight += weight
+		cumulativeWeights[idx] = totalWeight
+	}
+	// twice the maximum size so that attachments can start at different offsets
+	content := make([]byte, 2*maxSize)
+	rand.Read(content)
+
+	return func() []byte {
+		pick := rand.Int63n(totalWeight)
+		bucketIdx := sort.Search(len(cumulativeWeights), func(idx int) bool {
+			return cumulativeWeights[idx] > pick
+		})
+		bucket := sizes[bucketIdx]
+		size := bucket.MinSize + rand.Intn(bucket.MaxSize-bucket.MinSize+1)
+		offset := rand.Intn(len(content) - size + 1)
+		return content[offset : offset+size]
+	}
+}
+
+// MinidumpPayload turns the content into a (fake) minidump by prefixing it with the minidump signature
+func MinidumpPayload(content []byte) []byte {
+	retVal := make([]byte, 0, len(minidumpMagic)+len(content))
+	retVal = append(retVal, minidumpMagic...)
+	return append(retVal, content...)
+}
+
+func init() {
+	RegisterSentryTestType("attachment", newAttachmentLoadTester, nil)
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+func TestAttachmentGeneratorSizes(t *testing.T) {
+	sizes := []AttachmentSize{
+		{MinSize: 10, MaxSize: 20, Weight: 1},
+		{MinSize: 1000, MaxSize: 1000, Weight: 3},
+	}
+	generator := AttachmentGenerator(sizes)
+	var small, large int
+	for idx := 0; idx < 1000; idx++ {
+		size := len(generator())
+		switch {
+		case size >= 10 && size <= 20:
+			small++
+		case size == 1000:
+			large++
+		default:
+			t.Fatalf("attachment size %d outside of the configured distribution", size)
+		}
+	}
+	// expecting ~250 small and ~750 large attachments
+	if small < 150 || large < 650 {
+		t.Errorf("attachment sizes do not follow the weights, small:%d large:%d", small, large)
+	}
+
+	// buckets with weight 0 are disabled
+	sizes[0].Weight = 0
+	generator = AttachmentGenerator(sizes)
+	for idx := 0; idx < 100; idx++ {
+		if size := len(generator()); size != 1000 {
+			t.Fatalf("attachment size %d from a disabled bucket", size)
+		}
+	}
+}
+
+func TestAttachmentEnvelope(t *testing.T) {
+	loadTester := newAttachmentLoadTester("http://relay", json.RawMessage(
+		`{"attachmentsPerEnvelope":2,"sizes":[{"minSize":100,"maxSize":100}],"contentType":"text/plain","attachToError":true}`))
+	targeter, _ := loadTester.GetTargeter()
+	var target vegeta.Target
+	if err := targeter(&target); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(target.URL, "/envelope/") {
+		t.Errorf("unexpected url %s", target.URL)
+	}
+
+	// envelope header, event header, event, 2 x (attachment header, attachment)
+	reader := bytes.NewReader(target.Body)
+	var envelopeHeader map[string]interface{}
+	decoder := json.NewDecoder(reader)
+	if err := decoder.Decode(&envelopeHeader); err != nil {
+		t.Fatal(err)
+	}
+	var itemTypes []string
+	rest := target.Body[decoder.InputOffset()+1:]
+	for len(rest) > 0 {
+		headerEnd := bytes.IndexByte(rest, '\n')
+		var itemHeader struct {
+			Type        string `json:"type"`
+			Length      int    `json:"length"`
+			ContentType string `json:"content_type"`
+		}
+		if err := json.Unmarshal(rest[:headerEnd], &itemHeader); err != nil {
+			t.Fatal(err)
+		}
+		itemTypes = append(itemTypes, itemHeader.Type)
+		if itemHeader.Type == "attachment" && (itemHeader.Length != 100 || itemHeader.ContentType != "text/plain") {
+			t.Errorf("unexpected attachment header %+v", itemHeader)
+		}
+		rest = rest[headerEnd+1+itemHeader.Length+1:]
+	}
+	if strings.Join(itemTypes, ",") != "event,attachment,attachment" {
+		t.Errorf("unexpected envelope items %v", itemTypes)
+	}
+	if unit, units := loadTester.(PayloadReporter).PayloadUnits(); unit != PayloadAttachments || units != 2 {
+		t.Errorf("unexpected payload %d %s", units, unit)
+	}
+}
+
+func TestMinidumpUpload(t *testing.T) {
+	loadTester := newAttachmentLoadTester("http://relay", json.RawMessage(
+		`{"sizes":[{"minSize":100,"maxSize":100}],"attachToError":true,"minidumpRatio":1}`))
+	targeter, _ := loadTester.GetTargeter()
+	var target vegeta.Target
+	if err := targeter(&target); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(target.URL, "/minidump/?sentry_key=") {
+		t.Errorf("unexpected url %s", target.URL)
+	}
+	_, params, err := mime.ParseMediaType(target.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := multipart.NewReader(bytes.NewReader(target.Body), params["boundary"])
+	parts := make(map[string][]byte)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[part.FormName()] = content
+	}
+	minidump := parts["upload_file_minidump"]
+	if len(minidump) != 104 || !bytes.HasPrefix(minidump, []byte(minidumpMagic)) {
+		t.Errorf("invalid minidump of size %d", len(minidump))
+	}
+	var event ErrorEvent
+	if err = json.Unmarshal(parts["sentry"], &event); err != nil || len(event.EventId) == 0 {
+		t.Errorf("invalid event in minidump upload: %v", err)
+	}
+}
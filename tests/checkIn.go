@@ -0,0 +1,340 @@
+package tests
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// CheckInJob is how a cron monitor check-in load test is parameterized
+//
+// Every monitor run sends an `in_progress` check-in and, after a duration between minDuration and
+// maxDuration, an `ok` or `error` check-in with the same check-in id. Missed runs send nothing,
+// timed out runs never send the closing check-in.
+// The monitors are split between the workers so that every monitor is driven by a single worker,
+// numMonitors should be large enough to accommodate (requests per second * maxDuration / 2) open check-ins,
+// when all monitors have an open check-in the oldest check-in is closed before its duration elapsed.
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "numMonitors": 10000,
+//  "minDuration": "1s",
+//  "maxDuration": "2m",
+//  "errorRatio": 0.05,
+//  "missedRatio": 0.01,
+//  "timeoutRatio": 0.01,
+//  "environments": ["production", "staging"]
+// }
+// ```
+type CheckInJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// NumMonitors the number of monitors (default 100)
+	NumMonitors int `json:"numMonitors" yaml:"numMonitors"`
+	// FirstMonitor the index of the first monitor driven by a worker (set when the monitors are split between the workers)
+	FirstMonitor int `json:"firstMonitor,omitempty" yaml:"firstMonitor,omitempty"`
+	// MinDuration the minimum duration of a monitor run
+	MinDuration utils.StringDuration `json:"minDuration,omitempty" yaml:"minDuration,omitempty"`
+	// MaxDuration the maximum duration of a monitor run (default 1m)
+	MaxDuration utils.StringDuration `json:"maxDuration,omitempty" yaml:"maxDuration,omitempty"`
+	// ErrorRatio the ratio of the runs (between 0 and 1) that finish with an error check-in
+	ErrorRatio float64 `json:"errorRatio,omitempty" yaml:"errorRatio,omitempty"`
+	// MissedRatio the ratio of the runs (between 0 and 1) that are missed (no check-in is sent)
+	MissedRatio float64 `json:"missedRatio,omitempty" yaml:"missedRatio,omitempty"`
+	// TimeoutRatio the ratio of the runs (between 0 and 1) that time out (the in_progress check-in is never closed)
+	TimeoutRatio float64 `json:"timeoutRatio,omitempty" yaml:"timeoutRatio,omitempty"`
+	// Environments the environments of the check-ins (default production)
+	Environments []string `json:"environments,omitempty" yaml:"environments,omitempty"`
+}
+
+// CheckIn defines the JSON format of a check_in item
+type CheckIn struct {
+	CheckInId     string         `json:"check_in_id"`
+	MonitorSlug   string         `json:"monitor_slug"`
+	Status        string         `json:"status"` // in_progress, ok, error
+	Duration      float64        `json:"duration,omitempty"`
+	Environment   string         `json:"environment,omitempty"`
+	MonitorConfig *MonitorConfig `json:"monitor_config,omitempty"`
+}
+
+// MonitorConfig is sent with the check-ins so that monitors are created on the fly
+type MonitorConfig struct {
+	Schedule      MonitorSchedule `json:"schedule"`
+	CheckInMargin int             `json:"checkin_margin"` // minutes
+	MaxRuntime    int             `json:"max_runtime"`    // minutes
+}
+
+type MonitorSchedule struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// monitorState is the state of a monitor driven by a worker
+type monitorState struct {
+	slug        string
+	projectId   string
+	projectKey  string
+	environment string
+	// the open check-in (empty if the monitor has no run in progress)
+	checkInId string
+	started   time.Time
+	closeAt   time.Time
+}
+
+// checkInLoadTester is used to drive a check-in load test
+type checkInLoadTester struct {
+	PayloadCounter
+	url        string
+	checkInJob CheckInJob
+	idGen      func() string
+	// lock to be used when manipulating the monitors
+	lock     sync.Mutex
+	monitors []*monitorState
+	// the monitors with a run in progress ordered by the time their run should be closed
+	open openCheckIns
+	// the next monitor to start a run on
+	nextMonitor int
+}
+
+func newCheckInLoadTester(url string, rawCheckIn json.RawMessage) LoadTester {
+	var checkInParams CheckInJob
+	err := json.Unmarshal(rawCheckIn, &checkInParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid checkIn params received\nraw data\n%s", rawCheckIn)
+	}
+	checkInParams = checkInJobWithDefaults(checkInParams)
+	log.Trace().Msgf("CheckIn generation for:\n%+v", checkInParams)
+
+	projectProvider := utils.GetProjectProvider()
+	monitors := make([]*monitorState, 0, checkInParams.NumMonitors)
+	for idx := 0; idx < checkInParams.NumMonitors; idx++ {
+		projectId := projectProvider.GetProjectId(checkInParams.NumProjects)
+		monitors = append(monitors, &monitorState{
+			slug:        fmt.Sprintf("monitor-%d", checkInParams.FirstMonitor+idx),
+			projectId:   projectId,
+			projectKey:  projectProvider.GetProjectInfo(projectId).ProjectKey,
+			environment: utils.SimpleRandomChoice(checkInParams.Environments),
+		})
+	}
+
+	return &checkInLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadCheckIns),
+		url:            url,
+		checkInJob:     checkInParams,
+		idGen:          EventIdGenerator(),
+		monitors:       monitors,
+	}
+}
+
+func (clt *checkInLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		monitor, checkIn := clt.nextCheckIn(time.Now().UTC())
+
+		tgt.Method = "POST"
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", clt.url, monitor.projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(monitor.projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		body, err := json.Marshal(checkIn)
+		if err != nil {
+			return err
+		}
+		buff, err := utils.EnvelopeFromItems("", time.Now().UTC(), map[string]string{"public_key": monitor.projectKey},
+			utils.EnvelopeItem{Type: "check_in", Payload: body})
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		clt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", monitor.projectId)
+		return nil
+	}, 0
+}
+
+func (clt *checkInLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// nextCheckIn returns the next check-in to send and the monitor it belongs to
+//
+// A check-in that is due is closed first, otherwise a new run is started on the next monitor without
+// an open check-in (if there is none the check-in that is closest to its end is closed early).
+func (clt *checkInLoadTester) nextCheckIn(now time.Time) (*monitorState, CheckIn) {
+	clt.lock.Lock()
+	defer clt.lock.Unlock()
+
+	if len(clt.open) > 0 && (!clt.open[0].closeAt.After(now) || len(clt.open) == len(clt.monitors)) {
+		// a run is due or all monitors have a run in progress
+		return clt.closeCheckIn(now)
+	}
+
+	job := clt.checkInJob
+	for range clt.monitors {
+		monitor := clt.monitors[clt.nextMonitor]
+		clt.nextMonitor = (clt.nextMonitor + 1) % len(clt.monitors)
+		if len(monitor.checkInId) > 0 {
+			continue
+		}
+		if rand.Float64() < job.MissedRatio {
+			// missed run, nothing is sent for this monitor
+			continue
+		}
+		checkIn := CheckIn{
+			CheckInId:     clt.idGen(),
+			MonitorSlug:   monitor.slug,
+			Status:        "in_progress",
+			Environment:   monitor.environment,
+			MonitorConfig: clt.monitorConfig(),
+		}
+		if rand.Float64() >= job.TimeoutRatio {
+			// the run will be closed, otherwise it times out and is forgotten
+			durationRange := int64(job.MaxDuration - job.MinDuration)
+			duration := time.Duration(job.MinDuration)
+			if durationRange > 0 {
+				duration += time.Duration(rand.Int63n(durationRange))
+			}
+			monitor.checkInId = checkIn.CheckInId
+			monitor.started = now
+			monitor.closeAt = now.Add(duration)
+			heap.Push(&clt.open, monitor)
+		}
+		return monitor, checkIn
+	}
+	if len(clt.open) > 0 {
+		return clt.closeCheckIn(now)
+	}
+	// all monitors missed their runs (unlikely unless missedRatio is close to 1), send a run without duration
+	monitor := clt.monitors[clt.nextMonitor]
+	return monitor, CheckIn{
+		CheckInId:   clt.idGen(),
+		MonitorSlug: monitor.slug,
+		Status:      "ok",
+		Environment: monitor.environment,
+	}
+}
+
+// closeCheckIn creates the check-in that closes the run that ends first (must be called with the lock held)
+func (clt *checkInLoadTester) closeCheckIn(now time.Time) (*monitorState, CheckIn) {
+	monitor := heap.Pop(&clt.open).(*monitorState)
+	status := "ok"
+	if rand.Float64() < clt.checkInJob.ErrorRatio {
+		status = "error"
+	}
+	checkIn := CheckIn{
+		CheckInId:   monitor.checkInId,
+		MonitorSlug: monitor.slug,
+		Status:      status,
+		Duration:    now.Sub(monitor.started).Seconds(),
+		Environment: monitor.environment,
+	}
+	monitor.checkInId = ""
+	return monitor, checkIn
+}
+
+// openCheckIns is a heap of monitors with a run in progress (the run that ends first on top)
+type openCheckIns []*monitorState
+
+func (o openCheckIns) Len() int           { return len(o) }
+func (o openCheckIns) Less(i, j int) bool { return o[i].closeAt.Before(o[j].closeAt) }
+func (o openCheckIns) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o *openCheckIns) Push(x any)        { *o = append(*o, x.(*monitorState)) }
+func (o *openCheckIns) Pop() any {
+	old := *o
+	last := old[len(old)-1]
+	*o = old[:len(old)-1]
+	return last
+}
+
+// monitorConfig returns the configuration of the monitors (every minute, runs can take up to maxDuration)
+func (clt *checkInLoadTester) monitorConfig() *MonitorConfig {
+	maxRuntime := int(time.Duration(clt.checkInJob.MaxDuration) / time.Minute)
+	if maxRuntime < 1 {
+		maxRuntime = 1
+	}
+	return &MonitorConfig{
+		Schedule:      MonitorSchedule{Type: "crontab", Value: "* * * * *"},
+		CheckInMargin: 1,
+		MaxRuntime:    maxRuntime,
+	}
+}
+
+// checkInJobWithDefaults fills in the defaults for the parameters that were not specified
+func checkInJobWithDefaults(job CheckInJob) CheckInJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.NumMonitors <= 0 {
+		job.NumMonitors = 100
+	}
+	if job.MaxDuration <= 0 {
+		job.MaxDuration = utils.StringDuration(time.Minute)
+	}
+	if job.MaxDuration < job.MinDuration {
+		job.MaxDuration = job.MinDuration
+	}
+	if len(job.Environments) == 0 {
+		job.Environments = []string{"production"}
+	}
+	return job
+}
+
+// checkInLoadSplitter divides the load for each worker by:
+// 	* dividing the number of total calls per worker
+// 	* dividing the monitors per worker (each worker drives its own monitors)
+func checkInLoadSplitter(masterParams TestParams, numWorkers int) ([]TestParams, error) {
+	if numWorkers <= 0 {
+		return nil, fmt.Errorf("invalid number of workers %d need at least 1", numWorkers)
+	}
+	// divide attack intensity among workers
+	newParams := masterParams
+	newParams.Per = time.Duration(numWorkers) * masterParams.Per
+	var checkInJob CheckInJob
+	err := json.Unmarshal(masterParams.Params, &checkInJob)
+	if err != nil {
+		log.Error().Err(err).Msg("error unmarshalling checkInJob")
+		return nil, err
+	}
+	checkInJob = checkInJobWithDefaults(checkInJob)
+	if checkInJob.NumMonitors < numWorkers {
+		return nil, fmt.Errorf("not enough monitors (%d) for %d workers", checkInJob.NumMonitors, numWorkers)
+	}
+	splitMonitors, err := utils.Divide(checkInJob.NumMonitors, numWorkers)
+	if err != nil {
+		log.Error().Err(err).Msg("error splitting the number of monitors among workers")
+		return nil, err
+	}
+	firstMonitor := checkInJob.FirstMonitor
+	retVal := make([]TestParams, 0, numWorkers)
+	for idx := 0; idx < numWorkers; idx++ {
+		// distribute the monitors among the workers
+		checkInJob.NumMonitors = splitMonitors[idx]
+		checkInJob.FirstMonitor = firstMonitor
+		firstMonitor += splitMonitors[idx]
+		newParams.Params, err = json.Marshal(checkInJob)
+		if err != nil {
+			return nil, err
+		}
+		retVal = append(retVal, newParams)
+	}
+	return retVal, nil
+}
+
+func init() {
+	RegisterSentryTestType("checkIn", newCheckInLoadTester, checkInLoadSplitter)
+}
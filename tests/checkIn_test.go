@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckInLifecycle(t *testing.T) {
+	loadTester := newCheckInLoadTester("http://relay", json.RawMessage(
+		`{"numMonitors":5,"firstMonitor":10,"minDuration":"10s","maxDuration":"20s","errorRatio":0.5}`)).(*checkInLoadTester)
+
+	now := time.Now()
+	open := make(map[string]string) // monitor slug -> check-in id
+	closed := 0
+	for idx := 0; idx < 200; idx++ {
+		now = now.Add(time.Second)
+		monitor, checkIn := loadTester.nextCheckIn(now)
+		if monitor.slug != checkIn.MonitorSlug {
+			t.Fatalf("check-in for %s sent with monitor %s", checkIn.MonitorSlug, monitor.slug)
+		}
+		switch checkIn.Status {
+		case "in_progress":
+			if _, ok := open[checkIn.MonitorSlug]; ok {
+				t.Fatalf("monitor %s started a run while one is in progress", checkIn.MonitorSlug)
+			}
+			if checkIn.MonitorConfig == nil {
+				t.Errorf("expected a monitor config on in_progress check-ins")
+			}
+			open[checkIn.MonitorSlug] = checkIn.CheckInId
+		case "ok", "error":
+			if open[checkIn.MonitorSlug] != checkIn.CheckInId {
+				t.Fatalf("monitor %s closed check-in %s instead of %s", checkIn.MonitorSlug, checkIn.CheckInId,
+					open[checkIn.MonitorSlug])
+			}
+			if checkIn.Duration <= 0 || checkIn.Duration > 20 {
+				t.Errorf("invalid check-in duration %f", checkIn.Duration)
+			}
+			delete(open, checkIn.MonitorSlug)
+			closed++
+		default:
+			t.Fatalf("unexpected check-in status %s", checkIn.Status)
+		}
+		if checkIn.MonitorSlug < "monitor-10" || checkIn.MonitorSlug > "monitor-14" {
+			t.Fatalf("check-in for a monitor of another worker %s", checkIn.MonitorSlug)
+		}
+	}
+	if closed < 90 {
+		t.Errorf("expected about half of the check-ins to close runs got %d", closed)
+	}
+}
+
+func TestCheckInTimeouts(t *testing.T) {
+	loadTester := newCheckInLoadTester("http://relay", json.RawMessage(
+		`{"numMonitors":3,"timeoutRatio":1}`)).(*checkInLoadTester)
+	now := time.Now()
+	for idx := 0; idx < 10; idx++ {
+		_, checkIn := loadTester.nextCheckIn(now)
+		if checkIn.Status != "in_progress" {
+			t.Errorf("expected only in_progress check-ins when all runs time out, got %s", checkIn.Status)
+		}
+	}
+}
+
+func TestCheckInLoadSplitter(t *testing.T) {
+	params := TestParams{
+		TestType: "checkIn",
+		Per:      time.Second,
+		Params:   json.RawMessage(`{"numProjects":3,"numMonitors":10}`),
+	}
+	result, err := checkInLoadSplitter(params, 3)
+	if err != nil {
+		t.Fatalf("split returned error %s", err)
+	}
+	type split struct{ first, num int }
+	var actual []split
+	for _, workerParams := range result {
+		if workerParams.Per != 3*time.Second {
+			t.Errorf("split did not divide the load, per: %v", workerParams.Per)
+		}
+		var job CheckInJob
+		if err = json.Unmarshal(workerParams.Params, &job); err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, split{job.FirstMonitor, job.NumMonitors})
+	}
+	expected := []split{{0, 4}, {4, 3}, {7, 3}}
+	if diff := cmp.Diff(expected, actual, cmp.AllowUnexported(split{})); diff != "" {
+		t.Errorf("invalid monitor split (-expect +actual)\n %s", diff)
+	}
+
+	if _, err = checkInLoadSplitter(params, 11); err == nil {
+		t.Errorf("expected an error when there are more workers than monitors")
+	}
+}
@@ -16,6 +16,7 @@ import (
 // Contains  functionality for generating Session load tests
 
 type ClickhouseInsertLoadTester struct {
+	PayloadCounter
 	url         string
 	queryParams dataproviders.ClickhouseInsertJob
 
@@ -39,8 +40,9 @@ func newClickhouseInsertLoadTester(url string, rawClickhouseQueryParams json.Raw
 	log.Trace().Msgf("Clickhouse Insert generation for:\n%+v", clickhouseQueryParams)
 
 	return &ClickhouseInsertLoadTester{
-		url:         url,
-		queryParams: clickhouseQueryParams,
+		PayloadCounter: NewPayloadCounter(PayloadRows),
+		url:            url,
+		queryParams:    clickhouseQueryParams,
 		batchBuilder: *dataproviders.NewBatchBuilder(
 			clickhouseQueryParams.Schema,
 			uint64(clickhouseQueryParams.BatchSize),
@@ -74,6 +76,7 @@ func (slt *ClickhouseInsertLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 		tgt.Header.Set("Content-Type", "application/json")
 		tgt.Header.Set("Accept-Encoding", "gzip,deflate")
 		tgt.Body = buffer.Bytes()
+		slt.AddUnits(len(batch))
 		return nil
 	}, 0
 }
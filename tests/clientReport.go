@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// ClientReportJob is how a client report load test is parameterized
+//
+// Every request sends a `client_report` item with outcomes for events discarded by the SDK, the outcomes
+// are aggregated by Relay (by reason and category).
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "reasons": ["queue_overflow", "ratelimit_backoff", "sample_rate"],
+//  "categories": ["error", "transaction", "attachment"],
+//  "minOutcomes": 1,
+//  "maxOutcomes": 5,
+//  "minQuantity": 1,
+//  "maxQuantity": 100,
+//  "timestampSpread": "10m"
+// }
+// ```
+type ClientReportJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// Reasons the discard reasons used in the outcomes (if not specified defaults will be used)
+	Reasons []string `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+	// Categories the data categories used in the outcomes (if not specified defaults will be used)
+	Categories []string `json:"categories,omitempty" yaml:"categories,omitempty"`
+	// MinOutcomes the minimum number of discarded outcomes in a client report (default 1)
+	MinOutcomes int `json:"minOutcomes,omitempty" yaml:"minOutcomes,omitempty"`
+	// MaxOutcomes the maximum number of discarded outcomes in a client report (default 5)
+	MaxOutcomes int `json:"maxOutcomes,omitempty" yaml:"maxOutcomes,omitempty"`
+	// MinQuantity the minimum quantity of an outcome (default 1)
+	MinQuantity int `json:"minQuantity,omitempty" yaml:"minQuantity,omitempty"`
+	// MaxQuantity the maximum quantity of an outcome (default 100)
+	MaxQuantity int `json:"maxQuantity,omitempty" yaml:"maxQuantity,omitempty"`
+	// TimestampSpread the client report timestamps will be between now and -timestampSpread from now
+	TimestampSpread utils.StringDuration `json:"timestampSpread,omitempty" yaml:"timestampSpread,omitempty"`
+}
+
+// ClientReport defines the JSON format of a client_report item
+type ClientReport struct {
+	Timestamp       float64           `json:"timestamp"`
+	DiscardedEvents []DiscardedEvents `json:"discarded_events"`
+}
+
+type DiscardedEvents struct {
+	Reason   string `json:"reason"`
+	Category string `json:"category"`
+	Quantity int    `json:"quantity"`
+}
+
+// clientReportLoadTester is used to drive a client report load test
+type clientReportLoadTester struct {
+	PayloadCounter
+	url             string
+	clientReportJob ClientReportJob
+}
+
+func newClientReportLoadTester(url string, rawClientReport json.RawMessage) LoadTester {
+	var clientReportParams ClientReportJob
+	err := json.Unmarshal(rawClientReport, &clientReportParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid clientReport params received\nraw data\n%s", rawClientReport)
+	}
+	clientReportParams = clientReportJobWithDefaults(clientReportParams)
+	log.Trace().Msgf("ClientReport generation for:\n%+v", clientReportParams)
+
+	return &clientReportLoadTester{
+		PayloadCounter:  NewPayloadCounter(PayloadOutcomes),
+		url:             url,
+		clientReportJob: clientReportParams,
+	}
+}
+
+func (crlt *clientReportLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = crlt.clientReportJob.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", crlt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		report := ClientReportGenerator(crlt.clientReportJob)
+		body, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		buff, err := utils.EnvelopeFromItems("", time.Now().UTC(), map[string]string{"public_key": projectKey},
+			utils.EnvelopeItem{Type: "client_report", Payload: body})
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		crlt.AddUnits(len(report.DiscardedEvents))
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (crlt *clientReportLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// TargetUnits returns the number of outcomes of the client report of a request
+func (crlt *clientReportLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	var retVal uint64
+	for _, item := range parseEnvelope(tgt.Body) {
+		var report ClientReport
+		if item.header.Type == "client_report" && json.Unmarshal(item.payload, &report) == nil {
+			retVal += uint64(len(report.DiscardedEvents))
+		}
+	}
+	return retVal
+}
+
+// ClientReportGenerator generates a client report (the job is expected to have its defaults filled in)
+func ClientReportGenerator(job ClientReportJob) ClientReport {
+	timestamp := time.Now()
+	if job.TimestampSpread > 0 {
+		timestamp = timestamp.Add(-time.Duration(rand.Int63n(int64(job.TimestampSpread))))
+	}
+	numOutcomes := job.MinOutcomes + rand.Intn(job.MaxOutcomes-job.MinOutcomes+1)
+	discarded := make([]DiscardedEvents, 0, numOutcomes)
+	for idx := 0; idx < numOutcomes; idx++ {
+		discarded = append(discarded, DiscardedEvents{
+			Reason:   utils.SimpleRandomChoice(job.Reasons),
+			Category: utils.SimpleRandomChoice(job.Categories),
+			Quantity: job.MinQuantity + rand.Intn(job.MaxQuantity-job.MinQuantity+1),
+		})
+	}
+	return ClientReport{
+		Timestamp:       toUnixTimestamp(timestamp),
+		DiscardedEvents: discarded,
+	}
+}
+
+// clientReportJobWithDefaults fills in the defaults for the parameters that were not specified
+func clientReportJobWithDefaults(job ClientReportJob) ClientReportJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if len(job.Reasons) == 0 {
+		job.Reasons = []string{"queue_overflow", "cache_overflow", "ratelimit_backoff", "network_error",
+			"sample_rate", "before_send", "event_processor"}
+	}
+	if len(job.Categories) == 0 {
+		job.Categories = []string{"error", "transaction", "session", "attachment", "profile", "replay", "span"}
+	}
+	if job.MinOutcomes <= 0 {
+		job.MinOutcomes = 1
+	}
+	if job.MaxOutcomes <= 0 {
+		job.MaxOutcomes = 5
+	}
+	if job.MaxOutcomes < job.MinOutcomes {
+		job.MaxOutcomes = job.MinOutcomes
+	}
+	if job.MinQuantity <= 0 {
+		job.MinQuantity = 1
+	}
+	if job.MaxQuantity <= 0 {
+		job.MaxQuantity = 100
+	}
+	if job.MaxQuantity < job.MinQuantity {
+		job.MaxQuantity = job.MinQuantity
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("clientReport", newClientReportLoadTester, nil)
+}
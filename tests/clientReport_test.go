@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestClientReportGenerator(t *testing.T) {
+	job := clientReportJobWithDefaults(ClientReportJob{
+		Reasons:         []string{"sample_rate"},
+		Categories:      []string{"error", "transaction"},
+		MinOutcomes:     2,
+		MaxOutcomes:     4,
+		MinQuantity:     5,
+		MaxQuantity:     10,
+		TimestampSpread: utils.StringDuration(time.Minute),
+	})
+	now := time.Now()
+	for idx := 0; idx < 50; idx++ {
+		report := ClientReportGenerator(job)
+		if len(report.DiscardedEvents) < 2 || len(report.DiscardedEvents) > 4 {
+			t.Errorf("invalid number of outcomes %d", len(report.DiscardedEvents))
+		}
+		timestamp := time.Unix(0, int64(report.Timestamp*1e9))
+		if timestamp.Before(now.Add(-time.Minute)) || timestamp.After(now.Add(time.Second)) {
+			t.Errorf("timestamp %v outside of the timestamp spread", timestamp)
+		}
+		for _, outcome := range report.DiscardedEvents {
+			if outcome.Reason != "sample_rate" || (outcome.Category != "error" && outcome.Category != "transaction") ||
+				outcome.Quantity < 5 || outcome.Quantity > 10 {
+				t.Errorf("invalid outcome %+v", outcome)
+			}
+		}
+	}
+}
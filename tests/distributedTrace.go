@@ -0,0 +1,371 @@
+package tests
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// DistributedTraceJob is how a distributed trace load test is parameterized
+//
+// Every trace starts with a root transaction in a project of the first tier (e.g. a frontend pageload) and
+// every transaction of a tier calls the next tier (e.g. the backend services): its children are transactions in
+// projects of the next tier, linked (by parent_span_id) to one of its spans. All the transactions of a trace
+// share the trace_id and are sent as separate envelopes, in the order they finish, over the traceWindow.
+// The projects of the tiers do not overlap, the first tier uses the first projects, the second tier the
+// following projects and so on.
+// The other fields are the same as the transaction test fields (transactionDurationMin/Max is the duration
+// of the root transaction, the other transactions last as long as the span that calls them, maxSpans
+// defaults to 10).
+// example:
+// ```json
+// {
+//  "tiers": [
+//    {"name": "frontend", "numProjects": 10, "operation": "pageload"},
+//    {"name": "api", "numProjects": 5, "minTransactions": 1, "maxTransactions": 3},
+//    {"name": "storage", "numProjects": 2, "minTransactions": 0, "maxTransactions": 2}
+//  ],
+//  "traceWindow": "30s",
+//  "transactionDurationMin": "1s",
+//  "transactionDurationMax": "5s",
+//  "minSpans": 5,
+//  "maxSpans": 20,
+//  "operations": ["http.client","db","resource.script"]
+// }
+// ```
+type DistributedTraceJob struct {
+	// Tiers the tiers (services) of the traces, starting with the tier of the root transaction
+	// (default a frontend tier with one project calling a backend tier with two projects)
+	Tiers []TraceTier `json:"tiers,omitempty" yaml:"tiers,omitempty"`
+	// TraceWindow the transactions of a trace are sent over this time window (default 10s)
+	TraceWindow utils.StringDuration `json:"traceWindow,omitempty" yaml:"traceWindow,omitempty"`
+	// TransactionJobCommon embedded fields, see TransactionJobCommon documentation
+	TransactionJobCommon `yaml:"transactionJobCommon,inline"`
+}
+
+// TraceTier a tier (service) of a distributed trace
+// @doc({"scope":"job"})
+//
+type TraceTier struct {
+	// Name the name of the tier, used in the transaction names (default tier<idx>)
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// NumProjects the number of projects of the tier (default 1)
+	NumProjects int `json:"numProjects,omitempty" yaml:"numProjects,omitempty"`
+	// MinTransactions the minimum number of transactions of the tier called by a transaction of the previous
+	// tier, ignored for the first tier (default 1)
+	MinTransactions int `json:"minTransactions,omitempty" yaml:"minTransactions,omitempty"`
+	// MaxTransactions the maximum number of transactions of the tier called by a transaction of the previous
+	// tier, ignored for the first tier (default minTransactions)
+	MaxTransactions int `json:"maxTransactions,omitempty" yaml:"maxTransactions,omitempty"`
+	// Operation the operation of the transactions of the tier (default pageload for the first tier and
+	// http.server for the others)
+	Operation string `json:"operation,omitempty" yaml:"operation,omitempty"`
+}
+
+// TraceTransaction is a transaction of a distributed trace
+type TraceTransaction struct {
+	// Tier the index of the tier of the transaction
+	Tier        int
+	Transaction Transaction
+	// End is when the transaction finished (transaction timestamps have only second precision)
+	End time.Time
+}
+
+// scheduledTransaction is a transaction waiting to be sent
+type scheduledTransaction struct {
+	sendAt      time.Time
+	projectId   string
+	transaction Transaction
+}
+
+// transactionQueue is a priority queue of the transactions waiting to be sent (ordered by send time)
+type transactionQueue []scheduledTransaction
+
+func (q transactionQueue) Len() int            { return len(q) }
+func (q transactionQueue) Less(i, j int) bool  { return q[i].sendAt.Before(q[j].sendAt) }
+func (q transactionQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *transactionQueue) Push(x interface{}) { *q = append(*q, x.(scheduledTransaction)) }
+func (q *transactionQueue) Pop() interface{} {
+	old := *q
+	retVal := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return retVal
+}
+
+// distributedTraceLoadTester is used to drive a distributed trace load test
+type distributedTraceLoadTester struct {
+	PayloadCounter
+	url                 string
+	distributedTraceJob DistributedTraceJob
+	traceGenerator      func() []TraceTransaction
+	// lock protects pending
+	lock    sync.Mutex
+	pending transactionQueue
+}
+
+func newDistributedTraceLoadTester(url string, rawDistributedTrace json.RawMessage) LoadTester {
+	var distributedTraceParams DistributedTraceJob
+	err := json.Unmarshal(rawDistributedTrace, &distributedTraceParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid distributedTrace params received\nraw data\n%s", rawDistributedTrace)
+	}
+	distributedTraceParams = distributedTraceJobWithDefaults(distributedTraceParams)
+	log.Trace().Msgf("DistributedTrace generation for:\n%+v", distributedTraceParams)
+
+	return &distributedTraceLoadTester{
+		PayloadCounter:      NewPayloadCounter(PayloadEvents),
+		url:                 url,
+		distributedTraceJob: distributedTraceParams,
+		traceGenerator:      DistributedTraceGenerator(distributedTraceParams),
+	}
+}
+
+func (dtlt *distributedTraceLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	tierProjects := tierProjectProfiles(dtlt.distributedTraceJob.Tiers)
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		scheduled, err := dtlt.nextTransaction(time.Now(), func(tier int) (string, error) {
+			projectId, _, err := projectProvider.GetProjectIdV2(tierProjects[tier])
+			return projectId, err
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Could not get project id from project provider")
+			return err
+		}
+
+		tgt.Method = "POST"
+		projectId := scheduled.projectId
+		projectKey := projectProvider.GetProjectInfo(projectId).ProjectKey
+
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", dtlt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		transaction := scheduled.transaction
+		body, err := json.Marshal(transaction)
+		if err != nil {
+			return err
+		}
+		extraEnvelopeHeaders := map[string]string{
+			"trace_id":   transaction.Contexts.Trace.TraceId,
+			"public_key": projectKey,
+		}
+		buff, err := utils.EnvelopeFromBody(transaction.EventId, time.Now().UTC(), "transaction", extraEnvelopeHeaders, body)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		dtlt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+// nextTransaction returns the next transaction to be sent, if no transaction is due a new trace is generated
+// and its transactions are scheduled over the trace window (the first one is sent now)
+func (dtlt *distributedTraceLoadTester) nextTransaction(now time.Time,
+	getProjectId func(tier int) (string, error)) (scheduledTransaction, error) {
+	dtlt.lock.Lock()
+	defer dtlt.lock.Unlock()
+
+	if len(dtlt.pending) > 0 && !dtlt.pending[0].sendAt.After(now) {
+		return heap.Pop(&dtlt.pending).(scheduledTransaction), nil
+	}
+
+	trace := dtlt.traceGenerator()
+	sendTimes := traceSendTimes(trace, now, time.Duration(dtlt.distributedTraceJob.TraceWindow))
+	scheduled := make([]scheduledTransaction, 0, len(trace))
+	for idx, traceTransaction := range trace {
+		projectId, err := getProjectId(traceTransaction.Tier)
+		if err != nil {
+			return scheduledTransaction{}, err
+		}
+		scheduled = append(scheduled, scheduledTransaction{
+			sendAt:      sendTimes[idx],
+			projectId:   projectId,
+			transaction: traceTransaction.Transaction,
+		})
+	}
+	for _, transaction := range scheduled {
+		heap.Push(&dtlt.pending, transaction)
+	}
+	return heap.Pop(&dtlt.pending).(scheduledTransaction), nil
+}
+
+// traceSendTimes spreads the sending of the transactions of a trace over the window, in the order the
+// transactions finished (the first transaction that finished is sent now)
+func traceSendTimes(trace []TraceTransaction, now time.Time, window time.Duration) []time.Time {
+	if len(trace) == 0 {
+		return nil
+	}
+	firstEnd, lastEnd := trace[0].End, trace[0].End
+	for _, transaction := range trace {
+		if transaction.End.Before(firstEnd) {
+			firstEnd = transaction.End
+		}
+		if transaction.End.After(lastEnd) {
+			lastEnd = transaction.End
+		}
+	}
+	traceSpread := lastEnd.Sub(firstEnd)
+	retVal := make([]time.Time, 0, len(trace))
+	for _, transaction := range trace {
+		var delay time.Duration
+		if traceSpread > 0 {
+			delay = time.Duration(float64(window) * float64(transaction.End.Sub(firstEnd)) / float64(traceSpread))
+		}
+		retVal = append(retVal, now.Add(delay))
+	}
+	return retVal
+}
+
+func (dtlt *distributedTraceLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// tierProjectProfiles returns, for each tier, the project profiles that select only the projects of the tier
+func tierProjectProfiles(tiers []TraceTier) [][]utils.ProjectFreqProfile {
+	retVal := make([][]utils.ProjectFreqProfile, 0, len(tiers))
+	for idx := range tiers {
+		profiles := make([]utils.ProjectFreqProfile, 0, idx+1)
+		for prevIdx := 0; prevIdx < idx; prevIdx++ {
+			// skip the projects of the previous tiers
+			profiles = append(profiles, ProjectProfile{NumProjects: tiers[prevIdx].NumProjects, RelativeFreqWeight: 0})
+		}
+		profiles = append(profiles, ProjectProfile{NumProjects: tiers[idx].NumProjects, RelativeFreqWeight: 1})
+		retVal = append(retVal, profiles)
+	}
+	return retVal
+}
+
+// DistributedTraceGenerator generates the transactions of distributed traces (the job is expected to have its
+// defaults filled in), the root transaction is the first transaction of the trace
+func DistributedTraceGenerator(job DistributedTraceJob) func() []TraceTransaction {
+	transactionGen := TransactionGenerator(job.TransactionJobCommon)
+	spansGen := SpansGenerator(job.MinSpans, job.MaxSpans, job.Operations)
+	durationMin := time.Duration(job.TransactionDurationMin)
+	durationRange := time.Duration(job.TransactionDurationMax) - durationMin
+
+	// newTransaction creates a transaction of the tier running between start and end
+	newTransaction := func(tier int, traceId string, parentSpanId string, start time.Time, end time.Time) TraceTransaction {
+		transaction := transactionGen(0)
+		transaction.Transaction = fmt.Sprintf("/%s/%d", job.Tiers[tier].Name, rand.Intn(100))
+		transaction.StartTimestamp = toUtcString(start)
+		transaction.Timestamp = toUtcString(end)
+		trace := &transaction.Contexts.Trace
+		trace.TraceId = traceId
+		trace.ParentSpanId = parentSpanId
+		trace.Op = job.Tiers[tier].Operation
+		transaction.Spans = spansGen(trace.SpanId, traceId, start, end)
+		return TraceTransaction{Tier: tier, Transaction: transaction, End: end}
+	}
+
+	return func() []TraceTransaction {
+		end := time.Now()
+		start := end.Add(-(durationMin + time.Duration(float64(durationRange)*rand.Float64())))
+		root := newTransaction(0, EventIdGenerator()(), "", start, end)
+		trace := []TraceTransaction{root}
+		// the transactions of the previous tier (calling the current tier)
+		callers := trace
+		for tier := 1; tier < len(job.Tiers); tier++ {
+			tierJob := job.Tiers[tier]
+			tierTransactions := make([]TraceTransaction, 0, len(callers)*tierJob.MaxTransactions)
+			for _, caller := range callers {
+				numTransactions := tierJob.MinTransactions + rand.Intn(tierJob.MaxTransactions-tierJob.MinTransactions+1)
+				for idx := 0; idx < numTransactions; idx++ {
+					parentSpanId, callStart, callEnd := callingSpan(caller)
+					tierTransactions = append(tierTransactions,
+						newTransaction(tier, root.Transaction.Contexts.Trace.TraceId, parentSpanId, callStart, callEnd))
+				}
+			}
+			trace = append(trace, tierTransactions...)
+			callers = tierTransactions
+		}
+		return trace
+	}
+}
+
+// callingSpan returns a span of the transaction (and its duration) that calls the next tier, if the transaction
+// has no spans the transaction itself calls the next tier
+func callingSpan(caller TraceTransaction) (string, time.Time, time.Time) {
+	transaction := caller.Transaction
+	if len(transaction.Spans) == 0 {
+		start, _ := FromUTCString(transaction.StartTimestamp)
+		return transaction.Contexts.Trace.SpanId, start, caller.End
+	}
+	span := transaction.Spans[rand.Intn(len(transaction.Spans))]
+	return span.SpanId, fromUnixTimestamp(span.StartTimestamp), fromUnixTimestamp(span.Timestamp)
+}
+
+// fromUnixTimestamp converts a unix timestamp (in seconds) to a time
+func fromUnixTimestamp(timestamp float64) time.Time {
+	return time.Unix(0, int64(timestamp*1_000_000_000.0))
+}
+
+// distributedTraceJobWithDefaults fills in the defaults for the parameters that were not specified
+func distributedTraceJobWithDefaults(job DistributedTraceJob) DistributedTraceJob {
+	if len(job.Tiers) == 0 {
+		job.Tiers = []TraceTier{
+			{Name: "frontend", NumProjects: 1},
+			{Name: "backend", NumProjects: 2, MinTransactions: 2},
+		}
+	}
+	tiers := make([]TraceTier, 0, len(job.Tiers))
+	for idx, tier := range job.Tiers {
+		if len(tier.Name) == 0 {
+			tier.Name = fmt.Sprintf("tier%d", idx)
+		}
+		if tier.NumProjects <= 0 {
+			tier.NumProjects = 1
+		}
+		if tier.MinTransactions < 0 || (tier.MinTransactions == 0 && tier.MaxTransactions == 0) {
+			tier.MinTransactions = 1
+		}
+		if tier.MaxTransactions < tier.MinTransactions {
+			tier.MaxTransactions = tier.MinTransactions
+		}
+		if len(tier.Operation) == 0 {
+			if idx == 0 {
+				tier.Operation = "pageload"
+			} else {
+				tier.Operation = "http.server"
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+	job.Tiers = tiers
+	if job.TraceWindow <= 0 {
+		job.TraceWindow = utils.StringDuration(10 * time.Second)
+	}
+	if job.TransactionDurationMax <= 0 {
+		job.TransactionDurationMax = utils.StringDuration(2 * time.Second)
+	}
+	if job.TransactionDurationMin > job.TransactionDurationMax {
+		job.TransactionDurationMin = job.TransactionDurationMax
+	}
+	if job.MaxSpans <= 0 {
+		// the transactions of the next tier are called from spans
+		job.MaxSpans = 10
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("distributedTrace", newDistributedTraceLoadTester, nil)
+}
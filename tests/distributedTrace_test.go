@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestDistributedTraceGenerator(t *testing.T) {
+	job := distributedTraceJobWithDefaults(DistributedTraceJob{
+		Tiers: []TraceTier{
+			{Name: "frontend"},
+			{Name: "api", MinTransactions: 1, MaxTransactions: 3},
+			{Name: "storage", MinTransactions: 2},
+		},
+		TransactionJobCommon: TransactionJobCommon{MinSpans: 3, MaxSpans: 10},
+	})
+	generator := DistributedTraceGenerator(job)
+
+	for iter := 0; iter < 20; iter++ {
+		trace := generator()
+		if len(trace) < 4 {
+			t.Fatalf("expected at least 4 transactions got %d", len(trace))
+		}
+		root := trace[0].Transaction
+		traceId := root.Contexts.Trace.TraceId
+		if root.Contexts.Trace.ParentSpanId != "" || root.Contexts.Trace.Op != "pageload" {
+			t.Errorf("invalid root transaction %+v", root.Contexts.Trace)
+		}
+		// all the spans (and transactions) of the trace
+		spans := make(map[string]TraceTransaction)
+		for _, traceTransaction := range trace {
+			spans[traceTransaction.Transaction.Contexts.Trace.SpanId] = traceTransaction
+			for _, span := range traceTransaction.Transaction.Spans {
+				spans[span.SpanId] = traceTransaction
+			}
+		}
+		for idx, traceTransaction := range trace[1:] {
+			transaction := traceTransaction.Transaction
+			if transaction.Contexts.Trace.TraceId != traceId {
+				t.Errorf("transaction %d not in trace %s", idx, traceId)
+			}
+			caller, ok := spans[transaction.Contexts.Trace.ParentSpanId]
+			if !ok {
+				t.Errorf("transaction %d parent span %s not in the trace", idx, transaction.Contexts.Trace.ParentSpanId)
+				continue
+			}
+			if caller.Tier != traceTransaction.Tier-1 {
+				t.Errorf("transaction of tier %d called from tier %d", traceTransaction.Tier, caller.Tier)
+			}
+			if transaction.StartTimestamp < caller.Transaction.StartTimestamp || transaction.Timestamp > caller.Transaction.Timestamp {
+				t.Errorf("transaction %d does not run within its caller", idx)
+			}
+			if transaction.Contexts.Trace.Op != "http.server" {
+				t.Errorf("unexpected operation %s", transaction.Contexts.Trace.Op)
+			}
+		}
+	}
+}
+
+func TestDistributedTraceSpanLinks(t *testing.T) {
+	// by default the transactions of the next tier are called from the spans of their parent
+	generator := DistributedTraceGenerator(distributedTraceJobWithDefaults(DistributedTraceJob{}))
+	for iter := 0; iter < 10; iter++ {
+		trace := generator()
+		root := trace[0].Transaction
+		spanIds := make(map[string]bool)
+		for _, span := range root.Spans {
+			spanIds[span.SpanId] = true
+		}
+		for _, traceTransaction := range trace[1:] {
+			if spanIds[traceTransaction.Transaction.Contexts.Trace.ParentSpanId] {
+				return
+			}
+		}
+	}
+	t.Errorf("expected transactions called from the spans of the root transaction")
+}
+
+func TestTierProjectProfiles(t *testing.T) {
+	tiers := []TraceTier{{NumProjects: 2}, {NumProjects: 3}, {NumProjects: 1}}
+	projectProvider := utils.RandomProjectProvider{}
+	for tier, profiles := range tierProjectProfiles(tiers) {
+		for iter := 0; iter < 50; iter++ {
+			projectId, _, err := projectProvider.GetProjectIdV2(profiles)
+			if err != nil {
+				t.Fatalf("could not get project: %v", err)
+			}
+			id, _ := strconv.Atoi(projectId)
+			first := map[int]int{0: 1, 1: 3, 2: 6}[tier]
+			if id < first || id >= first+tiers[tier].NumProjects {
+				t.Errorf("project %d not in tier %d", id, tier)
+			}
+		}
+	}
+}
+
+func TestTraceSendTimes(t *testing.T) {
+	now := getNow()
+	trace := []TraceTransaction{{End: now}, {End: now.Add(-2 * time.Second)}, {End: now.Add(-time.Second)}}
+	sendTimes := traceSendTimes(trace, now, 10*time.Second)
+	expected := []time.Time{now.Add(10 * time.Second), now, now.Add(5 * time.Second)}
+	for idx := range expected {
+		if !sendTimes[idx].Equal(expected[idx]) {
+			t.Errorf("transaction %d expected to be sent at %s got %s", idx, expected[idx], sendTimes[idx])
+		}
+	}
+}
+
+func TestDistributedTraceSchedule(t *testing.T) {
+	loadTester := newDistributedTraceLoadTester("", json.RawMessage(`{"traceWindow":"1m"}`)).(*distributedTraceLoadTester)
+	now := getNow()
+	// a frontend transaction calling two backend transactions that finish before it
+	loadTester.traceGenerator = func() []TraceTransaction {
+		traceId := EventIdGenerator()()
+		trace := make([]TraceTransaction, 0, 3)
+		for idx, end := range []time.Time{now, now.Add(-2 * time.Second), now.Add(-time.Second)} {
+			transaction := Transaction{}
+			transaction.Contexts.Trace.TraceId = traceId
+			transaction.Contexts.Trace.SpanId = SpanIdGenerator()()
+			if idx > 0 {
+				transaction.Contexts.Trace.ParentSpanId = trace[0].Transaction.Contexts.Trace.SpanId
+			}
+			trace = append(trace, TraceTransaction{Tier: utils.Min(idx, 1), Transaction: transaction, End: end})
+		}
+		return trace
+	}
+	getProjectId := func(tier int) (string, error) { return strconv.Itoa(tier + 1), nil }
+
+	first, err := loadTester.nextTransaction(now, getProjectId)
+	if err != nil {
+		t.Fatalf("could not get transaction: %v", err)
+	}
+	if first.transaction.Contexts.Trace.ParentSpanId == "" || first.projectId != "2" {
+		t.Errorf("expected the backend transaction that finished first got project %s", first.projectId)
+	}
+	if len(loadTester.pending) != 2 {
+		t.Fatalf("expected 2 pending transactions got %d", len(loadTester.pending))
+	}
+	traceId := first.transaction.Contexts.Trace.TraceId
+	// transactions that are not due yet are not sent, a new trace is started
+	next, _ := loadTester.nextTransaction(now, getProjectId)
+	if next.transaction.Contexts.Trace.TraceId == traceId {
+		t.Errorf("expected a new trace")
+	}
+	// after the window all the transactions of the first trace are sent
+	later := now.Add(time.Minute)
+	seen := 0
+	for len(loadTester.pending) > 0 {
+		scheduled, _ := loadTester.nextTransaction(later, getProjectId)
+		if scheduled.transaction.Contexts.Trace.TraceId == traceId {
+			seen++
+		}
+	}
+	if seen != 2 {
+		t.Errorf("expected the remaining 2 transactions of the trace got %d", seen)
+	}
+}
@@ -0,0 +1,342 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// ErrorJob is how an error load test is parameterized
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "numIssues": 500,
+//  "minFrames": 5,
+//  "maxFrames": 30,
+//  "maxChainedExceptions": 3,
+//  "numMessageVariants": 10,
+//  "useFingerprints": false,
+//  "numReleases": 10,
+//  "numEnvironments": 3,
+//  "numUsers": 2000,
+//  "numTags": 5,
+//  "numTagValues": 10,
+//  "minBreadcrumbs": 5,
+//  "maxBreadcrumbs": 25,
+//  "levels": ["error", "fatal"],
+//  "platform": "python"
+// }
+// ```
+type ErrorJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// NumIssues the number of distinct issues generated (each issue has its own exception types and stack traces)
+	NumIssues int `json:"numIssues,omitempty" yaml:"numIssues,omitempty"`
+	// MinFrames the minimum number of frames in the stack trace of an exception
+	MinFrames int `json:"minFrames,omitempty" yaml:"minFrames,omitempty"`
+	// MaxFrames the maximum number of frames in the stack trace of an exception
+	MaxFrames int `json:"maxFrames,omitempty" yaml:"maxFrames,omitempty"`
+	// MaxChainedExceptions the maximum number of (chained) exceptions in an event (default 1)
+	MaxChainedExceptions int `json:"maxChainedExceptions,omitempty" yaml:"maxChainedExceptions,omitempty"`
+	// NumMessageVariants the number of distinct exception messages generated for each issue (0 generates a unique message for each event)
+	NumMessageVariants int `json:"numMessageVariants,omitempty" yaml:"numMessageVariants,omitempty"`
+	// UseFingerprints sets an explicit fingerprint for each issue, otherwise events are grouped by their stack traces
+	UseFingerprints bool `json:"useFingerprints,omitempty" yaml:"useFingerprints,omitempty"`
+	// NumReleases specifies the maximum number of unique releases generated in a test
+	NumReleases uint64 `json:"numReleases,omitempty" yaml:"numReleases,omitempty"`
+	// NumEnvironments specifies the number of unique environments generated in a test
+	NumEnvironments int `json:"numEnvironments,omitempty" yaml:"numEnvironments,omitempty"`
+	// NumUsers specifies the maximum number of unique users generated in a test
+	NumUsers uint64 `json:"numUsers,omitempty" yaml:"numUsers,omitempty"`
+	// NumTags the number of tags set on each event
+	NumTags int `json:"numTags,omitempty" yaml:"numTags,omitempty"`
+	// NumTagValues the number of distinct values generated for each tag
+	NumTagValues int `json:"numTagValues,omitempty" yaml:"numTagValues,omitempty"`
+	// MinBreadcrumbs specifies the minimum number of breadcrumbs that will be generated in an event
+	MinBreadcrumbs uint64 `json:"minBreadcrumbs,omitempty" yaml:"minBreadcrumbs,omitempty"`
+	// MaxBreadcrumbs specifies the maximum number of breadcrumbs that will be generated in an event
+	MaxBreadcrumbs uint64 `json:"maxBreadcrumbs,omitempty" yaml:"maxBreadcrumbs,omitempty"`
+	// BreadcrumbCategories the categories used for breadcrumbs (if not specified defaults will be used *)
+	BreadcrumbCategories []string `json:"breadcrumbCategories,omitempty" yaml:"breadcrumbCategories,omitempty"`
+	// BreadcrumbLevels specifies levels used for breadcrumbs (if not specified defaults will be used *)
+	BreadcrumbLevels []string `json:"breadcrumbLevels,omitempty" yaml:"breadcrumbLevels,omitempty"`
+	// BreadcrumbsTypes specifies the types used for breadcrumbs (if not specified defaults will be used *)
+	BreadcrumbsTypes []string `json:"breadcrumbsTypes,omitempty" yaml:"breadcrumbsTypes,omitempty"`
+	// BreadcrumbMessages specifies messages set in breadcrumbs (if not specified defaults will be used *)
+	BreadcrumbMessages []string `json:"breadcrumbMessages,omitempty" yaml:"breadcrumbMessages,omitempty"`
+	// Levels the levels of the events (default error)
+	Levels []string `json:"levels,omitempty" yaml:"levels,omitempty"`
+	// Platform the platform of the events (default python)
+	Platform string `json:"platform,omitempty" yaml:"platform,omitempty"`
+}
+
+// ErrorEvent defines the JSON format of a Sentry error event
+type ErrorEvent struct {
+	EventId     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp,omitempty"` // RFC 3339
+	Platform    string            `json:"platform,omitempty"`
+	Level       string            `json:"level,omitempty"`
+	Logger      string            `json:"logger,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        User              `json:"user,omitempty"`
+	Contexts    Contexts          `json:"contexts,omitempty"`
+	Breadcrumbs []Breadcrumb      `json:"breadcrumbs,omitempty"`
+	Exception   ExceptionList     `json:"exception"`
+}
+
+type ExceptionList struct {
+	Values []Exception `json:"values"`
+}
+
+type Exception struct {
+	Type       string     `json:"type"`
+	Value      string     `json:"value,omitempty"`
+	Module     string     `json:"module,omitempty"`
+	Stacktrace Stacktrace `json:"stacktrace"`
+	Mechanism  *Mechanism `json:"mechanism,omitempty"`
+}
+
+type Mechanism struct {
+	Type    string `json:"type"`
+	Handled bool   `json:"handled"`
+}
+
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+type Frame struct {
+	Function string `json:"function,omitempty"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	AbsPath  string `json:"abs_path,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	InApp    bool   `json:"in_app"`
+}
+
+// issueTemplate is the invariable part of the events of an issue (what determines their grouping)
+type issueTemplate struct {
+	fingerprint string
+	exceptions  []Exception
+}
+
+// errorLoadTester is used to drive an error load test
+type errorLoadTester struct {
+	PayloadCounter
+	url            string
+	errorParams    ErrorJob
+	errorGenerator func() ErrorEvent
+}
+
+func newErrorLoadTester(url string, rawError json.RawMessage) LoadTester {
+	var errorParams ErrorJob
+	err := json.Unmarshal(rawError, &errorParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid error params received\nraw data\n%s", rawError)
+	}
+	if errorParams.NumProjects == 0 {
+		errorParams.NumProjects = 1
+	}
+	log.Trace().Msgf("Error generation for:\n%+v", errorParams)
+
+	return &errorLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadEvents),
+		url:            url,
+		errorParams:    errorParams,
+		errorGenerator: ErrorGenerator(errorParams),
+	}
+}
+
+func (elt *errorLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = elt.errorParams.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", elt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		event := elt.errorGenerator()
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		extraEnvelopeHeaders := map[string]string{
+			"public_key": projectKey,
+		}
+		buff, err := utils.EnvelopeFromBody(event.EventId, time.Now().UTC(), "event", extraEnvelopeHeaders, body)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		elt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (elt *errorLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// ErrorGenerator returns a function that generates error events for the issues described by the job
+func ErrorGenerator(job ErrorJob) func() ErrorEvent {
+	job = errorJobWithDefaults(job)
+	issues := make([]issueTemplate, job.NumIssues)
+	for idx := range issues {
+		issues[idx] = newIssueTemplate(idx, job)
+	}
+	idGen := EventIdGenerator()
+	relGen := ReleaseGenerator(job.NumReleases)
+	userGen := UserGenerator(job.NumUsers)
+	osGen := OsContextGenerator()
+	deviceGen := DeviceContextGenerator()
+	appGen := AppContextGenerator()
+	traceGen := TraceContextGenerator(nil)
+	breadcrumbsGen := BreadcrumbsGenerator(job.MinBreadcrumbs, job.MaxBreadcrumbs, job.BreadcrumbCategories,
+		job.BreadcrumbLevels, job.BreadcrumbsTypes, job.BreadcrumbMessages)
+
+	return func() ErrorEvent {
+		issue := issues[rand.Intn(len(issues))]
+		exceptions := make([]Exception, len(issue.exceptions))
+		for idx, exception := range issue.exceptions {
+			exception.Value = exceptionMessage(job.NumMessageVariants)
+			exceptions[idx] = exception
+		}
+
+		tags := make(map[string]string, job.NumTags)
+		for idx := 0; idx < job.NumTags; idx++ {
+			tags[fmt.Sprintf("tag%d", idx)] = fmt.Sprintf("value%d", rand.Intn(job.NumTagValues))
+		}
+
+		var fingerprint []string
+		if job.UseFingerprints {
+			fingerprint = []string{issue.fingerprint}
+		}
+
+		return ErrorEvent{
+			EventId:     idGen(),
+			Timestamp:   toUtcString(time.Now()),
+			Platform:    job.Platform,
+			Level:       utils.SimpleRandomChoice(job.Levels),
+			Logger:      utils.SimpleRandomChoice([]string{"foo.bar.baz", "bam.baz.bad", ""}),
+			Release:     relGen(),
+			Environment: fmt.Sprintf("environment%d", rand.Intn(job.NumEnvironments)),
+			Fingerprint: fingerprint,
+			Tags:        tags,
+			User:        userGen(),
+			Contexts: Contexts{
+				Os:     osGen(),
+				Device: deviceGen(),
+				App:    appGen(),
+				Trace:  traceGen(),
+			},
+			Breadcrumbs: breadcrumbsGen(),
+			Exception:   ExceptionList{Values: exceptions},
+		}
+	}
+}
+
+// errorJobWithDefaults fills in the defaults for the parameters that were not specified
+func errorJobWithDefaults(job ErrorJob) ErrorJob {
+	if job.NumIssues <= 0 {
+		job.NumIssues = 1
+	}
+	if job.MinFrames <= 0 {
+		job.MinFrames = 1
+	}
+	if job.MaxFrames < job.MinFrames {
+		job.MaxFrames = job.MinFrames
+	}
+	if job.MaxChainedExceptions <= 0 {
+		job.MaxChainedExceptions = 1
+	}
+	if job.NumEnvironments <= 0 {
+		job.NumEnvironments = 1
+	}
+	if job.NumTagValues <= 0 {
+		job.NumTagValues = 1
+	}
+	if len(job.Levels) == 0 {
+		job.Levels = []string{"error"}
+	}
+	if len(job.Platform) == 0 {
+		job.Platform = "python"
+	}
+	return job
+}
+
+// newIssueTemplate creates the exceptions of an issue
+//
+// The issue is generated from its index (and not randomly) so that all workers generate the same issues.
+func newIssueTemplate(issueIdx int, job ErrorJob) issueTemplate {
+	rnd := rand.New(rand.NewSource(int64(issueIdx)))
+	numExceptions := 1 + rnd.Intn(job.MaxChainedExceptions)
+	exceptions := make([]Exception, 0, numExceptions)
+	for exceptionIdx := 0; exceptionIdx < numExceptions; exceptionIdx++ {
+		module := fmt.Sprintf("app.issue%d.module%d", issueIdx, exceptionIdx)
+		numFrames := job.MinFrames + rnd.Intn(job.MaxFrames-job.MinFrames+1)
+		frames := make([]Frame, 0, numFrames)
+		for frameIdx := 0; frameIdx < numFrames; frameIdx++ {
+			frameModule := fmt.Sprintf("%s.sub%d", module, rnd.Intn(5))
+			frames = append(frames, Frame{
+				Function: fmt.Sprintf("function_%d_%d", issueIdx, rnd.Intn(1000)),
+				Module:   frameModule,
+				Filename: fmt.Sprintf("app/issue%d/module%d/file%d.py", issueIdx, exceptionIdx, frameIdx),
+				AbsPath:  fmt.Sprintf("/srv/app/issue%d/module%d/file%d.py", issueIdx, exceptionIdx, frameIdx),
+				Lineno:   1 + rnd.Intn(500),
+				InApp:    rnd.Intn(4) != 0,
+			})
+		}
+		exception := Exception{
+			Type:       fmt.Sprintf("LoadTestError%d", issueIdx),
+			Module:     module,
+			Stacktrace: Stacktrace{Frames: frames},
+		}
+		if exceptionIdx == numExceptions-1 {
+			// the last exception in the chain is the one that was caught (or not)
+			exception.Mechanism = &Mechanism{Type: "generic", Handled: rnd.Intn(2) == 0}
+		}
+		exceptions = append(exceptions, exception)
+	}
+	return issueTemplate{
+		fingerprint: fmt.Sprintf("load-test-issue-%d", issueIdx),
+		exceptions:  exceptions,
+	}
+}
+
+// exceptionMessage generates one of numVariants exception messages (a unique message if numVariants is 0)
+func exceptionMessage(numVariants int) string {
+	if numVariants <= 0 {
+		return fmt.Sprintf("unexpected value %s", EventIdGenerator()())
+	}
+	return fmt.Sprintf("unexpected value %d", rand.Intn(numVariants))
+}
+
+func init() {
+	RegisterSentryTestType("error", newErrorLoadTester, nil)
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestErrorGeneratorIssues(t *testing.T) {
+	job := ErrorJob{
+		NumIssues:            4,
+		MinFrames:            3,
+		MaxFrames:            6,
+		MaxChainedExceptions: 2,
+		NumMessageVariants:   2,
+		NumTags:              3,
+		NumTagValues:         2,
+		UseFingerprints:      true,
+	}
+	generator := ErrorGenerator(job)
+
+	fingerprints := make(map[string]bool)
+	messages := make(map[string]bool)
+	for idx := 0; idx < 200; idx++ {
+		event := generator()
+		if len(event.Fingerprint) != 1 {
+			t.Fatalf("expected a fingerprint got %v", event.Fingerprint)
+		}
+		fingerprints[event.Fingerprint[0]] = true
+		exceptions := event.Exception.Values
+		if len(exceptions) < 1 || len(exceptions) > 2 {
+			t.Errorf("invalid number of chained exceptions %d", len(exceptions))
+		}
+		for _, exception := range exceptions {
+			numFrames := len(exception.Stacktrace.Frames)
+			if numFrames < 3 || numFrames > 6 {
+				t.Errorf("invalid number of frames %d", numFrames)
+			}
+			messages[exception.Value] = true
+		}
+		if len(event.Tags) != 3 {
+			t.Errorf("expected 3 tags got %v", event.Tags)
+		}
+		if event.Level != "error" || event.Platform != "python" {
+			t.Errorf("unexpected defaults level:%s platform:%s", event.Level, event.Platform)
+		}
+	}
+	if len(fingerprints) != 4 {
+		t.Errorf("expected 4 distinct issues got %d", len(fingerprints))
+	}
+	if len(messages) != 2 {
+		t.Errorf("expected 2 message variants got %d", len(messages))
+	}
+}
+
+func TestIssueTemplatesAreStable(t *testing.T) {
+	// all workers must generate the same issues
+	job := errorJobWithDefaults(ErrorJob{MinFrames: 2, MaxFrames: 10, MaxChainedExceptions: 3})
+	for issueIdx := 0; issueIdx < 5; issueIdx++ {
+		if diff := cmp.Diff(newIssueTemplate(issueIdx, job), newIssueTemplate(issueIdx, job),
+			cmp.AllowUnexported(issueTemplate{})); diff != "" {
+			t.Errorf("issue %d not stable (-first +second)\n %s", issueIdx, diff)
+		}
+	}
+}
+
+func TestErrorBreadcrumbs(t *testing.T) {
+	// the default events carry breadcrumbs
+	generator := ErrorGenerator(ErrorJob{})
+	numBreadcrumbs := 0
+	for idx := 0; idx < 10; idx++ {
+		numBreadcrumbs += len(generator().Breadcrumbs)
+	}
+	if numBreadcrumbs == 0 {
+		t.Errorf("expected the default events to carry breadcrumbs")
+	}
+	// the minimum number of breadcrumbs does not limit the maximum
+	generator = ErrorGenerator(ErrorJob{MinBreadcrumbs: 5})
+	for idx := 0; idx < 20; idx++ {
+		if len(generator().Breadcrumbs) > 5 {
+			return
+		}
+	}
+	t.Errorf("expected more than the minimum number of breadcrumbs")
+}
+
+func TestErrorEventSerialization(t *testing.T) {
+	event := ErrorGenerator(ErrorJob{NumMessageVariants: 0})()
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("could not serialize event: %v", err)
+	}
+	var raw map[string]any
+	if err = json.Unmarshal(body, &raw); err != nil {
+		t.Fatal(err)
+	}
+	exception, ok := raw["exception"].(map[string]any)
+	if !ok || len(exception["values"].([]any)) == 0 {
+		t.Errorf("expected exception values in %s", body)
+	}
+	if _, ok = raw["fingerprint"]; ok {
+		t.Errorf("expected no fingerprint when not using fingerprints")
+	}
+}
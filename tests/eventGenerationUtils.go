@@ -22,6 +22,12 @@ type Contexts struct {
 	Device DeviceContext `json:"device,omitempty"`
 	App    AppContext    `json:"app,omitempty"`
 	Trace  TraceContext  `json:"trace,omitempty"`
+	// Profile links a transaction to the profile sent with it
+	Profile *ProfileContext `json:"profile,omitempty"`
+}
+
+type ProfileContext struct {
+	ProfileId string `json:"profile_id"`
 }
 
 type OsContext struct {
@@ -114,6 +120,7 @@ type Span struct {
 func SpansGenerator(minSpans uint64, maxSpans uint64, operations []string) func(transactionId string, traceId string, transactionStart time.Time, timestamp time.Time) []Span {
 
 	operationGen := OperationGenerator(operations)
+	maxSpans = rangeMax(minSpans, maxSpans)
 
 	return func(transactionId string, traceId string, transactionStart time.Time, timestamp time.Time) []Span {
 		numSpans := int(minSpans) + rand.Intn(int(maxSpans-minSpans))
@@ -177,6 +184,7 @@ func BreadcrumbsGenerator(min uint64, max uint64, categories []string, levels []
 	if max == 0 {
 		max = 50
 	}
+	max = rangeMax(min, max)
 	if len(categories) == 0 {
 		categories = []string{"auth", "web-request", "query"}
 	}
@@ -213,6 +221,15 @@ func BreadcrumbsGenerator(min uint64, max uint64, categories []string, levels []
 	}
 }
 
+// rangeMax returns the (exclusive) maximum of a range of counts, making sure the range is not empty (a range
+// with max <= min generates exactly min)
+func rangeMax(min uint64, max uint64) uint64 {
+	if max <= min {
+		return min + 1
+	}
+	return max
+}
+
 func MeasurementsGenerator(measurements []string) func() map[string]float64 {
 	return func() map[string]float64 {
 		retVal := make(map[string]float64, len(measurements))
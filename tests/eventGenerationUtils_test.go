@@ -3,6 +3,7 @@ package tests
 import (
 	"regexp"
 	"testing"
+	"time"
 )
 
 func TestVersionGenerator(t *testing.T) {
@@ -31,6 +32,20 @@ func TestVersionGenerator(t *testing.T) {
 	}
 }
 
+func TestGeneratorRanges(t *testing.T) {
+	end := time.Now()
+	start := end.Add(-time.Second)
+	// an empty range generates exactly the minimum
+	for _, maxSpans := range []uint64{0, 3} {
+		if spans := SpansGenerator(3, maxSpans, nil)("a", "b", start, end); len(spans) != 3 {
+			t.Errorf("SpansGenerator(3,%d) expected 3 spans got %d", maxSpans, len(spans))
+		}
+	}
+	if breadcrumbs := BreadcrumbsGenerator(60, 0, nil, nil, nil, nil)(); len(breadcrumbs) != 60 {
+		t.Errorf("BreadcrumbsGenerator(60,0) expected 60 breadcrumbs got %d", len(breadcrumbs))
+	}
+}
+
 func TestTransactionGenerator(T *testing.T) {
 
 }
@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// FeedbackJob is how a user feedback load test is parameterized
+//
+// Every request sends a user feedback either as a (legacy) `user_report` item or as a `feedback` item, the
+// feedback refers to an event id and, if sendEvent is set, the error event is sent in the same envelope.
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "itemTypes": ["feedback", "user_report"],
+//  "sendEvent": true,
+//  "error": {"numIssues": 10},
+//  "numUsers": 1000,
+//  "minMessageLength": 10,
+//  "maxMessageLength": 500,
+//  "timestampSpread": "1h"
+// }
+// ```
+type FeedbackJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// ItemTypes the types of the items used to send the feedback, feedback or user_report (default feedback)
+	ItemTypes []string `json:"itemTypes,omitempty" yaml:"itemTypes,omitempty"`
+	// SendEvent sends the error event the feedback refers to in the same envelope
+	SendEvent bool `json:"sendEvent,omitempty" yaml:"sendEvent,omitempty"`
+	// Error the parameters used to generate the error events (see ErrorJob, numProjects is ignored)
+	Error ErrorJob `json:"error,omitempty" yaml:"error,omitempty"`
+	// NumUsers the number of distinct users sending feedback (default 100)
+	NumUsers int `json:"numUsers,omitempty" yaml:"numUsers,omitempty"`
+	// MinMessageLength the minimum length of the feedback message (default 10)
+	MinMessageLength int `json:"minMessageLength,omitempty" yaml:"minMessageLength,omitempty"`
+	// MaxMessageLength the maximum length of the feedback message (default 200)
+	MaxMessageLength int `json:"maxMessageLength,omitempty" yaml:"maxMessageLength,omitempty"`
+	// TimestampSpread the feedback timestamps will be between now and -timestampSpread from now
+	TimestampSpread utils.StringDuration `json:"timestampSpread,omitempty" yaml:"timestampSpread,omitempty"`
+}
+
+// UserReport defines the JSON format of a (legacy) user_report item
+type UserReport struct {
+	EventId  string `json:"event_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Comments string `json:"comments"`
+}
+
+// Feedback defines the JSON format of a feedback item
+type Feedback struct {
+	EventId   string           `json:"event_id"`
+	Type      string           `json:"type"`
+	Timestamp float64          `json:"timestamp"`
+	Platform  string           `json:"platform"`
+	Contexts  FeedbackContexts `json:"contexts"`
+}
+
+type FeedbackContexts struct {
+	Feedback FeedbackContext `json:"feedback"`
+}
+
+type FeedbackContext struct {
+	Message           string `json:"message"`
+	ContactEmail      string `json:"contact_email,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Url               string `json:"url,omitempty"`
+	AssociatedEventId string `json:"associated_event_id,omitempty"`
+}
+
+// feedbackLoadTester is used to drive a user feedback load test
+type feedbackLoadTester struct {
+	PayloadCounter
+	url            string
+	feedbackJob    FeedbackJob
+	idGen          func() string
+	errorGenerator func() ErrorEvent
+}
+
+func newFeedbackLoadTester(url string, rawFeedback json.RawMessage) LoadTester {
+	var feedbackParams FeedbackJob
+	err := json.Unmarshal(rawFeedback, &feedbackParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid feedback params received\nraw data\n%s", rawFeedback)
+	}
+	feedbackParams = feedbackJobWithDefaults(feedbackParams)
+	log.Trace().Msgf("Feedback generation for:\n%+v", feedbackParams)
+
+	return &feedbackLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadEvents),
+		url:            url,
+		feedbackJob:    feedbackParams,
+		idGen:          EventIdGenerator(),
+		errorGenerator: ErrorGenerator(feedbackParams.Error),
+	}
+}
+
+func (flt *feedbackLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = flt.feedbackJob.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", flt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		items, envelopeEventId, err := flt.feedbackItems()
+		if err != nil {
+			return err
+		}
+		buff, err := utils.EnvelopeFromItems(envelopeEventId, time.Now().UTC(), map[string]string{"public_key": projectKey}, items...)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		flt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (flt *feedbackLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// feedbackItems creates the envelope items for a user feedback (and the event id of the envelope)
+func (flt *feedbackLoadTester) feedbackItems() ([]utils.EnvelopeItem, string, error) {
+	job := flt.feedbackJob
+	items := make([]utils.EnvelopeItem, 0, 2)
+
+	var eventId string
+	if job.SendEvent {
+		event := flt.errorGenerator()
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, "", err
+		}
+		eventId = event.EventId
+		items = append(items, utils.EnvelopeItem{Type: "event", Payload: body})
+	} else {
+		eventId = flt.idGen()
+	}
+
+	user := rand.Intn(job.NumUsers)
+	name := fmt.Sprintf("User %d", user)
+	email := fmt.Sprintf("user%d@example.com", user)
+	message := feedbackMessage(job.MinMessageLength + rand.Intn(job.MaxMessageLength-job.MinMessageLength+1))
+
+	itemType := utils.SimpleRandomChoice(job.ItemTypes)
+	var body []byte
+	var err error
+	envelopeEventId := eventId
+	if itemType == "user_report" {
+		body, err = json.Marshal(UserReport{
+			EventId:  eventId,
+			Name:     name,
+			Email:    email,
+			Comments: message,
+		})
+	} else {
+		feedback := Feedback{
+			EventId:   flt.idGen(),
+			Type:      "feedback",
+			Timestamp: toUnixTimestamp(time.Now().Add(-job.timestampDelay())),
+			Platform:  "javascript",
+			Contexts: FeedbackContexts{Feedback: FeedbackContext{
+				Message:           message,
+				ContactEmail:      email,
+				Name:              name,
+				Url:               fmt.Sprintf("https://app.example.com/page%d", rand.Intn(100)),
+				AssociatedEventId: eventId,
+			}},
+		}
+		if !job.SendEvent {
+			// the feedback is the only event in the envelope
+			envelopeEventId = feedback.EventId
+		}
+		body, err = json.Marshal(feedback)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	items = append(items, utils.EnvelopeItem{Type: itemType, Payload: body})
+	return items, envelopeEventId, nil
+}
+
+// timestampDelay returns a random delay (from now) between 0 and TimestampSpread
+func (job FeedbackJob) timestampDelay() time.Duration {
+	if job.TimestampSpread <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(job.TimestampSpread)))
+}
+
+// feedbackMessage generates a feedback message of the specified length
+func feedbackMessage(length int) string {
+	words := []string{"the", "page", "crashed", "when", "I", "clicked", "save", "again", "it", "is", "slow"}
+	var builder strings.Builder
+	for builder.Len() < length {
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(words[rand.Intn(len(words))])
+	}
+	return builder.String()[:length]
+}
+
+// feedbackJobWithDefaults fills in the defaults for the parameters that were not specified
+func feedbackJobWithDefaults(job FeedbackJob) FeedbackJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if len(job.ItemTypes) == 0 {
+		job.ItemTypes = []string{"feedback"}
+	}
+	if job.NumUsers <= 0 {
+		job.NumUsers = 100
+	}
+	if job.MinMessageLength <= 0 {
+		job.MinMessageLength = 10
+	}
+	if job.MaxMessageLength <= 0 {
+		job.MaxMessageLength = 200
+	}
+	if job.MaxMessageLength < job.MinMessageLength {
+		job.MaxMessageLength = job.MinMessageLength
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("feedback", newFeedbackLoadTester, nil)
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFeedbackItems(t *testing.T) {
+	testCases := []struct {
+		name      string
+		params    string
+		itemTypes []string
+	}{
+		{name: "feedback", params: `{}`, itemTypes: []string{"feedback"}},
+		{name: "feedback with event", params: `{"sendEvent":true}`, itemTypes: []string{"event", "feedback"}},
+		{name: "user report", params: `{"itemTypes":["user_report"],"sendEvent":true}`, itemTypes: []string{"event", "user_report"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			loadTester := newFeedbackLoadTester("http://relay", json.RawMessage(testCase.params)).(*feedbackLoadTester)
+			items, envelopeEventId, err := loadTester.feedbackItems()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(testCase.itemTypes) {
+				t.Fatalf("expected %d items got %d", len(testCase.itemTypes), len(items))
+			}
+			var eventId string
+			for idx, item := range items {
+				if item.Type != testCase.itemTypes[idx] {
+					t.Errorf("expected item %s got %s", testCase.itemTypes[idx], item.Type)
+				}
+				switch item.Type {
+				case "event":
+					var event ErrorEvent
+					_ = json.Unmarshal(item.Payload, &event)
+					eventId = event.EventId
+				case "feedback":
+					var feedback Feedback
+					_ = json.Unmarshal(item.Payload, &feedback)
+					message := feedback.Contexts.Feedback.Message
+					if len(message) < 10 || len(message) > 200 {
+						t.Errorf("invalid feedback message '%s'", message)
+					}
+					if len(eventId) > 0 && feedback.Contexts.Feedback.AssociatedEventId != eventId {
+						t.Errorf("feedback not associated with the event")
+					}
+					if len(eventId) == 0 && feedback.EventId != envelopeEventId {
+						t.Errorf("expected the envelope to have the feedback event id")
+					}
+				case "user_report":
+					var report UserReport
+					_ = json.Unmarshal(item.Payload, &report)
+					if report.EventId != eventId || len(report.Comments) == 0 {
+						t.Errorf("invalid user report %+v", report)
+					}
+				}
+			}
+			if len(eventId) > 0 && envelopeEventId != eventId {
+				t.Errorf("expected the envelope to have the event id")
+			}
+		})
+	}
+}
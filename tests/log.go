@@ -0,0 +1,303 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// LogJob is how a structured logs load test is parameterized
+//
+// Every request sends a `log` item with a batch of logsPerEnvelope logs (the way SDKs buffer logs before
+// sending them). Projects are picked using the project distribution (see ProjectProfile), the timestamp
+// histogram of a project profile (when specified) is used to delay the timestamps of the logs.
+// example:
+// ```json
+// {
+//  "projectDistribution": [
+//    { "numProjects": 100, "relativeFreqWeight": 1.0 },
+//    {
+//      "numProjects": 10,
+//      "relativeFreqWeight": 10.0,
+//      "timestampHistogram": [
+//        { "weight": 10, "maxDelay": "1s"},
+//        { "weight": 1, "maxDelay": "30s"}
+//      ]
+//    }
+//  ],
+//  "severityWeights": {"debug": 10, "info": 60, "warn": 20, "error": 9, "fatal": 1},
+//  "numMessageTemplates": 200,
+//  "numAttributes": 5,
+//  "numAttributeValues": 50,
+//  "logsPerTrace": 20,
+//  "spanRatio": 0.5,
+//  "logsPerEnvelope": 100,
+//  "numReleases": 10,
+//  "numEnvironments": 2
+// }
+// ```
+type LogJob struct {
+	// ProjectDistribution the project profiles (default 1 project)
+	ProjectDistribution []ProjectProfile `json:"projectDistribution,omitempty" yaml:"projectDistribution,omitempty"`
+	// SeverityWeights the relative weights of the log levels (trace, debug, info, warn, error, fatal), (default info only)
+	SeverityWeights map[string]int64 `json:"severityWeights,omitempty" yaml:"severityWeights,omitempty"`
+	// NumMessageTemplates the number of distinct message templates (default 100)
+	NumMessageTemplates int `json:"numMessageTemplates,omitempty" yaml:"numMessageTemplates,omitempty"`
+	// NumAttributes the number of custom attributes set on each log
+	NumAttributes int `json:"numAttributes,omitempty" yaml:"numAttributes,omitempty"`
+	// NumAttributeValues the number of distinct values generated for each attribute (default 1)
+	NumAttributeValues int `json:"numAttributeValues,omitempty" yaml:"numAttributeValues,omitempty"`
+	// LogsPerTrace the number of consecutive logs of a batch that share the same trace id (default 1)
+	LogsPerTrace int `json:"logsPerTrace,omitempty" yaml:"logsPerTrace,omitempty"`
+	// SpanRatio the ratio of logs emitted inside a span, they are linked to the span with the sentry.trace.parent_span_id attribute
+	SpanRatio float64 `json:"spanRatio,omitempty" yaml:"spanRatio,omitempty"`
+	// LogsPerEnvelope the number of logs sent in an envelope (default 10)
+	LogsPerEnvelope int `json:"logsPerEnvelope,omitempty" yaml:"logsPerEnvelope,omitempty"`
+	// NumReleases the number of distinct releases set on the logs (0 sends no release)
+	NumReleases uint64 `json:"numReleases,omitempty" yaml:"numReleases,omitempty"`
+	// NumEnvironments the number of distinct environments set on the logs (default 1)
+	NumEnvironments int `json:"numEnvironments,omitempty" yaml:"numEnvironments,omitempty"`
+}
+
+// logSeverityNumbers maps the log levels to their OpenTelemetry severity numbers
+var logSeverityNumbers = map[string]int{
+	"trace": 1,
+	"debug": 5,
+	"info":  9,
+	"warn":  13,
+	"error": 17,
+	"fatal": 21,
+}
+
+// LogItems defines the JSON format of the payload of a log item
+type LogItems struct {
+	Items []Log `json:"items"`
+}
+
+// Log defines the JSON format of a log
+type Log struct {
+	Timestamp      float64                 `json:"timestamp"`
+	TraceId        string                  `json:"trace_id"`
+	Level          string                  `json:"level"`
+	SeverityNumber int                     `json:"severity_number,omitempty"`
+	Body           string                  `json:"body"`
+	Attributes     map[string]LogAttribute `json:"attributes,omitempty"`
+}
+
+// LogAttribute defines the JSON format of a log attribute
+type LogAttribute struct {
+	Value interface{} `json:"value"`
+	Type  string      `json:"type"`
+}
+
+// logLoadTester is used to drive a structured logs load test
+type logLoadTester struct {
+	PayloadCounter
+	url      string
+	logJob   LogJob
+	logsGen  func(timestamp time.Time) []Log
+	delayGen func(profileIdx int) time.Duration
+	profiles []utils.ProjectFreqProfile
+}
+
+func newLogLoadTester(url string, rawLog json.RawMessage) LoadTester {
+	var logParams LogJob
+	err := json.Unmarshal(rawLog, &logParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid log params received\nraw data\n%s", rawLog)
+	}
+	logParams = logJobWithDefaults(logParams)
+	log.Trace().Msgf("Log generation for:\n%+v", logParams)
+
+	profiles := make([]utils.ProjectFreqProfile, 0, len(logParams.ProjectDistribution))
+	for _, profile := range logParams.ProjectDistribution {
+		profiles = append(profiles, profile)
+	}
+	return &logLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadLogs),
+		url:            url,
+		logJob:         logParams,
+		logsGen:        LogsGenerator(logParams),
+		delayGen:       logDelayGenerator(logParams.ProjectDistribution),
+		profiles:       profiles,
+	}
+}
+
+func (llt *logLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		projectId, profileIdx, err := projectProvider.GetProjectIdV2(llt.profiles)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not get project id from project provider")
+			return err
+		}
+		projectKey := projectProvider.GetProjectInfo(projectId).ProjectKey
+
+		tgt.Method = "POST"
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", llt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		now := time.Now().UTC()
+		logs := llt.logsGen(now.Add(-llt.delayGen(profileIdx)))
+		body, err := json.Marshal(LogItems{Items: logs})
+		if err != nil {
+			return err
+		}
+		item := utils.EnvelopeItem{
+			Type: "log",
+			Headers: map[string]interface{}{
+				"item_count":   len(logs),
+				"content_type": "application/vnd.sentry.items.log+json",
+			},
+			Payload: body,
+		}
+		buff, err := utils.EnvelopeFromItems("", now, map[string]string{"public_key": projectKey}, item)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		llt.AddUnits(len(logs))
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (llt *logLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// TargetUnits returns the number of logs of a request
+func (llt *logLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	return countEnvelopeItems(tgt.Body, "log")
+}
+
+// logDelayGenerator returns the delay of the log timestamps for a project profile, profiles without a
+// timestamp histogram send logs with the current time
+func logDelayGenerator(projectProfiles []ProjectProfile) func(profileIdx int) time.Duration {
+	withHistograms := make([]ProjectProfile, 0, len(projectProfiles))
+	for _, profile := range projectProfiles {
+		if len(profile.TimestampHistogram) == 0 {
+			// timeSpreadGenerator needs a histogram, it will not be used for this profile
+			profile.TimestampHistogram = []TimestampHistogramBucket{{Weight: 1}}
+		}
+		withHistograms = append(withHistograms, profile)
+	}
+	timeSpread := timeSpreadGenerator(withHistograms)
+	return func(profileIdx int) time.Duration {
+		if len(projectProfiles[profileIdx].TimestampHistogram) == 0 {
+			return 0
+		}
+		return timeSpread(profileIdx)
+	}
+}
+
+// LogsGenerator returns a generator for batches of logs (LogsPerEnvelope logs, the last one at timestamp)
+func LogsGenerator(job LogJob) func(timestamp time.Time) []Log {
+	levels := make([]string, 0, len(job.SeverityWeights))
+	for level := range job.SeverityWeights {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	weights := make([]int64, 0, len(levels))
+	for _, level := range levels {
+		weights = append(weights, job.SeverityWeights[level])
+	}
+	relGen := ReleaseGenerator(job.NumReleases)
+	traceGen := TraceContextGenerator(nil)
+
+	return func(timestamp time.Time) []Log {
+		release := relGen()
+		environment := fmt.Sprintf("environment%d", rand.Intn(job.NumEnvironments))
+		retVal := make([]Log, 0, job.LogsPerEnvelope)
+		var trace TraceContext
+		for idx := 0; idx < job.LogsPerEnvelope; idx++ {
+			if idx%job.LogsPerTrace == 0 {
+				trace = traceGen()
+			}
+			level, err := utils.RandomChoice(levels, weights)
+			if err != nil {
+				level = "info"
+			}
+			templateIdx := rand.Intn(job.NumMessageTemplates)
+			template := fmt.Sprintf("operation%d finished for user %%s in %%d ms", templateIdx)
+			user := fmt.Sprintf("user%d", rand.Intn(1000))
+			duration := rand.Intn(1000)
+
+			attributes := map[string]LogAttribute{
+				"sentry.environment":         {Value: environment, Type: "string"},
+				"sentry.message.template":    {Value: template, Type: "string"},
+				"sentry.message.parameter.0": {Value: user, Type: "string"},
+				"sentry.message.parameter.1": {Value: duration, Type: "integer"},
+				"sentry.sdk.name":            {Value: "sentry.go", Type: "string"},
+			}
+			if len(release) > 0 {
+				attributes["sentry.release"] = LogAttribute{Value: release, Type: "string"}
+			}
+			if rand.Float64() < job.SpanRatio {
+				attributes["sentry.trace.parent_span_id"] = LogAttribute{Value: trace.SpanId, Type: "string"}
+			}
+			for attrIdx := 0; attrIdx < job.NumAttributes; attrIdx++ {
+				attributes[fmt.Sprintf("attr%d", attrIdx)] = LogAttribute{
+					Value: fmt.Sprintf("value%d", rand.Intn(job.NumAttributeValues)),
+					Type:  "string",
+				}
+			}
+			// logs of a batch are a few milliseconds apart
+			logTime := timestamp.Add(-time.Duration(job.LogsPerEnvelope-idx) * time.Millisecond)
+			retVal = append(retVal, Log{
+				Timestamp:      toUnixTimestamp(logTime),
+				TraceId:        trace.TraceId,
+				Level:          level,
+				SeverityNumber: logSeverityNumbers[level],
+				Body:           fmt.Sprintf(template, user, duration),
+				Attributes:     attributes,
+			})
+		}
+		return retVal
+	}
+}
+
+// logJobWithDefaults fills in the defaults for the parameters that were not specified
+func logJobWithDefaults(job LogJob) LogJob {
+	if len(job.ProjectDistribution) == 0 {
+		job.ProjectDistribution = []ProjectProfile{{NumProjects: 1, RelativeFreqWeight: 1}}
+	}
+	if len(job.SeverityWeights) == 0 {
+		job.SeverityWeights = map[string]int64{"info": 1}
+	}
+	if job.NumMessageTemplates <= 0 {
+		job.NumMessageTemplates = 100
+	}
+	if job.NumAttributeValues <= 0 {
+		job.NumAttributeValues = 1
+	}
+	if job.LogsPerTrace <= 0 {
+		job.LogsPerTrace = 1
+	}
+	if job.LogsPerEnvelope <= 0 {
+		job.LogsPerEnvelope = 10
+	}
+	if job.NumEnvironments <= 0 {
+		job.NumEnvironments = 1
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("log", newLogLoadTester, nil)
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestLogsGenerator(t *testing.T) {
+	job := logJobWithDefaults(LogJob{
+		SeverityWeights:     map[string]int64{"error": 1, "warn": 1, "debug": 0},
+		NumMessageTemplates: 3,
+		NumAttributes:       2,
+		LogsPerTrace:        4,
+		LogsPerEnvelope:     8,
+	})
+	now := time.Now()
+	logs := LogsGenerator(job)(now)
+	if len(logs) != 8 {
+		t.Fatalf("expected 8 logs got %d", len(logs))
+	}
+	for idx, logEntry := range logs {
+		if logEntry.Level != "error" && logEntry.Level != "warn" {
+			t.Errorf("unexpected level %s", logEntry.Level)
+		}
+		if logEntry.SeverityNumber != logSeverityNumbers[logEntry.Level] {
+			t.Errorf("invalid severity number %d for level %s", logEntry.SeverityNumber, logEntry.Level)
+		}
+		template := logEntry.Attributes["sentry.message.template"].Value
+		body := fmt.Sprintf(template.(string), logEntry.Attributes["sentry.message.parameter.0"].Value,
+			logEntry.Attributes["sentry.message.parameter.1"].Value)
+		if body != logEntry.Body {
+			t.Errorf("body %s does not match template %s", logEntry.Body, template)
+		}
+		if _, ok := logEntry.Attributes["attr1"]; !ok {
+			t.Errorf("custom attributes not set %v", logEntry.Attributes)
+		}
+		if _, ok := logEntry.Attributes["sentry.trace.parent_span_id"]; ok {
+			t.Errorf("logs should not be linked to spans")
+		}
+		if logEntry.TraceId != logs[idx-idx%4].TraceId {
+			t.Errorf("log %d should have the trace of log %d", idx, idx-idx%4)
+		}
+		if time.Unix(0, int64(logEntry.Timestamp*1e9)).After(now) {
+			t.Errorf("log %d is in the future", idx)
+		}
+	}
+	if logs[0].TraceId == logs[4].TraceId {
+		t.Errorf("expected a new trace every 4 logs")
+	}
+}
+
+func TestLogDelayGenerator(t *testing.T) {
+	delayGen := logDelayGenerator([]ProjectProfile{
+		{NumProjects: 1, RelativeFreqWeight: 1},
+		{NumProjects: 1, RelativeFreqWeight: 1, TimestampHistogram: []TimestampHistogramBucket{
+			{Weight: 1, MaxDelay: utils.StringDuration(time.Minute)},
+		}},
+	})
+	for idx := 0; idx < 50; idx++ {
+		if delay := delayGen(0); delay != 0 {
+			t.Errorf("expected no delay for a profile without histogram got %v", delay)
+		}
+		if delay := delayGen(1); delay < 0 || delay >= time.Minute {
+			t.Errorf("delay %v outside of the histogram", delay)
+		}
+	}
+}
@@ -28,6 +28,57 @@ type TestParams struct {
 	Per            time.Duration // the unit of duration in which to send NumMessages
 	Params         json.RawMessage
 	Labels         [][]string // key value pairs (can be used to annotate the attack result)
+	TraceParent    string     // W3C traceparent of the master run (not serialized, passed as a http header)
+	RunId          string     // id of the master run (not serialized, passed as a http header)
+}
+
+// Attributes returns the test parameters (and labels) as a dictionary, to be used for annotating
+// telemetry data (e.g. OpenTelemetry span attributes)
+func (t TestParams) Attributes() map[string]any {
+	retVal := map[string]any{
+		"test.name":            t.Name,
+		"test.description":     t.Description,
+		"test.type":            t.TestType,
+		"test.attack_duration": t.AttackDuration.String(),
+		"test.num_messages":    t.NumMessages,
+		"test.per":             t.Per.String(),
+	}
+	for key, value := range t.LabelMap() {
+		retVal["label."+key] = value
+	}
+	return retVal
+}
+
+// LabelMap returns the labels as a dictionary (labels without a value are mapped to an empty string)
+func (t TestParams) LabelMap() map[string]string {
+	retVal := make(map[string]string, len(t.Labels))
+	for _, label := range t.Labels {
+		if len(label) == 0 {
+			continue
+		}
+		value := ""
+		if len(label) > 1 {
+			value = label[1]
+		}
+		retVal[label[0]] = value
+	}
+	return retVal
+}
+
+// LabelTags returns the labels as statsd tags (i.e. "key:value"), in the order they were specified
+func (t TestParams) LabelTags() []string {
+	retVal := make([]string, 0, len(t.Labels))
+	for _, label := range t.Labels {
+		if len(label) == 0 {
+			continue
+		}
+		if len(label) == 1 {
+			retVal = append(retVal, label[0])
+		} else {
+			retVal = append(retVal, fmt.Sprintf("%s:%s", label[0], label[1]))
+		}
+	}
+	return retVal
 }
 
 // LoadTesterBuilder is a function that when given a target URL and a read channel of
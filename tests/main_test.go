@@ -41,3 +41,33 @@ func TestUnmarshalRequest(t *testing.T) {
 		t.Errorf("error deserializing testParams:\n expected:%+v\n  got:%+v", expectedValue, v)
 	}
 }
+
+func TestTestParamsAttributes(t *testing.T) {
+	params := TestParams{
+		Name:           "name",
+		TestType:       "session",
+		AttackDuration: time.Minute,
+		NumMessages:    10,
+		Per:            time.Second,
+		Labels:         [][]string{{"l1", "v1"}, {"l2"}, {}},
+	}
+	attributes := params.Attributes()
+
+	expected := map[string]any{
+		"test.name": "name", "test.type": "session", "test.attack_duration": "1m0s",
+		"test.num_messages": 10, "test.per": "1s", "label.l1": "v1", "label.l2": "",
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("attribute %s expected %v got %v", key, value, attributes[key])
+		}
+	}
+}
+
+func TestTestParamsLabelTags(t *testing.T) {
+	params := TestParams{Labels: [][]string{{"l1", "v1"}, {"l2"}, {}, {"l3", "v3"}}}
+	expected := []string{"l1:v1", "l2", "l3:v3"}
+	if actual := params.LabelTags(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected tags %v got %v", expected, actual)
+	}
+}
@@ -1,10 +1,14 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -28,7 +32,8 @@ import (
 //   "minMetricsInSets": 4,
 //   "maxMetricsInSets": 30,
 //   "numTagsPerMetric": 5,
-//   "numValuesPerTag": 3
+//   "numValuesPerTag": 3,
+//   "format": "statsd"
 // }
 // ```
 type MetricBucketJob struct {
@@ -58,8 +63,17 @@ type MetricBucketJob struct {
 	NumTagsPerMetric int `json:"numTagsPerMetric"`
 	// NumValuesPerTag how many distinct values are generated for each tag
 	NumValuesPerTag int `json:"numValuesPerTag"`
+	// Format the format of the envelope item, metric_buckets sends pre-aggregated buckets, statsd sends the same
+	// buckets as statsd lines (the way SDKs do) that are aggregated by Relay (default metric_buckets)
+	Format string `json:"format,omitempty"`
 }
 
+// Formats of the metrics sent by a metricBucket load test
+const (
+	MetricFormatBuckets = "metric_buckets"
+	MetricFormatStatsd  = "statsd"
+)
+
 type BucketType string
 
 const (
@@ -90,6 +104,7 @@ type GaugeValue struct {
 }
 
 type metricBucketLoadTester struct {
+	PayloadCounter
 	url                string
 	metricBucketParams MetricBucketJob
 }
@@ -162,9 +177,17 @@ func newMetricsBucketLoadTester(url string, rawTransaction json.RawMessage) Load
 		log.Error().Err(err).Msgf("invalid metric bucket params received\nraw data\n%s",
 			rawTransaction)
 	}
+	if metricBucketParams.Format == "" {
+		metricBucketParams.Format = MetricFormatBuckets
+	}
+	if metricBucketParams.Format != MetricFormatBuckets && metricBucketParams.Format != MetricFormatStatsd {
+		log.Error().Msgf("invalid metric bucket format %s, using %s", metricBucketParams.Format, MetricFormatBuckets)
+		metricBucketParams.Format = MetricFormatBuckets
+	}
 	log.Trace().Msgf("MetricBucket generation for:\n%+v", metricBucketParams)
 
 	return &metricBucketLoadTester{
+		PayloadCounter:     NewPayloadCounter(PayloadBuckets),
 		url:                url,
 		metricBucketParams: metricBucketParams,
 	}
@@ -277,9 +300,15 @@ func (mlt *metricBucketLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 			buckets = append(buckets, bucket)
 		}
 
-		body, err := json.Marshal(buckets)
-		if err != nil {
-			return err
+		var body []byte
+		var err error
+		if mlt.metricBucketParams.Format == MetricFormatStatsd {
+			body = StatsdBody(buckets)
+		} else {
+			body, err = json.Marshal(buckets)
+			if err != nil {
+				return err
+			}
 		}
 
 		now := time.Now().UTC()
@@ -290,21 +319,103 @@ func (mlt *metricBucketLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 
 		EventId := EventIdGenerator()()
 
-		buff, err := utils.EnvelopeFromBody(EventId, now, "metric_buckets", extraEnvelopeHeaders, body)
+		buff, err := utils.EnvelopeFromBody(EventId, now, mlt.metricBucketParams.Format, extraEnvelopeHeaders, body)
 		if err != nil {
 			return err
 		}
 
 		tgt.Body = buff.Bytes()
+		mlt.AddUnits(len(buckets))
 		log.Trace().Msgf("Attacking project:%s", projectId)
 		return nil
 	}, 0
 }
 
+// StatsdBody converts the buckets into the payload of a statsd item, one line per bucket
+func StatsdBody(buckets []MetricBucket) []byte {
+	var buff bytes.Buffer
+	for _, bucket := range buckets {
+		buff.WriteString(StatsdLine(bucket))
+		buff.WriteByte('\n')
+	}
+	return buff.Bytes()
+}
+
+// StatsdLine formats a bucket as a statsd line: `name@unit:value|type|#tags|T<timestamp>`
+//
+// Distributions and sets have a value for each element, gauges are sent as last:min:max:sum:count
+func StatsdLine(bucket MetricBucket) string {
+	// the bucket name is a MRI (type:namespace/name@unit), the type is sent separately and the namespace is
+	// kept (statsd names without a namespace are ingested in the custom namespace)
+	name := bucket.Name
+	unit := "none"
+	if idx := strings.IndexByte(name, ':'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if idx := strings.IndexByte(name, '@'); idx >= 0 {
+		unit = name[idx+1:]
+		name = name[:idx]
+	}
+
+	var values []string
+	switch value := bucket.Value.(type) {
+	case []float64:
+		for _, v := range value {
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	case []int32:
+		for _, v := range value {
+			values = append(values, strconv.FormatInt(int64(v), 10))
+		}
+	case GaugeValue:
+		for _, v := range []float64{value.Last, value.Min, value.Max, value.Sum} {
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		values = append(values, strconv.FormatUint(value.Count, 10))
+	case float64:
+		values = append(values, strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		values = append(values, fmt.Sprint(value))
+	}
+
+	tagNames := make([]string, 0, len(bucket.Tags))
+	for tagName := range bucket.Tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+	tags := make([]string, 0, len(tagNames))
+	for _, tagName := range tagNames {
+		tags = append(tags, fmt.Sprintf("%s:%s", tagName, bucket.Tags[tagName]))
+	}
+
+	line := fmt.Sprintf("%s@%s:%s|%s", name, unit, strings.Join(values, ":"), bucket.Type)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return fmt.Sprintf("%s|T%d", line, bucket.Timestamp)
+}
+
 func (mlt *metricBucketLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
 	return // nothing to do
 }
 
+// TargetUnits returns the number of buckets of a request
+func (mlt *metricBucketLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	var retVal uint64
+	for _, item := range parseEnvelope(tgt.Body) {
+		switch item.header.Type {
+		case MetricFormatStatsd:
+			retVal += uint64(bytes.Count(item.payload, []byte{'\n'}))
+		case MetricFormatBuckets:
+			var buckets []json.RawMessage
+			if json.Unmarshal(item.payload, &buckets) == nil {
+				retVal += uint64(len(buckets))
+			}
+		}
+	}
+	return retVal
+}
+
 func init() {
-	RegisterTestType("metricBucket", newMetricsBucketLoadTester, nil)
+	RegisterSentryTestType("metricBucket", newMetricsBucketLoadTester, nil)
 }
@@ -84,3 +84,39 @@ func TestRandomTags(t *testing.T) {
 		}
 	}
 }
+
+func TestStatsdLine(t *testing.T) {
+	testCases := []struct {
+		bucket   MetricBucket
+		expected string
+	}{
+		{
+			bucket: MetricBucket{Type: Counter, Name: "c:transactions/metric1@none", Value: 33.0, Timestamp: 1000,
+				Tags: map[string]string{"t2": "v1", "t1": "v3"}},
+			expected: "transactions/metric1@none:33|c|#t1:v3,t2:v1|T1000",
+		},
+		{
+			bucket:   MetricBucket{Type: Distribution, Name: "d:transactions/metric2@none", Value: []float64{1.5, 2}, Timestamp: 1000},
+			expected: "transactions/metric2@none:1.5:2|d|T1000",
+		},
+		{
+			bucket:   MetricBucket{Type: Set, Name: "s:transactions/metric3@none", Value: []int32{1, 4, 4}, Timestamp: 1000},
+			expected: "transactions/metric3@none:1:4:4|s|T1000",
+		},
+		{
+			bucket: MetricBucket{Type: Gauge, Name: "g:transactions/metric4@none", Timestamp: 1000,
+				Value: GaugeValue{Max: 10, Min: 1, Sum: 20, Last: 5, Count: 4}},
+			expected: "transactions/metric4@none:5:1:10:20:4|g|T1000",
+		},
+		{
+			bucket:   MetricBucket{Type: Counter, Name: "metric5", Value: 1.0, Timestamp: 1000},
+			expected: "metric5@none:1|c|T1000",
+		},
+	}
+	for _, testCase := range testCases {
+		result := StatsdLine(testCase.bucket)
+		if result != testCase.expected {
+			t.Errorf("expected %s got %s", testCase.expected, result)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// MixedEnvelopeJob is how a mixed envelope load test is parameterized
+//
+// Envelopes are built (the way SDKs bundle items) from recipes picked by their relative weights, recipes are
+// added to an envelope until it has between minItemsPerEnvelope and maxItemsPerEnvelope items. An envelope
+// contains at most one event (event or transaction), the other items of the envelope refer to it.
+// The supported item types are: event, transaction, profile (needs a transaction in the same recipe),
+// attachment (needs an event or a transaction in the same recipe), session and client_report.
+// The items are generated with the parameters of the corresponding test types (the defaults of the
+// test types are used for the parameters that are not specified), sessions are generated with a fixed
+// distribution of releases, environments and statuses.
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "recipes": [
+//    {"items": ["transaction", "profile"], "weight": 5},
+//    {"items": ["event", "attachment", "attachment"], "weight": 3},
+//    {"items": ["session", "client_report"], "weight": 2}
+//  ],
+//  "minItemsPerEnvelope": 2,
+//  "maxItemsPerEnvelope": 6,
+//  "error": {"numIssues": 100},
+//  "profile": {"maxSamples": 50, "maxSpans": 10},
+//  "attachmentSizes": [{"minSize": 1000, "maxSize": 10000}],
+//  "clientReport": {"reasons": ["sample_rate"]}
+// }
+// ```
+type MixedEnvelopeJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// Recipes the groups of items put together in envelopes (default transaction+profile, event+attachment and session+client_report)
+	Recipes []EnvelopeRecipe `json:"recipes,omitempty" yaml:"recipes,omitempty"`
+	// MinItemsPerEnvelope the minimum number of items in an envelope (default 1)
+	MinItemsPerEnvelope int `json:"minItemsPerEnvelope,omitempty" yaml:"minItemsPerEnvelope,omitempty"`
+	// MaxItemsPerEnvelope the maximum number of items in an envelope (default 10), it is raised to the size of the largest recipe
+	MaxItemsPerEnvelope int `json:"maxItemsPerEnvelope,omitempty" yaml:"maxItemsPerEnvelope,omitempty"`
+	// Error the parameters of the event items, see ErrorJob
+	Error ErrorJob `json:"error,omitempty" yaml:"error,omitempty"`
+	// Profile the parameters of the transaction and profile items, see ProfileJob
+	Profile ProfileJob `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// AttachmentSizes the size distribution of the attachment items, see AttachmentJob
+	AttachmentSizes []AttachmentSize `json:"attachmentSizes,omitempty" yaml:"attachmentSizes,omitempty"`
+	// ClientReport the parameters of the client_report items, see ClientReportJob
+	ClientReport ClientReportJob `json:"clientReport,omitempty" yaml:"clientReport,omitempty"`
+}
+
+// EnvelopeRecipe is a group of items sent together in an envelope
+// @doc({"scope":"job"})
+//
+type EnvelopeRecipe struct {
+	// Items the types of the items of the recipe
+	Items []string `json:"items" yaml:"items"`
+	// Weight the relative weight of the recipe
+	Weight int64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// mixedItemTypes are the item types that can be used in recipes (true for event items)
+var mixedItemTypes = map[string]bool{
+	"event":         true,
+	"transaction":   true,
+	"profile":       false,
+	"attachment":    false,
+	"session":       false,
+	"client_report": false,
+}
+
+// mixedEnvelopeLoadTester is used to drive a mixed envelope load test
+type mixedEnvelopeLoadTester struct {
+	PayloadCounter
+	url                  string
+	mixedEnvelopeJob     MixedEnvelopeJob
+	recipeGen            func() EnvelopeRecipe
+	errorGenerator       func() ErrorEvent
+	transactionGenerator func(time.Duration) Transaction
+	profileGenerator     func(*Transaction) Profile
+	attachmentGen        func() []byte
+	sessionJob           SessionJob
+}
+
+func newMixedEnvelopeLoadTester(url string, rawMixedEnvelope json.RawMessage) LoadTester {
+	var mixedEnvelopeParams MixedEnvelopeJob
+	err := json.Unmarshal(rawMixedEnvelope, &mixedEnvelopeParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid mixedEnvelope params received\nraw data\n%s", rawMixedEnvelope)
+	}
+	mixedEnvelopeParams = mixedEnvelopeJobWithDefaults(mixedEnvelopeParams)
+	log.Trace().Msgf("MixedEnvelope generation for:\n%+v", mixedEnvelopeParams)
+
+	return &mixedEnvelopeLoadTester{
+		PayloadCounter:       NewPayloadCounter(PayloadItems),
+		url:                  url,
+		mixedEnvelopeJob:     mixedEnvelopeParams,
+		recipeGen:            RecipeGenerator(mixedEnvelopeParams.Recipes),
+		errorGenerator:       ErrorGenerator(mixedEnvelopeParams.Error),
+		transactionGenerator: TransactionGenerator(mixedEnvelopeParams.Profile.TransactionJobCommon),
+		profileGenerator:     ProfileGenerator(mixedEnvelopeParams.Profile),
+		attachmentGen:        AttachmentGenerator(mixedEnvelopeParams.AttachmentSizes),
+		sessionJob: SessionJob{
+			StartedRange:    time.Minute,
+			DurationRange:   time.Minute,
+			NumReleases:     10,
+			NumEnvironments: 2,
+			NumUsers:        1000,
+			OkWeight:        8,
+			ExitedWeight:    9,
+			ErroredWeight:   1,
+			CrashedWeight:   1,
+			AbnormalWeight:  1,
+		},
+	}
+}
+
+func (melt *mixedEnvelopeLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = melt.mixedEnvelopeJob.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", melt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		extraEnvelopeHeaders := map[string]string{
+			"public_key": projectKey,
+		}
+		eventId, items, err := melt.envelopeItems(extraEnvelopeHeaders)
+		if err != nil {
+			return err
+		}
+		buff, err := utils.EnvelopeFromItems(eventId, time.Now().UTC(), extraEnvelopeHeaders, items...)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		melt.AddUnits(len(items))
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (melt *mixedEnvelopeLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// TargetUnits returns the number of items of a request
+func (melt *mixedEnvelopeLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	return countEnvelopeItems(tgt.Body, "")
+}
+
+// maxRecipeAttempts limits the number of recipes that are rejected when building an envelope
+const maxRecipeAttempts = 10
+
+// envelopeItems generates the items of an envelope and returns them together with the id of the event of the
+// envelope (if the envelope has an event), the trace_id envelope header is set for envelopes with a transaction
+func (melt *mixedEnvelopeLoadTester) envelopeItems(envelopeHeaders map[string]string) (string, []utils.EnvelopeItem, error) {
+	job := melt.mixedEnvelopeJob
+	numItems := job.MinItemsPerEnvelope + rand.Intn(job.MaxItemsPerEnvelope-job.MinItemsPerEnvelope+1)
+	var eventId string
+	items := make([]utils.EnvelopeItem, 0, numItems)
+	rejected := 0
+	for len(items) < numItems && rejected < maxRecipeAttempts {
+		recipe := melt.recipeGen()
+		if len(items) > 0 && len(items)+len(recipe.Items) > job.MaxItemsPerEnvelope {
+			rejected++ // too large for what is left
+			continue
+		}
+		if len(eventId) > 0 && recipeHasEvent(recipe) {
+			rejected++ // only one event per envelope
+			continue
+		}
+		recipeEventId, recipeItems, err := melt.recipeItems(recipe, envelopeHeaders, len(items))
+		if err != nil {
+			return "", nil, err
+		}
+		if len(recipeEventId) > 0 {
+			eventId = recipeEventId
+		}
+		items = append(items, recipeItems...)
+	}
+	return eventId, items, nil
+}
+
+// recipeItems generates the items of a recipe, the event item (if any) is the first item
+// (firstItemIdx is the index of the first item of the recipe in the envelope, it keeps the attachment
+// filenames unique within the envelope)
+func (melt *mixedEnvelopeLoadTester) recipeItems(recipe EnvelopeRecipe, envelopeHeaders map[string]string, firstItemIdx int) (string, []utils.EnvelopeItem, error) {
+	var eventId string
+	var eventType string
+	var event interface{}
+	var transaction *Transaction
+	for _, itemType := range recipe.Items {
+		switch itemType {
+		case "event":
+			errorEvent := melt.errorGenerator()
+			eventId, eventType, event = errorEvent.EventId, itemType, errorEvent
+		case "transaction":
+			generated := melt.transactionGenerator(0)
+			transaction = &generated
+			eventId, eventType, event = transaction.EventId, itemType, transaction
+			envelopeHeaders["trace_id"] = transaction.Contexts.Trace.TraceId
+		}
+	}
+
+	items := make([]utils.EnvelopeItem, 0, len(recipe.Items))
+	for idx, itemType := range recipe.Items {
+		var headers map[string]interface{}
+		var payload []byte
+		var err error
+		switch itemType {
+		case "profile":
+			// sets the profile context of the transaction (serialized below)
+			payload, err = json.Marshal(melt.profileGenerator(transaction))
+		case "attachment":
+			headers = map[string]interface{}{
+				"filename":        fmt.Sprintf("attachment%d.bin", firstItemIdx+idx),
+				"content_type":    "application/octet-stream",
+				"attachment_type": "event.attachment",
+			}
+			payload = melt.attachmentGen()
+		case "session":
+			payload, err = json.Marshal(SessionGenerator(melt.sessionJob))
+		case "client_report":
+			payload, err = json.Marshal(ClientReportGenerator(melt.mixedEnvelopeJob.ClientReport))
+		default:
+			continue // the event item is added first
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		items = append(items, utils.EnvelopeItem{Type: itemType, Headers: headers, Payload: payload})
+	}
+
+	if event != nil {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return "", nil, err
+		}
+		items = append([]utils.EnvelopeItem{{Type: eventType, Payload: body}}, items...)
+	}
+	return eventId, items, nil
+}
+
+// RecipeGenerator returns a function that picks recipes according to their relative weights
+func RecipeGenerator(recipes []EnvelopeRecipe) func() EnvelopeRecipe {
+	cumulativeWeights := make([]int64, len(recipes))
+	var totalWeight int64
+	for idx, recipe := range recipes {
+		weight := recipe.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		totalWeight += weight
+		cumulativeWeights[idx] = totalWeight
+	}
+	return func() EnvelopeRecipe {
+		pick := rand.Int63n(totalWeight)
+		recipeIdx := sort.Search(len(cumulativeWeights), func(idx int) bool {
+			return cumulativeWeights[idx] > pick
+		})
+		return recipes[recipeIdx]
+	}
+}
+
+// recipeHasEvent returns true if the recipe contains an event item (event or transaction)
+func recipeHasEvent(recipe EnvelopeRecipe) bool {
+	for _, itemType := range recipe.Items {
+		if mixedItemTypes[itemType] {
+			return true
+		}
+	}
+	return false
+}
+
+// validRecipe checks that the recipe can be turned into valid envelope items
+func validRecipe(recipe EnvelopeRecipe) error {
+	if len(recipe.Items) == 0 {
+		return fmt.Errorf("empty recipe")
+	}
+	numEvents := 0
+	hasTransaction := false
+	hasProfile := false
+	hasAttachment := false
+	for _, itemType := range recipe.Items {
+		isEvent, ok := mixedItemTypes[itemType]
+		if !ok {
+			return fmt.Errorf("unknown item type %s", itemType)
+		}
+		if isEvent {
+			numEvents++
+		}
+		hasTransaction = hasTransaction || itemType == "transaction"
+		hasProfile = hasProfile || itemType == "profile"
+		hasAttachment = hasAttachment || itemType == "attachment"
+	}
+	if numEvents > 1 {
+		return fmt.Errorf("more than one event in recipe %v", recipe.Items)
+	}
+	if hasProfile && !hasTransaction {
+		return fmt.Errorf("profile without a transaction in recipe %v", recipe.Items)
+	}
+	if hasAttachment && numEvents == 0 {
+		// attachments without an event are dropped by Relay
+		return fmt.Errorf("attachment without an event in recipe %v", recipe.Items)
+	}
+	return nil
+}
+
+// mixedEnvelopeJobWithDefaults fills in the defaults for the parameters that were not specified
+func mixedEnvelopeJobWithDefaults(job MixedEnvelopeJob) MixedEnvelopeJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	recipes := make([]EnvelopeRecipe, 0, len(job.Recipes))
+	for _, recipe := range job.Recipes {
+		if err := validRecipe(recipe); err != nil {
+			log.Error().Err(err).Msg("invalid envelope recipe, ignoring it")
+			continue
+		}
+		recipes = append(recipes, recipe)
+	}
+	if len(recipes) == 0 {
+		recipes = []EnvelopeRecipe{
+			{Items: []string{"transaction", "profile"}},
+			{Items: []string{"event", "attachment"}},
+			{Items: []string{"session", "client_report"}},
+		}
+	}
+	job.Recipes = recipes
+	if job.MinItemsPerEnvelope <= 0 {
+		job.MinItemsPerEnvelope = 1
+	}
+	if job.MaxItemsPerEnvelope <= 0 {
+		job.MaxItemsPerEnvelope = 10
+	}
+	for _, recipe := range job.Recipes {
+		if len(recipe.Items) > job.MaxItemsPerEnvelope {
+			job.MaxItemsPerEnvelope = len(recipe.Items)
+		}
+	}
+	if job.MaxItemsPerEnvelope < job.MinItemsPerEnvelope {
+		job.MaxItemsPerEnvelope = job.MinItemsPerEnvelope
+	}
+	job.Profile = profileJobWithDefaults(job.Profile)
+	job.ClientReport = clientReportJobWithDefaults(job.ClientReport)
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("mixedEnvelope", newMixedEnvelopeLoadTester, nil)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidRecipe(t *testing.T) {
+	testCases := []struct {
+		items []string
+		valid bool
+	}{
+		{[]string{"transaction", "profile"}, true},
+		{[]string{"event", "attachment", "attachment"}, true},
+		{[]string{"session", "client_report"}, true},
+		{[]string{}, false},
+		{[]string{"profile"}, false},
+		{[]string{"attachment"}, false},
+		{[]string{"session", "attachment"}, false},
+		{[]string{"transaction", "attachment"}, true},
+		{[]string{"event", "transaction"}, false},
+		{[]string{"session", "unknown"}, false},
+	}
+	for _, testCase := range testCases {
+		err := validRecipe(EnvelopeRecipe{Items: testCase.items})
+		if (err == nil) != testCase.valid {
+			t.Errorf("recipe %v expected valid=%v got error %v", testCase.items, testCase.valid, err)
+		}
+	}
+}
+
+func TestMixedEnvelopeItems(t *testing.T) {
+	loadTester := newMixedEnvelopeLoadTester("http://relay", json.RawMessage(`{
+		"recipes": [
+			{"items": ["transaction", "profile"], "weight": 1},
+			{"items": ["event", "attachment", "attachment"], "weight": 1},
+			{"items": ["session"], "weight": 1},
+			{"items": ["profile"], "weight": 100}
+		],
+		"minItemsPerEnvelope": 3,
+		"maxItemsPerEnvelope": 5
+	}`)).(*mixedEnvelopeLoadTester)
+
+	if len(loadTester.mixedEnvelopeJob.Recipes) != 3 {
+		t.Fatalf("the invalid recipe should have been ignored")
+	}
+	for idx := 0; idx < 100; idx++ {
+		headers := make(map[string]string)
+		eventId, items, err := loadTester.envelopeItems(headers)
+		if err != nil {
+			t.Fatalf("could not generate items: %v", err)
+		}
+		if len(items) > 5 {
+			t.Errorf("expected at most 5 items got %d", len(items))
+		}
+		numEvents := 0
+		var transaction Transaction
+		var profile Profile
+		filenames := make(map[interface{}]bool)
+		for _, item := range items {
+			switch item.Type {
+			case "attachment":
+				if filenames[item.Headers["filename"]] {
+					t.Errorf("duplicate attachment filename %v", item.Headers["filename"])
+				}
+				filenames[item.Headers["filename"]] = true
+			case "event":
+				numEvents++
+			case "transaction":
+				numEvents++
+				if err = json.Unmarshal(item.Payload, &transaction); err != nil {
+					t.Fatalf("invalid transaction: %v", err)
+				}
+			case "profile":
+				if err = json.Unmarshal(item.Payload, &profile); err != nil {
+					t.Fatalf("invalid profile: %v", err)
+				}
+			}
+		}
+		if numEvents > 1 {
+			t.Errorf("expected at most one event got %d", numEvents)
+		}
+		if numEvents == 0 && len(eventId) > 0 {
+			t.Errorf("unexpected event id for an envelope without events")
+		}
+		if len(transaction.EventId) > 0 {
+			if eventId != transaction.EventId || headers["trace_id"] != transaction.Contexts.Trace.TraceId {
+				t.Errorf("envelope headers do not match the transaction")
+			}
+			if transaction.Contexts.Profile == nil || transaction.Contexts.Profile.ProfileId != profile.EventId {
+				t.Errorf("transaction not linked to its profile")
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// OtlpTracesJob is how an OTLP traces load test is parameterized
+//
+// Every request posts an OTLP/HTTP ExportTraceServiceRequest with tracesPerRequest traces (a server span and
+// a tree of child spans) to the OTLP traces endpoint of a project, authenticated with the project key.
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "encoding": "protobuf",
+//  "tracesPerRequest": 5,
+//  "minSpans": 5,
+//  "maxSpans": 50,
+//  "traceDurationMin": "100ms",
+//  "traceDurationMax": "5s",
+//  "operations": ["http.server", "db", "cache.get"],
+//  "numServices": 10,
+//  "resourceAttributes": {"deployment.environment": "production", "telemetry.sdk.language": "go"}
+// }
+// ```
+type OtlpTracesJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// Encoding the OTLP/HTTP encoding of the requests, protobuf or json (default protobuf)
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	// TracesPerRequest the number of traces sent in a request (default 1)
+	TracesPerRequest int `json:"tracesPerRequest,omitempty" yaml:"tracesPerRequest,omitempty"`
+	// MinSpans the minimum number of child spans in a trace
+	MinSpans uint64 `json:"minSpans,omitempty" yaml:"minSpans,omitempty"`
+	// MaxSpans the maximum number of child spans in a trace (default 10)
+	MaxSpans uint64 `json:"maxSpans,omitempty" yaml:"maxSpans,omitempty"`
+	// TraceDurationMin the minimum duration of a trace
+	TraceDurationMin utils.StringDuration `json:"traceDurationMin,omitempty" yaml:"traceDurationMin,omitempty"`
+	// TraceDurationMax the maximum duration of a trace (default 1s)
+	TraceDurationMax utils.StringDuration `json:"traceDurationMax,omitempty" yaml:"traceDurationMax,omitempty"`
+	// Operations specifies the operations of the spans (default http.server and db)
+	Operations []string `json:"operations,omitempty" yaml:"operations,omitempty"`
+	// NumServices the number of distinct service.name resource attributes (default 1)
+	NumServices int `json:"numServices,omitempty" yaml:"numServices,omitempty"`
+	// ResourceAttributes extra attributes set on the resource of the spans
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty" yaml:"resourceAttributes,omitempty"`
+}
+
+// OTLP/HTTP encodings
+const (
+	OtlpEncodingProtobuf = "protobuf"
+	OtlpEncodingJson     = "json"
+)
+
+// otlpTracesLoadTester is used to drive an OTLP traces load test
+type otlpTracesLoadTester struct {
+	PayloadCounter
+	url           string
+	otlpTracesJob OtlpTracesJob
+	tracesGen     func() []utils.OtlpResourceSpans
+}
+
+func newOtlpTracesLoadTester(url string, rawOtlpTraces json.RawMessage) LoadTester {
+	var otlpTracesParams OtlpTracesJob
+	err := json.Unmarshal(rawOtlpTraces, &otlpTracesParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid otlpTraces params received\nraw data\n%s", rawOtlpTraces)
+	}
+	otlpTracesParams = otlpTracesJobWithDefaults(otlpTracesParams)
+	log.Trace().Msgf("OtlpTraces generation for:\n%+v", otlpTracesParams)
+
+	return &otlpTracesLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadSpans),
+		url:            url,
+		otlpTracesJob:  otlpTracesParams,
+		tracesGen:      OtlpTracesGenerator(otlpTracesParams),
+	}
+}
+
+func (olt *otlpTracesLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		projectId := projectProvider.GetProjectId(olt.otlpTracesJob.NumProjects)
+		projectKey := projectProvider.GetProjectInfo(projectId).ProjectKey
+
+		tgt.Method = "POST"
+		tgt.URL = fmt.Sprintf("%s/api/%s/integration/otlp/v1/traces/", olt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+
+		req := utils.OtlpExportTraceServiceRequest{ResourceSpans: olt.tracesGen()}
+		var err error
+		if olt.otlpTracesJob.Encoding == OtlpEncodingJson {
+			tgt.Header.Set("Content-Type", "application/json")
+			tgt.Body, err = json.Marshal(req)
+		} else {
+			tgt.Header.Set("Content-Type", "application/x-protobuf")
+			tgt.Body, err = req.MarshalProto()
+		}
+		if err != nil {
+			return err
+		}
+
+		numSpans := 0
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				numSpans += len(scopeSpans.Spans)
+			}
+		}
+		olt.AddUnits(numSpans)
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (olt *otlpTracesLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// TargetUnits returns the number of spans of a request
+func (olt *otlpTracesLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	if olt.otlpTracesJob.Encoding == OtlpEncodingJson {
+		var req utils.OtlpExportTraceServiceRequest
+		if err := json.Unmarshal(tgt.Body, &req); err != nil {
+			return 0
+		}
+		numSpans := 0
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				numSpans += len(scopeSpans.Spans)
+			}
+		}
+		return uint64(numSpans)
+	}
+	numSpans, err := utils.OtlpProtoSpanCount(tgt.Body)
+	if err != nil {
+		return 0
+	}
+	return uint64(numSpans)
+}
+
+// OtlpTracesGenerator returns a generator for the resource spans of a request (one per trace)
+//
+// The traces are built with the same generators used for transactions, the root span is the server span
+// of the service the trace was generated for.
+func OtlpTracesGenerator(job OtlpTracesJob) func() []utils.OtlpResourceSpans {
+	traceGen := TraceContextGenerator(job.Operations)
+	spansGen := SpansGenerator(job.MinSpans, job.MaxSpans, job.Operations)
+	durationRange := int64(job.TraceDurationMax - job.TraceDurationMin)
+
+	return func() []utils.OtlpResourceSpans {
+		retVal := make([]utils.OtlpResourceSpans, 0, job.TracesPerRequest)
+		for idx := 0; idx < job.TracesPerRequest; idx++ {
+			duration := time.Duration(job.TraceDurationMin)
+			if durationRange > 0 {
+				duration += time.Duration(rand.Int63n(durationRange))
+			}
+			timestamp := time.Now().UTC()
+			start := timestamp.Add(-duration)
+
+			trace := traceGen()
+			root := CreateSpan("", trace.TraceId, toUnixTimestamp(timestamp), toUnixTimestamp(start), trace.Op)
+			root.SpanId = trace.SpanId
+			root.Description = fmt.Sprintf("GET /api/endpoint%d", rand.Intn(100))
+			children := spansGen(root.SpanId, trace.TraceId, start, timestamp)
+
+			spans := make([]utils.OtlpSpan, 0, len(children)+1)
+			spans = append(spans, otlpSpanFromSpan(root, utils.OtlpSpanKindServer))
+			for _, child := range children {
+				kind := utils.OtlpSpanKindInternal
+				if strings.HasPrefix(child.Op, "http") || strings.HasPrefix(child.Op, "db") {
+					kind = utils.OtlpSpanKindClient
+				}
+				spans = append(spans, otlpSpanFromSpan(child, kind))
+			}
+
+			resourceAttributes := map[string]any{"service.name": fmt.Sprintf("service%d", rand.Intn(job.NumServices))}
+			for key, value := range job.ResourceAttributes {
+				resourceAttributes[key] = value
+			}
+			retVal = append(retVal, utils.OtlpResourceSpans{
+				Resource: utils.OtlpResource{Attributes: utils.OtlpAttributes(resourceAttributes)},
+				ScopeSpans: []utils.OtlpScopeSpans{{
+					Scope: utils.OtlpScope{Name: "go-load-tester"},
+					Spans: spans,
+				}},
+			})
+		}
+		return retVal
+	}
+}
+
+// otlpSpanFromSpan converts a generated span into an OTLP span
+func otlpSpanFromSpan(span Span, kind int) utils.OtlpSpan {
+	name := span.Description
+	if len(name) == 0 {
+		name = span.Op
+	}
+	attributes := map[string]any{"sentry.op": span.Op}
+	for key, value := range span.Tags {
+		attributes[key] = value
+	}
+	status := utils.OtlpStatus{Code: utils.OtlpStatusOk}
+	if span.Status != "ok" {
+		status = utils.OtlpStatus{Code: utils.OtlpStatusError, Message: span.Status}
+	}
+	return utils.OtlpSpan{
+		TraceId:           span.TraceId,
+		SpanId:            span.SpanId,
+		ParentSpanId:      span.ParentSpanId,
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: fmt.Sprintf("%d", int64(span.StartTimestamp*1e9)),
+		EndTimeUnixNano:   fmt.Sprintf("%d", int64(span.Timestamp*1e9)),
+		Attributes:        utils.OtlpAttributes(attributes),
+		Status:            status,
+	}
+}
+
+// otlpTracesJobWithDefaults fills in the defaults for the parameters that were not specified
+func otlpTracesJobWithDefaults(job OtlpTracesJob) OtlpTracesJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.Encoding != OtlpEncodingJson && job.Encoding != OtlpEncodingProtobuf {
+		if len(job.Encoding) > 0 {
+			log.Error().Msgf("invalid OTLP encoding %s, using %s", job.Encoding, OtlpEncodingProtobuf)
+		}
+		job.Encoding = OtlpEncodingProtobuf
+	}
+	if job.TracesPerRequest <= 0 {
+		job.TracesPerRequest = 1
+	}
+	if job.MaxSpans <= 0 {
+		job.MaxSpans = 10
+	}
+	if job.TraceDurationMax <= 0 {
+		job.TraceDurationMax = utils.StringDuration(time.Second)
+	}
+	if job.TraceDurationMax < job.TraceDurationMin {
+		job.TraceDurationMax = job.TraceDurationMin
+	}
+	if len(job.Operations) == 0 {
+		job.Operations = []string{"http.server", "db"}
+	}
+	if job.NumServices <= 0 {
+		job.NumServices = 1
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("otlpTraces", newOtlpTracesLoadTester, nil)
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestOtlpTracesGenerator(t *testing.T) {
+	job := otlpTracesJobWithDefaults(OtlpTracesJob{
+		TracesPerRequest:   3,
+		MinSpans:           4,
+		MaxSpans:           8,
+		ResourceAttributes: map[string]string{"deployment.environment": "production"},
+	})
+	resourceSpans := OtlpTracesGenerator(job)()
+	if len(resourceSpans) != 3 {
+		t.Fatalf("expected 3 traces got %d", len(resourceSpans))
+	}
+	for _, trace := range resourceSpans {
+		attributes := make(map[string]string)
+		for _, attribute := range trace.Resource.Attributes {
+			attributes[attribute.Key] = *attribute.Value.StringValue
+		}
+		if attributes["service.name"] != "service0" || attributes["deployment.environment"] != "production" {
+			t.Errorf("invalid resource attributes %v", attributes)
+		}
+		spans := trace.ScopeSpans[0].Spans
+		if len(spans) < 5 || len(spans) > 9 {
+			t.Errorf("invalid number of spans %d", len(spans))
+		}
+		root := spans[0]
+		if root.ParentSpanId != "" || root.Kind != utils.OtlpSpanKindServer {
+			t.Errorf("invalid root span %+v", root)
+		}
+		spanIds := map[string]bool{root.SpanId: true}
+		for _, span := range spans[1:] {
+			if span.TraceId != root.TraceId {
+				t.Errorf("span %s not in the trace %s", span.SpanId, root.TraceId)
+			}
+			if !spanIds[span.ParentSpanId] {
+				t.Errorf("the parent of span %s is not in the trace", span.SpanId)
+			}
+			spanIds[span.SpanId] = true
+		}
+	}
+}
+
+func TestOtlpTracesEncoding(t *testing.T) {
+	for _, encoding := range []string{OtlpEncodingJson, OtlpEncodingProtobuf} {
+		loadTester := newOtlpTracesLoadTester("http://relay", json.RawMessage(
+			`{"encoding":"`+encoding+`","minSpans":1,"maxSpans":3}`)).(*otlpTracesLoadTester)
+		targeter, _ := loadTester.GetTargeter()
+		var target vegeta.Target
+		if err := targeter(&target); err != nil {
+			t.Fatalf("could not create target: %v", err)
+		}
+		var req utils.OtlpExportTraceServiceRequest
+		err := json.Unmarshal(target.Body, &req)
+		if encoding == OtlpEncodingJson {
+			if err != nil || target.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("expected a JSON request %v", err)
+			}
+		} else if err == nil || target.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("expected a protobuf request")
+		}
+		if _, units := loadTester.PayloadUnits(); units < 2 || units > 3 {
+			t.Errorf("expected the spans to be counted got %d", units)
+		}
+	}
+}
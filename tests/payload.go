@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"sync/atomic"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+// Logical units carried by the requests of the load tests
+const (
+	PayloadRequests      = "requests" // used for load tests that do not report their payload
+	PayloadEvents        = "events"
+	PayloadItems         = "items"
+	PayloadBuckets       = "buckets"
+	PayloadRows          = "rows"
+	PayloadProjects      = "projects"
+	PayloadAttachments   = "attachments"
+	PayloadSegments      = "segments"
+	PayloadCheckIns      = "check-ins"
+	PayloadOutcomes      = "outcomes"
+	PayloadSpans         = "spans"
+	PayloadLogs          = "logs"
+	PayloadRegistrations = "registrations"
+)
+
+// PayloadReporter is optionally implemented by load testers that know how many logical units (events,
+// envelope items, metric buckets, rows, projects...) the requests they generate carry.
+//
+// A single request may carry many units (e.g. a batch of rows or a list of project keys) so the request
+// rate alone does not tell how much work the system under test is doing.
+type PayloadReporter interface {
+	// PayloadUnits returns the name of the unit and the total number of units generated by the load tester
+	PayloadUnits() (string, uint64)
+}
+
+// PayloadCounter counts the units generated by a load tester, embed it in a load tester to implement PayloadReporter
+//
+// It is safe to use from the targeter (which vegeta calls concurrently).
+type PayloadCounter struct {
+	unit  string
+	units uint64
+}
+
+// NewPayloadCounter creates a counter for the specified unit (e.g. PayloadEvents)
+func NewPayloadCounter(unit string) PayloadCounter {
+	return PayloadCounter{unit: unit}
+}
+
+// AddUnits adds the units carried by a request
+func (c *PayloadCounter) AddUnits(units int) {
+	atomic.AddUint64(&c.units, uint64(units))
+}
+
+func (c *PayloadCounter) PayloadUnits() (string, uint64) {
+	return c.unit, atomic.LoadUint64(&c.units)
+}
+
+// GetPayloadUnits returns the payload generated by a load tester, for load testers that do not implement
+// PayloadReporter every request counts as one unit.
+func GetPayloadUnits(loadTester LoadTester, requests uint64) (string, uint64) {
+	if reporter, ok := loadTester.(PayloadReporter); ok {
+		return reporter.PayloadUnits()
+	}
+	return PayloadRequests, requests
+}
+
+// TargetUnitsReporter is optionally implemented by load testers whose requests carry more than one payload unit,
+// it returns the units carried by a single request (e.g. to count the units of the requests that are suppressed).
+type TargetUnitsReporter interface {
+	// TargetUnits returns the number of units carried by a request generated by the load tester
+	TargetUnits(tgt *vegeta.Target) uint64
+}
+
+// GetTargetUnits returns the payload units carried by a request, for load testers that do not implement
+// TargetUnitsReporter every request carries one unit.
+func GetTargetUnits(loadTester LoadTester, tgt *vegeta.Target) uint64 {
+	if reporter, ok := loadTester.(TargetUnitsReporter); ok {
+		return reporter.TargetUnits(tgt)
+	}
+	return 1
+}
+
+// BodySizeReporter is optionally implemented by load testers that compress the bodies of their requests, the size
+// of the bodies sent is counted by vegeta so the load tester reports the size of the bodies before compression.
+type BodySizeReporter interface {
+	// UncompressedBytes returns the total size of the request bodies before compression
+	UncompressedBytes() uint64
+}
+
+// GetUncompressedBytes returns the size of the request bodies before compression, for load testers that do not
+// implement BodySizeReporter the bodies are not compressed (and the size is the size of the bodies sent).
+func GetUncompressedBytes(loadTester LoadTester, bytesOut uint64) uint64 {
+	if reporter, ok := loadTester.(BodySizeReporter); ok {
+		return reporter.UncompressedBytes()
+	}
+	return bytesOut
+}
@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+func TestMetricBucketPayloadUnits(t *testing.T) {
+	params := json.RawMessage(`{"numProjects": 1, "numCounters": 2, "numSets": 1, "numDistributions": 3, "numGauges": 1}`)
+	loadTester := newMetricsBucketLoadTester("http://localhost", params)
+	targeter, _ := loadTester.GetTargeter()
+	for idx := 0; idx < 3; idx++ {
+		var target vegeta.Target
+		if err := targeter(&target); err != nil {
+			t.Fatalf("could not create target: %v", err)
+		}
+	}
+
+	unit, units := GetPayloadUnits(loadTester, 3)
+	if unit != PayloadBuckets || units != 21 {
+		t.Errorf("expected 21 buckets got %d %s", units, unit)
+	}
+}
+
+func TestDefaultPayloadUnits(t *testing.T) {
+	loadTester := newClickhouseQueryLoadTester("http://localhost", json.RawMessage(`{"multiplier": 1}`))
+	unit, units := GetPayloadUnits(loadTester, 7)
+	if unit != PayloadRequests || units != 7 {
+		t.Errorf("expected one unit per request got %d %s", units, unit)
+	}
+}
@@ -0,0 +1,342 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// ProfileJob is how a profile load test is parameterized
+//
+// Every request sends an envelope with a transaction (generated as for the transaction test) and the
+// profile of that transaction. The transaction parameters (transactionDurationMin, minSpans...) can be
+// used as for the transaction test (maxSpans defaults to 10).
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "transactionDurationMin": "100ms",
+//  "transactionDurationMax": "2s",
+//  "minSamples": 10,
+//  "maxSamples": 200,
+//  "minStackDepth": 5,
+//  "maxStackDepth": 40,
+//  "numFrames": 5000,
+//  "maxStacks": 50,
+//  "numThreads": 2
+// }
+// ```
+type ProfileJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// MinSamples the minimum number of samples in a profile (default 1)
+	MinSamples int `json:"minSamples,omitempty" yaml:"minSamples,omitempty"`
+	// MaxSamples the maximum number of samples in a profile (default 100)
+	MaxSamples int `json:"maxSamples,omitempty" yaml:"maxSamples,omitempty"`
+	// MinStackDepth the minimum number of frames in a stack (default 1)
+	MinStackDepth int `json:"minStackDepth,omitempty" yaml:"minStackDepth,omitempty"`
+	// MaxStackDepth the maximum number of frames in a stack (default 20)
+	MaxStackDepth int `json:"maxStackDepth,omitempty" yaml:"maxStackDepth,omitempty"`
+	// NumFrames the number of distinct frames used by all the profiles of the test (default 1000)
+	NumFrames int `json:"numFrames,omitempty" yaml:"numFrames,omitempty"`
+	// MaxStacks the maximum number of distinct stacks in a profile, samples share the stacks (default 20)
+	MaxStacks int `json:"maxStacks,omitempty" yaml:"maxStacks,omitempty"`
+	// NumThreads the number of threads sampled in a profile (default 1)
+	NumThreads int `json:"numThreads,omitempty" yaml:"numThreads,omitempty"`
+	// TransactionJobCommon embedded fields, see TransactionJobCommon documentation
+	TransactionJobCommon `yaml:"transactionJobCommon,inline"`
+}
+
+// Profile defines the JSON format of a profile (sample format)
+type Profile struct {
+	EventId     string             `json:"event_id"`
+	Version     string             `json:"version"`
+	Platform    string             `json:"platform"`
+	Timestamp   string             `json:"timestamp"` // RFC 3339
+	Release     string             `json:"release,omitempty"`
+	Environment string             `json:"environment,omitempty"`
+	Os          ProfileOs          `json:"os"`
+	Device      ProfileDevice      `json:"device"`
+	Runtime     ProfileRuntime     `json:"runtime"`
+	Transaction ProfileTransaction `json:"transaction"`
+	Profile     ProfileData        `json:"profile"`
+}
+
+type ProfileOs struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type ProfileDevice struct {
+	Architecture string `json:"architecture"`
+}
+
+type ProfileRuntime struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type ProfileTransaction struct {
+	Id             string `json:"id"`
+	Name           string `json:"name"`
+	TraceId        string `json:"trace_id"`
+	ActiveThreadId string `json:"active_thread_id"`
+}
+
+type ProfileData struct {
+	Samples        []ProfileSample           `json:"samples"`
+	Stacks         [][]int                   `json:"stacks"`
+	Frames         []Frame                   `json:"frames"`
+	ThreadMetadata map[string]ThreadMetadata `json:"thread_metadata"`
+}
+
+type ProfileSample struct {
+	StackId             int    `json:"stack_id"`
+	ThreadId            string `json:"thread_id"`
+	ElapsedSinceStartNs string `json:"elapsed_since_start_ns"`
+}
+
+type ThreadMetadata struct {
+	Name string `json:"name"`
+}
+
+// profileLoadTester is used to drive a profile load test
+type profileLoadTester struct {
+	PayloadCounter
+	url                  string
+	profileJob           ProfileJob
+	transactionGenerator func(time.Duration) Transaction
+	profileGenerator     func(transaction *Transaction) Profile
+}
+
+func newProfileLoadTester(url string, rawProfile json.RawMessage) LoadTester {
+	var profileParams ProfileJob
+	err := json.Unmarshal(rawProfile, &profileParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid profile params received\nraw data\n%s", rawProfile)
+	}
+	profileParams = profileJobWithDefaults(profileParams)
+	log.Trace().Msgf("Profile generation for:\n%+v", profileParams)
+
+	return &profileLoadTester{
+		PayloadCounter:       NewPayloadCounter(PayloadEvents),
+		url:                  url,
+		profileJob:           profileParams,
+		transactionGenerator: TransactionGenerator(profileParams.TransactionJobCommon),
+		profileGenerator:     ProfileGenerator(profileParams),
+	}
+}
+
+func (plt *profileLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = plt.profileJob.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", plt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		transaction := plt.transactionGenerator(0)
+		profile := plt.profileGenerator(&transaction)
+
+		transactionBody, err := json.Marshal(transaction)
+		if err != nil {
+			return err
+		}
+		profileBody, err := json.Marshal(profile)
+		if err != nil {
+			return err
+		}
+
+		extraEnvelopeHeaders := map[string]string{
+			"trace_id":   transaction.Contexts.Trace.TraceId,
+			"public_key": projectKey,
+		}
+		buff, err := utils.EnvelopeFromItems(transaction.EventId, time.Now().UTC(), extraEnvelopeHeaders,
+			utils.EnvelopeItem{Type: "transaction", Payload: transactionBody},
+			utils.EnvelopeItem{Type: "profile", Payload: profileBody},
+		)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		plt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (plt *profileLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// profileJobWithDefaults fills in the defaults for the parameters that were not specified
+func profileJobWithDefaults(job ProfileJob) ProfileJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.MinSamples <= 0 {
+		job.MinSamples = 1
+	}
+	if job.MaxSamples <= 0 {
+		job.MaxSamples = 100
+	}
+	if job.MaxSamples < job.MinSamples {
+		job.MaxSamples = job.MinSamples
+	}
+	if job.MinStackDepth <= 0 {
+		job.MinStackDepth = 1
+	}
+	if job.MaxStackDepth <= 0 {
+		job.MaxStackDepth = 20
+	}
+	if job.MaxStackDepth < job.MinStackDepth {
+		job.MaxStackDepth = job.MinStackDepth
+	}
+	if job.NumFrames <= 0 {
+		job.NumFrames = 1000
+	}
+	if job.MaxStacks <= 0 {
+		job.MaxStacks = 20
+	}
+	if job.NumThreads <= 0 {
+		job.NumThreads = 1
+	}
+	if job.MaxSpans <= 0 {
+		job.MaxSpans = 10
+	}
+	return job
+}
+
+// ProfileGenerator returns a function that generates the profile of a transaction
+//
+// The profile id is set in the profile context of the transaction (and the transaction gets a name if it
+// doesn't have one, profiles need it). The frames are picked from a set of job.NumFrames frames, the
+// frames are generated from their index so all workers use the same frames.
+func ProfileGenerator(job ProfileJob) func(transaction *Transaction) Profile {
+	idGen := EventIdGenerator()
+	frames := make([]Frame, job.NumFrames)
+	for idx := range frames {
+		frames[idx] = profileFrame(idx)
+	}
+
+	return func(transaction *Transaction) Profile {
+		profileId := idGen()
+		transaction.Contexts.Profile = &ProfileContext{ProfileId: profileId}
+		if len(transaction.Transaction) == 0 {
+			transaction.Transaction = fmt.Sprintf("mytransaction%d", rand.Intn(100))
+		}
+		start, err := FromUTCString(transaction.StartTimestamp)
+		if err != nil {
+			start = time.Now().UTC()
+		}
+		end, err := FromUTCString(transaction.Timestamp)
+		if err != nil || end.Before(start) {
+			end = start
+		}
+
+		numSamples := job.MinSamples + rand.Intn(job.MaxSamples-job.MinSamples+1)
+		numStacks := 1 + rand.Intn(utils.Min(job.MaxStacks, numSamples))
+
+		// the frames of the profile (indexes in the profile frames are local to the profile)
+		profileFrames := make([]Frame, 0)
+		frameIndexes := make(map[int]int)
+		stacks := make([][]int, numStacks)
+		for stackIdx := range stacks {
+			depth := job.MinStackDepth + rand.Intn(job.MaxStackDepth-job.MinStackDepth+1)
+			stack := make([]int, depth)
+			for idx := range stack {
+				frameIdx := rand.Intn(len(frames))
+				localIdx, ok := frameIndexes[frameIdx]
+				if !ok {
+					localIdx = len(profileFrames)
+					frameIndexes[frameIdx] = localIdx
+					profileFrames = append(profileFrames, frames[frameIdx])
+				}
+				stack[idx] = localIdx
+			}
+			stacks[stackIdx] = stack
+		}
+
+		threads := make(map[string]ThreadMetadata, job.NumThreads)
+		for idx := 0; idx < job.NumThreads; idx++ {
+			threads[strconv.Itoa(idx+1)] = ThreadMetadata{Name: fmt.Sprintf("Thread-%d", idx+1)}
+		}
+		threads["1"] = ThreadMetadata{Name: "MainThread"}
+
+		// samples are taken at regular intervals during the transaction
+		interval := end.Sub(start) / time.Duration(numSamples)
+		if interval <= 0 {
+			interval = 10 * time.Millisecond
+		}
+		samples := make([]ProfileSample, numSamples)
+		for idx := range samples {
+			samples[idx] = ProfileSample{
+				StackId:             rand.Intn(numStacks),
+				ThreadId:            strconv.Itoa(1 + rand.Intn(job.NumThreads)),
+				ElapsedSinceStartNs: strconv.FormatInt(int64(interval)*int64(idx), 10),
+			}
+		}
+
+		return Profile{
+			EventId:     profileId,
+			Version:     "1",
+			Platform:    "python",
+			Timestamp:   toUtcString(start),
+			Release:     transaction.Release,
+			Environment: transaction.Environment,
+			Os:          ProfileOs{Name: "Linux", Version: "5.15"},
+			Device:      ProfileDevice{Architecture: "x86_64"},
+			Runtime:     ProfileRuntime{Name: "CPython", Version: "3.11.4"},
+			Transaction: ProfileTransaction{
+				Id:             transaction.EventId,
+				Name:           transaction.Transaction,
+				TraceId:        transaction.Contexts.Trace.TraceId,
+				ActiveThreadId: "1",
+			},
+			Profile: ProfileData{
+				Samples:        samples,
+				Stacks:         stacks,
+				Frames:         profileFrames,
+				ThreadMetadata: threads,
+			},
+		}
+	}
+}
+
+// profileFrame creates the frame with the specified index
+func profileFrame(frameIdx int) Frame {
+	module := fmt.Sprintf("app.module%d", frameIdx/20)
+	return Frame{
+		Function: fmt.Sprintf("function%d", frameIdx),
+		Module:   module,
+		Filename: fmt.Sprintf("app/module%d.py", frameIdx/20),
+		AbsPath:  fmt.Sprintf("/srv/app/module%d.py", frameIdx/20),
+		Lineno:   1 + frameIdx%20*10,
+		InApp:    frameIdx%5 != 0,
+	}
+}
+
+func init() {
+	RegisterSentryTestType("profile", newProfileLoadTester, nil)
+}
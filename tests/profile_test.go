@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestProfileJobDefaultSpans(t *testing.T) {
+	// the profiled transactions have spans and breadcrumbs by default
+	job := profileJobWithDefaults(ProfileJob{})
+	generator := TransactionGenerator(job.TransactionJobCommon)
+	numSpans, numBreadcrumbs := 0, 0
+	for idx := 0; idx < 10; idx++ {
+		transaction := generator(0)
+		numSpans += len(transaction.Spans)
+		numBreadcrumbs += len(transaction.Breadcrumbs)
+	}
+	if numSpans == 0 || numBreadcrumbs == 0 {
+		t.Errorf("expected spans and breadcrumbs got %d spans and %d breadcrumbs", numSpans, numBreadcrumbs)
+	}
+}
+
+func TestProfileGenerator(t *testing.T) {
+	job := profileJobWithDefaults(ProfileJob{
+		MinSamples:    20,
+		MaxSamples:    50,
+		MinStackDepth: 3,
+		MaxStackDepth: 8,
+		NumFrames:     30,
+		MaxStacks:     10,
+		NumThreads:    2,
+		TransactionJobCommon: TransactionJobCommon{
+			TransactionDurationMin: utils.StringDuration(100_000_000),
+			TransactionDurationMax: utils.StringDuration(2_000_000_000),
+		},
+	})
+	transactionGenerator := TransactionGenerator(job.TransactionJobCommon)
+	profileGenerator := ProfileGenerator(job)
+
+	for idx := 0; idx < 20; idx++ {
+		transaction := transactionGenerator(0)
+		profile := profileGenerator(&transaction)
+
+		if transaction.Contexts.Profile == nil || transaction.Contexts.Profile.ProfileId != profile.EventId {
+			t.Fatalf("transaction not linked to the profile %+v", transaction.Contexts.Profile)
+		}
+		if profile.Transaction.Id != transaction.EventId || len(profile.Transaction.Name) == 0 ||
+			profile.Transaction.TraceId != transaction.Contexts.Trace.TraceId {
+			t.Errorf("profile not linked to the transaction %+v", profile.Transaction)
+		}
+		data := profile.Profile
+		if len(data.Samples) < 20 || len(data.Samples) > 50 {
+			t.Errorf("invalid number of samples %d", len(data.Samples))
+		}
+		if len(data.Stacks) < 1 || len(data.Stacks) > 10 {
+			t.Errorf("invalid number of stacks %d", len(data.Stacks))
+		}
+		if len(data.Frames) > 30 {
+			t.Errorf("expected at most 30 distinct frames got %d", len(data.Frames))
+		}
+		for _, stack := range data.Stacks {
+			if len(stack) < 3 || len(stack) > 8 {
+				t.Errorf("invalid stack depth %d", len(stack))
+			}
+			for _, frameIdx := range stack {
+				if frameIdx >= len(data.Frames) {
+					t.Errorf("invalid frame index %d", frameIdx)
+				}
+			}
+		}
+		for _, sample := range data.Samples {
+			if sample.StackId >= len(data.Stacks) {
+				t.Errorf("invalid stack id %d", sample.StackId)
+			}
+			if _, ok := data.ThreadMetadata[sample.ThreadId]; !ok {
+				t.Errorf("sample on unknown thread %s", sample.ThreadId)
+			}
+		}
+		if _, err := json.Marshal(profile); err != nil {
+			t.Errorf("could not serialize profile: %v", err)
+		}
+	}
+}
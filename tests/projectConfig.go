@@ -30,6 +30,9 @@ import (
 //   "maxBatchSize": 100,
 //   "BatchInterval": "5s",
 //   "projectInvalidationRatio": 0.001,
+//   "publicKeysRatio": 0.01,
+//   "globalConfigRatio": 0.001,
+//   "relayIds": ["aaa12340-a123-123b-4567-0afe1f27e066", "bbb12340-a123-123b-4567-0afe1f27e066"],
 //   "RelayPublicKey": "ftFuDNBFm8-kPpuCuaWMio_mJAW2txCFCsaLMHn2vv0",
 //   "RelayPrivateKey": "uZUtRaayN8uuuTTOjbs5EDfqWNwyDfFro6TERx6Wfhs",
 //   "RelayId": "aaa12340-a123-123b-4567-0afe1f27e066"
@@ -44,10 +47,20 @@ type ProjectConfigJob struct {
 	MinBatchSize int
 	// MaxBatchSize the maximum number of projects in a project config request
 	MaxBatchSize int
-	// BatchInterval is the duration of validity of a project config
+	// BatchInterval is the duration of validity of a project config (it is also used as the validity of the
+	// relay public keys, expired keys are requested again)
 	BatchInterval time.Duration
 	// The ratio from the number of requests that are invalidation requests (should be between 0 and 1).
 	ProjectInvalidationRatio float64
+	// The ratio from the number of requests that are relay public keys requests (should be between 0 and 1).
+	PublicKeysRatio float64
+	// The ratio from the number of requests that are global config requests (should be between 0 and 1).
+	GlobalConfigRatio float64
+	// RelayIds the ids of the relays in the fleet whose public keys are requested, they should be relays
+	// registered with the upstream (the virtual relays are not registered) for the lookups to return keys.
+	// Defaults to the RelayId, in which case every public keys request asks for the same single key,
+	// set it to a fleet of registered relays for realistic public keys requests.
+	RelayIds []string
 	// RelayPublicKey public key for Relay authentication
 	RelayPublicKey string
 	// RelayPrivateKey private key for Relay authentication
@@ -61,10 +74,13 @@ type requestType int
 const (
 	ProjectConfigRequest     requestType = 0
 	InvalidateProjectRequest requestType = 1
+	PublicKeysRequest        requestType = 2
+	GlobalConfigRequest      requestType = 3
 )
 
 // projectConfigLoadTester defines the state data during a ProjectConfiguration load test
 type projectConfigLoadTester struct {
+	PayloadCounter
 	// the base url for the target
 	url string
 	// the configuration of the attack
@@ -75,6 +91,12 @@ type projectConfigLoadTester struct {
 	reqSequence uint64
 	// keeps a count of how many invalidation requests were sent
 	invalidationRequestsSent uint64
+	// keeps a count of how many public keys requests were sent
+	publicKeysRequestsSent uint64
+	// keeps a count of how many global config requests were sent
+	globalConfigRequestsSent uint64
+	// the ids of the relays in the fleet (used in the public keys requests)
+	relayIds []string
 	// lock to be used when manipulating projectConfigLoadTester (specifically nextRelayIdx)
 	lock sync.Mutex
 	// relayPrivateKey is the private key used to sign the request
@@ -97,16 +119,37 @@ type virtualRelay struct {
 	// a list with the project that have been cached in the order that they have been cached
 	// it is used as an easy way to find expired projects (without walking through the whole cacheProjects dict)
 	cachedProjectDates list.List
+	// the public keys of the other relays in the fleet that are known by the relay
+	relayKeys map[string]relayKey
 	// lock for mutual exclusion during virtual Relay operations
 	lock sync.Mutex
 }
 
+// represents the public key of a relay (together with the last update date)
+type relayKey struct {
+	publicKey  string
+	lastUpdate time.Time
+}
+
 // projectConfigResponse represents the response from a getProjects request
 type projectConfigResponse struct {
 	Pending []string                   `json:"pending"`
 	Configs map[string]json.RawMessage `json:"configs"`
 }
 
+// publicKeysRequest represents a request for the public keys of relays
+type publicKeysRequest struct {
+	RelayIds []string `json:"relay_ids"`
+}
+
+// publicKeysResponse represents the response from a public keys request (unknown relays have null values)
+type publicKeysResponse struct {
+	PublicKeys map[string]*string `json:"public_keys"`
+	Relays     map[string]*struct {
+		PublicKey string `json:"publicKey"`
+	} `json:"relays"`
+}
+
 func newProjectConfigLoadTester(url string, rawProjectConfigParams json.RawMessage) *projectConfigLoadTester {
 	var projectConfigParams ProjectConfigJob
 	err := json.Unmarshal(rawProjectConfigParams, &projectConfigParams)
@@ -118,14 +161,20 @@ func newProjectConfigLoadTester(url string, rawProjectConfigParams json.RawMessa
 
 func projectConfigLoadTesterFromJob(job ProjectConfigJob, url string) *projectConfigLoadTester {
 	var retVal = &projectConfigLoadTester{
-		url:    url,
-		config: job,
-		relays: make([]virtualRelay, job.NumRelays),
+		PayloadCounter: NewPayloadCounter(PayloadProjects),
+		url:            url,
+		config:         job,
+		relays:         make([]virtualRelay, job.NumRelays),
+		relayIds:       job.RelayIds,
 	}
 
 	for idx := 0; idx < len(retVal.relays); idx++ {
 		retVal.relays[idx].InitVirtualRelay()
 	}
+	if len(retVal.relayIds) == 0 && len(job.RelayId) > 0 {
+		// the relay used for authentication is the only relay known to be registered with the upstream
+		retVal.relayIds = []string{job.RelayId}
+	}
 
 	return retVal
 }
@@ -134,6 +183,7 @@ type projectConfigRequest struct {
 	PublicKeys []string `json:"publicKeys"`
 	FullConfig bool     `json:"fullConfig"`
 	NoCache    *bool    `json:"noCache,omitempty"` // not used yet
+	Global     bool     `json:"global,omitempty"`
 }
 
 func (lt *projectConfigLoadTester) GetRelayPrivateKey() (ed25519.PrivateKey, error) {
@@ -174,6 +224,7 @@ func (lt *projectConfigLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 		// generate a unique change in the project config in order to invalidate it
 		body := fmt.Sprintf(`{"safeFields": ["x-%d"]}`, reqSequence)
 		target.Body = []byte(body)
+		lt.AddUnits(1)
 		return nil
 	}
 
@@ -227,35 +278,85 @@ func (lt *projectConfigLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 			PublicKeys: projectKeys,
 			FullConfig: true,
 		}
-		body, err := json.Marshal(req)
-		if err != nil {
-			log.Error().Err(err).Msg("Could not marshal project config request")
+		if err = setSignedRelayRequest(target, url, req, privateKey, config.RelayId); err != nil {
 			return err
 		}
+		lt.AddUnits(len(projectIds))
+		return nil
+	}
+
+	getGlobalConfigRequest := func(target *vegeta.Target) error {
+		if target == nil {
+			return vegeta.ErrNilTarget
+		}
+		if pkError != nil {
+			return pkError
+		}
+		url := strings.TrimSuffix(lt.url, "/") + "/api/0/relays/projectconfigs/?version=3"
+		req := projectConfigRequest{
+			PublicKeys: []string{},
+			FullConfig: true,
+			Global:     true,
+		}
+		return setSignedRelayRequest(target, url, req, privateKey, lt.config.RelayId)
+	}
 
-		now := time.Now().UTC()
-		signature, err := utils.RelayAuthSign(privateKey, body, now)
+	getPublicKeysRequest := func(target *vegeta.Target) error {
+		if target == nil {
+			return vegeta.ErrNilTarget
+		}
+		if pkError != nil {
+			return pkError
+		}
+		relay, err := lt.RelayFromSequence(reqSequence)
 		if err != nil {
-			log.Error().Err(err).Msg("Could not sign request")
+			log.Error().Err(err).Msg("error getting relay")
 			return err
 		}
-
-		target.Header = make(http.Header)
-		target.Header.Set("Content-Type", "application/json")
-		target.Header.Set("X-Sentry-Relay-Signature", signature)
-		target.Header.Set("X-Sentry-Relay-Id", config.RelayId)
-		target.Body = body
-		return nil
+		url := strings.TrimSuffix(lt.url, "/") + "/api/0/relays/publickeys/"
+		req := publicKeysRequest{
+			RelayIds: relay.GetRelaysForRequest(lt.relayIds, lt.config.MaxBatchSize, lt.config.BatchInterval),
+		}
+		return setSignedRelayRequest(target, url, req, privateKey, lt.config.RelayId)
 	}
 
 	switch reqType {
 	case InvalidateProjectRequest:
 		return getInvalidationRequest, reqSequence
+	case PublicKeysRequest:
+		return getPublicKeysRequest, reqSequence
+	case GlobalConfigRequest:
+		return getGlobalConfigRequest, reqSequence
 	default:
 		return getProjectRequest, reqSequence
 	}
 }
 
+// setSignedRelayRequest sets a POST request with the body signed by the relay
+func setSignedRelayRequest(target *vegeta.Target, url string, req interface{}, privateKey ed25519.PrivateKey, relayId string) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not marshal relay request")
+		return err
+	}
+
+	now := time.Now().UTC()
+	signature, err := utils.RelayAuthSign(privateKey, body, now)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not sign request")
+		return err
+	}
+
+	target.Method = "POST"
+	target.URL = url
+	target.Header = make(http.Header)
+	target.Header.Set("Content-Type", "application/json")
+	target.Header.Set("X-Sentry-Relay-Signature", signature)
+	target.Header.Set("X-Sentry-Relay-Id", relayId)
+	target.Body = body
+	return nil
+}
+
 func (lt *projectConfigLoadTester) ProcessResult(result *vegeta.Result, seq uint64) {
 	var relay, err = lt.RelayFromSequence(seq)
 	if err != nil {
@@ -263,6 +364,13 @@ func (lt *projectConfigLoadTester) ProcessResult(result *vegeta.Result, seq uint
 		return
 	}
 
+	var keysResponse publicKeysResponse
+	if err = json.Unmarshal(result.Body, &keysResponse); err == nil &&
+		(keysResponse.Relays != nil || keysResponse.PublicKeys != nil) {
+		relay.UpdateRelayKeys(keysResponse.publicKeys())
+		return
+	}
+
 	var configResponse projectConfigResponse
 	err = json.Unmarshal(result.Body, &configResponse)
 	if err != nil {
@@ -321,6 +429,14 @@ func (lt *projectConfigLoadTester) GetRequestSequence() (uint64, requestType) {
 		lt.invalidationRequestsSent++
 		return lt.reqSequence, InvalidateProjectRequest
 	}
+	if float64(lt.reqSequence)*lt.config.PublicKeysRatio > float64(lt.publicKeysRequestsSent) {
+		lt.publicKeysRequestsSent++
+		return lt.reqSequence, PublicKeysRequest
+	}
+	if float64(lt.reqSequence)*lt.config.GlobalConfigRatio > float64(lt.globalConfigRequestsSent) {
+		lt.globalConfigRequestsSent++
+		return lt.reqSequence, GlobalConfigRequest
+	}
 	return lt.reqSequence, ProjectConfigRequest
 }
 
@@ -341,6 +457,7 @@ func (lt *projectConfigLoadTester) RelayFromSequence(sequence uint64) (*virtualR
 func (vr *virtualRelay) InitVirtualRelay() {
 	vr.pendingProjects = make(map[string]bool)
 	vr.cachedProjects = make(map[string]time.Time)
+	vr.relayKeys = make(map[string]relayKey)
 }
 
 func NewVirtualRelay() *virtualRelay {
@@ -434,6 +551,77 @@ func updateProjectStates(vr *virtualRelay, pendingProjects []string, resolvedPro
 	}
 }
 
+// publicKeys returns the public keys of the relays from the response (empty for unknown relays)
+func (resp publicKeysResponse) publicKeys() map[string]string {
+	retVal := make(map[string]string, len(resp.Relays)+len(resp.PublicKeys))
+	for relayId, publicKey := range resp.PublicKeys {
+		if publicKey != nil {
+			retVal[relayId] = *publicKey
+		} else {
+			retVal[relayId] = ""
+		}
+	}
+	for relayId, info := range resp.Relays {
+		if info != nil {
+			retVal[relayId] = info.PublicKey
+		} else if _, ok := retVal[relayId]; !ok {
+			retVal[relayId] = ""
+		}
+	}
+	return retVal
+}
+
+// GetRelaysForRequest returns the ids of the relays (from the fleet) whose public keys should be requested next,
+// these are the relays with unknown or expired keys. If all keys are known the oldest one is refreshed.
+func (vr *virtualRelay) GetRelaysForRequest(relayIds []string, maxRelays int, expiryTime time.Duration) []string {
+	return getRelaysForRequest(vr, relayIds, maxRelays, expiryTime, time.Now())
+}
+
+// getRelaysForRequest internal version of GetRelaysForRequest for testing (with injected now)
+func getRelaysForRequest(vr *virtualRelay, relayIds []string, maxRelays int, expiryTime time.Duration, now time.Time) []string {
+	vr.lock.Lock()
+	defer vr.lock.Unlock()
+
+	if maxRelays <= 0 {
+		maxRelays = 1
+	}
+	cutoff := now.Add(-expiryTime)
+	retVal := make([]string, 0, maxRelays)
+	oldestId := ""
+	var oldest time.Time
+	for _, relayId := range relayIds {
+		key, ok := vr.relayKeys[relayId]
+		if !ok || key.lastUpdate.Before(cutoff) {
+			retVal = append(retVal, relayId)
+			if len(retVal) == maxRelays {
+				return retVal
+			}
+		} else if len(oldestId) == 0 || key.lastUpdate.Before(oldest) {
+			oldestId = relayId
+			oldest = key.lastUpdate
+		}
+	}
+	if len(retVal) == 0 && len(oldestId) > 0 {
+		retVal = append(retVal, oldestId)
+	}
+	return retVal
+}
+
+// UpdateRelayKeys updates the public keys known by the relay with the result from a public keys response
+func (vr *virtualRelay) UpdateRelayKeys(publicKeys map[string]string) {
+	updateRelayKeys(vr, publicKeys, time.Now())
+}
+
+// updateRelayKeys internal version of UpdateRelayKeys for testing (with injected now)
+func updateRelayKeys(vr *virtualRelay, publicKeys map[string]string, now time.Time) {
+	vr.lock.Lock()
+	defer vr.lock.Unlock()
+
+	for relayId, publicKey := range publicKeys {
+		vr.relayKeys[relayId] = relayKey{publicKey: publicKey, lastUpdate: now}
+	}
+}
+
 // cleanExpiredProjects removes all projects from the front of the queue that have been added before the
 // maximum allowed time (i.e. now-expiryTime)
 func (vr *virtualRelay) cleanExpiredProjects(expiryTime time.Duration, now time.Time) {
@@ -456,15 +644,18 @@ func (vr *virtualRelay) cleanExpiredProjects(expiryTime time.Duration, now time.
 }
 
 type projectConfigJobRaw struct {
-	NumRelays                int     `json:"numRelays" yaml:"numRelays"`
-	NumProjects              int     `json:"numProjects" yaml:"numProjects"`
-	MinBatchSize             int     `json:"minBatchSize" yaml:"minBatchSize"`
-	MaxBatchSize             int     `json:"maxBatchSize" yaml:"maxBatchSize"`
-	BatchInterval            string  `json:"batchInterval" yaml:"batchInterval"`
-	ProjectInvalidationRatio float64 `json:"projectInvalidationRatio" yaml:"projectInvalidationRatio"`
-	RelayPublicKey           string  `json:"relayPublicKey" yaml:"relayPublicKey"`
-	RelayPrivateKey          string  `json:"relayPrivateKey" yaml:"relayPrivateKey"`
-	RelayId                  string  `json:"relayId" yaml:"relayId"`
+	NumRelays                int      `json:"numRelays" yaml:"numRelays"`
+	NumProjects              int      `json:"numProjects" yaml:"numProjects"`
+	MinBatchSize             int      `json:"minBatchSize" yaml:"minBatchSize"`
+	MaxBatchSize             int      `json:"maxBatchSize" yaml:"maxBatchSize"`
+	BatchInterval            string   `json:"batchInterval" yaml:"batchInterval"`
+	ProjectInvalidationRatio float64  `json:"projectInvalidationRatio" yaml:"projectInvalidationRatio"`
+	PublicKeysRatio          float64  `json:"publicKeysRatio,omitempty" yaml:"publicKeysRatio,omitempty"`
+	GlobalConfigRatio        float64  `json:"globalConfigRatio,omitempty" yaml:"globalConfigRatio,omitempty"`
+	RelayIds                 []string `json:"relayIds,omitempty" yaml:"relayIds,omitempty"`
+	RelayPublicKey           string   `json:"relayPublicKey" yaml:"relayPublicKey"`
+	RelayPrivateKey          string   `json:"relayPrivateKey" yaml:"relayPrivateKey"`
+	RelayId                  string   `json:"relayId" yaml:"relayId"`
 }
 
 func (pc projectConfigJobRaw) into(result *ProjectConfigJob) error {
@@ -473,6 +664,9 @@ func (pc projectConfigJobRaw) into(result *ProjectConfigJob) error {
 	result.MinBatchSize = pc.MinBatchSize
 	result.MaxBatchSize = pc.MaxBatchSize
 	result.ProjectInvalidationRatio = pc.ProjectInvalidationRatio
+	result.PublicKeysRatio = pc.PublicKeysRatio
+	result.GlobalConfigRatio = pc.GlobalConfigRatio
+	result.RelayIds = pc.RelayIds
 	result.RelayPublicKey = pc.RelayPublicKey
 	result.RelayPrivateKey = pc.RelayPrivateKey
 	result.RelayId = pc.RelayId
@@ -495,6 +689,9 @@ func (pcj ProjectConfigJob) intoRaw() projectConfigJobRaw {
 		MaxBatchSize:             pcj.MaxBatchSize,
 		BatchInterval:            pcj.BatchInterval.String(),
 		ProjectInvalidationRatio: pcj.ProjectInvalidationRatio,
+		PublicKeysRatio:          pcj.PublicKeysRatio,
+		GlobalConfigRatio:        pcj.GlobalConfigRatio,
+		RelayIds:                 pcj.RelayIds,
 		RelayPublicKey:           pcj.RelayPublicKey,
 		RelayPrivateKey:          pcj.RelayPrivateKey,
 		RelayId:                  pcj.RelayId,
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -287,3 +288,68 @@ func TestCleanExpiredProjects(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRelaysForRequest(t *testing.T) {
+	expiryTime := time.Minute * 5
+	now := getNow()
+	vr := NewVirtualRelay()
+	fleet := []string{"r1", "r2", "r3", "r4"}
+
+	// unknown keys are requested first (at most maxRelays at a time)
+	relays := getRelaysForRequest(vr, fleet, 3, expiryTime, now)
+	if diff := cmp.Diff([]string{"r1", "r2", "r3"}, relays); diff != "" {
+		t.Errorf("unexpected relays (-expected +actual):\n%s", diff)
+	}
+
+	updateRelayKeys(vr, map[string]string{"r1": "key1", "r2": "", "r3": "key3"}, now.Add(-expiryTime*2))
+	updateRelayKeys(vr, map[string]string{"r3": "key3", "r4": "key4"}, now.Add(-time.Minute))
+	relays = getRelaysForRequest(vr, fleet, 3, expiryTime, now)
+	if diff := cmp.Diff([]string{"r1", "r2"}, relays); diff != "" {
+		t.Errorf("expected the expired keys to be requested (-expected +actual):\n%s", diff)
+	}
+
+	// when all keys are known the oldest is refreshed
+	updateRelayKeys(vr, map[string]string{"r1": "key1", "r2": ""}, now)
+	relays = getRelaysForRequest(vr, fleet, 3, expiryTime, now)
+	if diff := cmp.Diff([]string{"r3"}, relays); diff != "" {
+		t.Errorf("expected the oldest key to be refreshed (-expected +actual):\n%s", diff)
+	}
+}
+
+func TestPublicKeysResponse(t *testing.T) {
+	var resp publicKeysResponse
+	body := `{"public_keys":{"r1":"key1","r2":null},"relays":{"r1":{"publicKey":"key1","internal":true},"r2":null,"r3":{"publicKey":"key3"}}}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("could not parse response: %v", err)
+	}
+	expected := map[string]string{"r1": "key1", "r2": "", "r3": "key3"}
+	if diff := cmp.Diff(expected, resp.publicKeys()); diff != "" {
+		t.Errorf("unexpected public keys (-expected +actual):\n%s", diff)
+	}
+}
+
+func TestGetRequestSequenceRatios(t *testing.T) {
+	run := projectConfigLoadTesterFromJob(ProjectConfigJob{NumRelays: 2, NumProjects: 10,
+		ProjectInvalidationRatio: 0.1, PublicKeysRatio: 0.2, GlobalConfigRatio: 0.05}, "the-url")
+	requests := make(map[requestType]int)
+	for idx := 0; idx < 1000; idx++ {
+		_, reqType := run.GetRequestSequence()
+		requests[reqType]++
+	}
+	expected := map[requestType]int{
+		InvalidateProjectRequest: 100,
+		PublicKeysRequest:        200,
+		GlobalConfigRequest:      50,
+		ProjectConfigRequest:     650,
+	}
+	if diff := cmp.Diff(expected, requests); diff != "" {
+		t.Errorf("unexpected request types (-expected +actual):\n%s", diff)
+	}
+	if len(run.relayIds) != 0 {
+		t.Errorf("expected no relay fleet without a relay id got %v", run.relayIds)
+	}
+	run = projectConfigLoadTesterFromJob(ProjectConfigJob{NumRelays: 2, RelayId: "r1"}, "the-url")
+	if diff := cmp.Diff([]string{"r1"}, run.relayIds); diff != "" {
+		t.Errorf("expected the authentication relay to be the relay fleet (-expected +actual):\n%s", diff)
+	}
+}
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+// defaultRetryAfter is how long a project is rate limited when the upstream does not say (the same as the SDKs)
+const defaultRetryAfter = 60 * time.Second
+
+// suppressedHeader marks the requests that a real SDK would not send (they never leave the load tester)
+const suppressedHeader = "X-Load-Tester-Suppressed"
+
+// ErrRateLimited is the error of the requests suppressed because of the rate limits sent by the upstream
+var ErrRateLimited = errors.New("request suppressed by rate limits")
+
+// RoundTripperWrapper is optionally implemented by load testers that need to see the HTTP responses (with
+// their headers) to the requests they generate, the vegeta results do not contain the response headers.
+type RoundTripperWrapper interface {
+	// WrapRoundTripper returns the round tripper used to send the requests of an attack
+	WrapRoundTripper(next http.RoundTripper) http.RoundTripper
+}
+
+// SuppressionReporter is optionally implemented by load testers that suppress requests (the way SDKs do while
+// rate limited), suppressed requests are not sent and are not part of the attack statistics.
+type SuppressionReporter interface {
+	// Suppressed returns the number of suppressed requests and the payload units they carried
+	Suppressed() (requests uint64, units uint64)
+}
+
+// GetSuppressed returns the requests and payload units suppressed by a load tester
+func GetSuppressed(loadTester LoadTester) (uint64, uint64) {
+	if reporter, ok := loadTester.(SuppressionReporter); ok {
+		return reporter.Suppressed()
+	}
+	return 0, 0
+}
+
+// IsSuppressed returns true for the results of the requests that were suppressed by the load tester
+func IsSuppressed(result *vegeta.Result) bool {
+	return result != nil && strings.HasSuffix(result.Error, ErrRateLimited.Error())
+}
+
+// RateLimits keeps the rate limits of the projects (per data category) the way an SDK does
+type RateLimits struct {
+	lock sync.Mutex
+	// the time until a project category is rate limited by project id and category ("" for all categories)
+	limits map[string]map[string]time.Time
+}
+
+// NewRateLimits creates an empty set of rate limits
+func NewRateLimits() *RateLimits {
+	return &RateLimits{limits: make(map[string]map[string]time.Time)}
+}
+
+// Update updates the rate limits of a project from the response to one of its requests
+//
+// Like sentry-go the X-Sentry-Rate-Limits header is used if present, a 429 response without it limits
+// all the categories of the project for Retry-After seconds (60 seconds if there is no Retry-After header).
+func (rl *RateLimits) Update(projectId string, statusCode int, headers http.Header, now time.Time) {
+	var limits map[string]time.Time
+	if rateLimits := headers.Get("X-Sentry-Rate-Limits"); len(rateLimits) > 0 {
+		limits = parseRateLimits(rateLimits, now)
+	} else if statusCode == http.StatusTooManyRequests {
+		limits = map[string]time.Time{"": parseRetryAfter(headers.Get("Retry-After"), now)}
+	}
+	if len(limits) == 0 {
+		return
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	projectLimits, ok := rl.limits[projectId]
+	if !ok {
+		projectLimits = make(map[string]time.Time)
+		rl.limits[projectId] = projectLimits
+	}
+	for category, until := range limits {
+		if until.After(projectLimits[category]) {
+			projectLimits[category] = until
+		}
+	}
+}
+
+// IsLimited returns true if all the categories are rate limited for the project (requests without categories
+// are never limited)
+func (rl *RateLimits) IsLimited(projectId string, categories []string, now time.Time) bool {
+	if len(categories) == 0 {
+		return false
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	projectLimits := rl.limits[projectId]
+	if now.Before(projectLimits[""]) {
+		return true
+	}
+	for _, category := range categories {
+		if !now.Before(projectLimits[category]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRateLimits parses a X-Sentry-Rate-Limits header
+// (e.g. "60:transaction;error:organization, 2700:default:project") into the time until each category is
+// limited ("" is used for all categories)
+func parseRateLimits(header string, now time.Time) map[string]time.Time {
+	retVal := make(map[string]time.Time)
+	for _, limit := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(limit), ":")
+		retryAfter, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			continue
+		}
+		until := now.Add(time.Duration(retryAfter * float64(time.Second)))
+		categories := []string{""}
+		if len(parts) > 1 && len(parts[1]) > 0 {
+			categories = strings.Split(parts[1], ";")
+		}
+		for _, category := range categories {
+			if until.After(retVal[category]) {
+				retVal[category] = until
+			}
+		}
+	}
+	return retVal
+}
+
+// parseRetryAfter parses a Retry-After header (seconds or an HTTP date)
+func parseRetryAfter(header string, now time.Time) time.Time {
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil {
+		return now.Add(time.Duration(seconds * float64(time.Second)))
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return date
+	}
+	return now.Add(defaultRetryAfter)
+}
+
+// itemCategories the data categories of the envelope items (internal items are never rate limited)
+var itemCategories = map[string]string{
+	"event":            "error",
+	"transaction":      "transaction",
+	"attachment":       "attachment",
+	"session":          "session",
+	"sessions":         "session",
+	"profile":          "profile",
+	"replay_event":     "replay",
+	"replay_recording": "replay",
+	"replay_video":     "replay",
+	"check_in":         "monitor",
+	"span":             "span",
+	"log":              "log_item",
+	"feedback":         "feedback",
+	"statsd":           "metric_bucket",
+	"metric_buckets":   "metric_bucket",
+	"client_report":    "",
+}
+
+// requestCategories returns the data categories of the payload of a request
+func requestCategories(tgt *vegeta.Target) []string {
+	switch {
+	case strings.HasSuffix(tgt.URL, "/envelope/"):
+		return envelopeCategories(tgt.Body)
+	case strings.HasSuffix(tgt.URL, "/store/"):
+		var event struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(tgt.Body, &event) == nil && event.Type == "transaction" {
+			return []string{"transaction"}
+		}
+		return []string{"error"}
+	case strings.Contains(tgt.URL, "/minidump/"):
+		return []string{"error"}
+	case strings.Contains(tgt.URL, "/security/"):
+		return []string{"security"}
+	case strings.Contains(tgt.URL, "/otlp/"):
+		return []string{"span"}
+	default:
+		return []string{"default"}
+	}
+}
+
+// envelopeCategories returns the data categories of the items of an envelope
+func envelopeCategories(envelope []byte) []string {
+	retVal := make([]string, 0, 1)
+	for _, item := range parseEnvelope(envelope) {
+		category, known := itemCategories[item.header.Type]
+		if !known {
+			category = "default"
+		}
+		if len(category) > 0 {
+			retVal = append(retVal, category)
+		}
+	}
+	return retVal
+}
+
+// envelopeItemHeader the item header fields used to classify and count the items of an envelope
+type envelopeItemHeader struct {
+	Type      string `json:"type"`
+	Length    int    `json:"length"`
+	ItemCount int    `json:"item_count"`
+}
+
+// envelopeItem an item of an envelope
+type envelopeItem struct {
+	header  envelopeItemHeader
+	payload []byte
+}
+
+// parseEnvelope splits an envelope into its items, the items must have a length header (the way
+// utils.EnvelopeFromItems creates them), parsing stops at the first invalid item
+func parseEnvelope(envelope []byte) []envelopeItem {
+	retVal := make([]envelopeItem, 0, 1)
+	lineEnd := bytes.IndexByte(envelope, '\n')
+	if lineEnd < 0 {
+		return retVal
+	}
+	rest := envelope[lineEnd+1:]
+	for len(bytes.TrimSpace(rest)) > 0 {
+		lineEnd = bytes.IndexByte(rest, '\n')
+		if lineEnd < 0 {
+			break
+		}
+		var itemHeader envelopeItemHeader
+		if err := json.Unmarshal(rest[:lineEnd], &itemHeader); err != nil || itemHeader.Length > len(rest)-lineEnd-1 {
+			break
+		}
+		payloadStart := lineEnd + 1
+		retVal = append(retVal, envelopeItem{
+			header:  itemHeader,
+			payload: rest[payloadStart : payloadStart+itemHeader.Length],
+		})
+		rest = rest[payloadStart+itemHeader.Length:]
+		if len(rest) > 0 && rest[0] == '\n' {
+			rest = rest[1:]
+		}
+	}
+	return retVal
+}
+
+// countEnvelopeItems returns the number of items of the specified type in an envelope (all the items for an
+// empty type), the item_count header is used for the items that batch several units
+func countEnvelopeItems(envelope []byte, itemType string) uint64 {
+	var retVal uint64
+	for _, item := range parseEnvelope(envelope) {
+		if len(itemType) > 0 && item.header.Type != itemType {
+			continue
+		}
+		if item.header.ItemCount > 0 {
+			retVal += uint64(item.header.ItemCount)
+		} else {
+			retVal++
+		}
+	}
+	return retVal
+}
+
+// projectIdFromUrl extracts the project id from the URL of an ingestion request (/api/{id}/...)
+func projectIdFromUrl(path string) string {
+	idx := strings.Index(path, "/api/")
+	if idx < 0 {
+		return ""
+	}
+	path = path[idx+len("/api/"):]
+	if end := strings.IndexByte(path, '/'); end >= 0 {
+		path = path[:end]
+	}
+	return path
+}
+
+// rateLimitRoundTripper updates the rate limits from the responses and drops the suppressed requests
+type rateLimitRoundTripper struct {
+	next   http.RoundTripper
+	limits *RateLimits
+}
+
+func (rt rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get(suppressedHeader)) > 0 {
+		return nil, ErrRateLimited
+	}
+	resp, err := rt.next.RoundTrip(req)
+	if err == nil {
+		rt.limits.Update(projectIdFromUrl(req.URL.Path), resp.StatusCode, resp.Header, time.Now())
+	}
+	return resp, err
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	now := getNow()
+	limits := parseRateLimits("60:transaction;error:organization, 2700:default:project, 10::key, invalid", now)
+	expected := map[string]time.Time{
+		"transaction": now.Add(time.Minute),
+		"error":       now.Add(time.Minute),
+		"default":     now.Add(2700 * time.Second),
+		"":            now.Add(10 * time.Second),
+	}
+	if diff := cmp.Diff(expected, limits); diff != "" {
+		t.Errorf("unexpected limits (-expected +actual):\n%s", diff)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	now := getNow()
+	limits := NewRateLimits()
+	limits.Update("1", http.StatusTooManyRequests, http.Header{"X-Sentry-Rate-Limits": {"60:error:project"}}, now)
+	limits.Update("2", http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}}, now)
+	limits.Update("3", http.StatusTooManyRequests, http.Header{}, now)
+	limits.Update("4", http.StatusOK, http.Header{}, now)
+
+	testCases := []struct {
+		projectId  string
+		categories []string
+		after      time.Duration
+		limited    bool
+	}{
+		{"1", []string{"error"}, time.Second, true},
+		{"1", []string{"error", "attachment"}, time.Second, false},
+		{"1", []string{"transaction"}, time.Second, false},
+		{"1", []string{"error"}, time.Minute, false},
+		{"2", []string{"session"}, 29 * time.Second, true},
+		{"2", []string{"session"}, 30 * time.Second, false},
+		{"3", []string{"span"}, 59 * time.Second, true},
+		{"3", []string{}, time.Second, false},
+		{"4", []string{"error"}, time.Second, false},
+	}
+	for _, testCase := range testCases {
+		if limited := limits.IsLimited(testCase.projectId, testCase.categories, now.Add(testCase.after)); limited != testCase.limited {
+			t.Errorf("project %s %v after %s expected limited=%v", testCase.projectId, testCase.categories,
+				testCase.after, testCase.limited)
+		}
+	}
+}
+
+func TestRequestCategories(t *testing.T) {
+	buff, err := utils.EnvelopeFromItems("", time.Now(), nil,
+		utils.EnvelopeItem{Type: "transaction", Payload: []byte("{}")},
+		utils.EnvelopeItem{Type: "profile", Payload: []byte("{\n}")},
+		utils.EnvelopeItem{Type: "client_report", Payload: []byte("{}")},
+		utils.EnvelopeItem{Type: "something", Payload: []byte("{}")})
+	if err != nil {
+		t.Fatalf("could not create envelope: %v", err)
+	}
+	tgt := vegeta.Target{URL: "http://relay/api/42/envelope/", Body: buff.Bytes()}
+	if diff := cmp.Diff([]string{"transaction", "profile", "default"}, requestCategories(&tgt)); diff != "" {
+		t.Errorf("unexpected categories (-expected +actual):\n%s", diff)
+	}
+	tgt = vegeta.Target{URL: "http://relay/api/42/store/", Body: []byte(`{"type":"transaction"}`)}
+	if diff := cmp.Diff([]string{"transaction"}, requestCategories(&tgt)); diff != "" {
+		t.Errorf("unexpected categories (-expected +actual):\n%s", diff)
+	}
+	if projectId := projectIdFromUrl("/api/42/envelope/"); projectId != "42" {
+		t.Errorf("expected project 42 got %s", projectId)
+	}
+}
+
+func TestTargetUnits(t *testing.T) {
+	sessionParams := `{"startedRange":"1m","durationRange":"1m","numReleases":2,"numEnvironments":2,"numUsers":10,"okWeight":1}`
+	testCases := []struct {
+		name    string
+		builder LoadTesterBuilder
+		params  string
+	}{
+		{"attachment", newAttachmentLoadTester, `{"attachmentsPerEnvelope":3,"attachToError":true,"minidumpRatio":0.3}`},
+		{"checkIn", newCheckInLoadTester, `{}`},
+		{"clientReport", newClientReportLoadTester, `{}`},
+		{"distributedTrace", newDistributedTraceLoadTester, `{}`},
+		{"error", newErrorLoadTester, `{}`},
+		{"feedback", newFeedbackLoadTester, `{}`},
+		{"log", newLogLoadTester, `{}`},
+		{"metricBucket", newMetricsBucketLoadTester, `{"numProjects":1}`},
+		{"metricBucket statsd", newMetricsBucketLoadTester, `{"numProjects":1,"format":"statsd"}`},
+		{"mixedEnvelope", newMixedEnvelopeLoadTester, `{}`},
+		{"otlpTraces", newOtlpTracesLoadTester, `{}`},
+		{"otlpTraces json", newOtlpTracesLoadTester, `{"encoding":"json"}`},
+		{"profile", newProfileLoadTester, `{}`},
+		{"replay", newReplayLoadTester, `{}`},
+		{"securityReport", newSecurityReportLoadTester, `{}`},
+		{"session", newSessionLoadTester, sessionParams},
+		{"session aggregates", newSessionLoadTester, strings.Replace(sessionParams, "{", `{"aggregates":true,"bucketsPerEnvelope":5,`, 1)},
+		{"span", newSpanLoadTester, `{}`},
+		{"transaction", newTransactionLoadTester, `{"numProjects":1,"maxSpans":5,"transactionDurationMax":"1s"}`},
+	}
+	for _, testCase := range testCases {
+		loadTester := testCase.builder("http://relay", json.RawMessage(testCase.params))
+		targeter, _ := loadTester.GetTargeter()
+		var units uint64
+		for idx := 0; idx < 20; idx++ {
+			var tgt vegeta.Target
+			if err := targeter(&tgt); err != nil {
+				t.Fatalf("%s could not create target: %v", testCase.name, err)
+			}
+			units += GetTargetUnits(loadTester, &tgt)
+		}
+		if _, expected := GetPayloadUnits(loadTester, 20); units != expected {
+			t.Errorf("%s expected the units of the requests to add up to %d got %d", testCase.name, expected, units)
+		}
+	}
+}
+
+func TestSentryTransportRateLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Sentry-Rate-Limits", "60:error:project")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	builder := sentryTransportBuilder(newErrorLoadTester)
+	loadTester := builder(server.URL, json.RawMessage(`{"numProjects":1,"respectRateLimits":true}`))
+	client := http.Client{Transport: loadTester.(RoundTripperWrapper).WrapRoundTripper(http.DefaultTransport)}
+	targeter, _ := loadTester.GetTargeter()
+
+	send := func() *vegeta.Result {
+		var tgt vegeta.Target
+		if err := targeter(&tgt); err != nil {
+			t.Fatalf("could not create target: %v", err)
+		}
+		req, err := tgt.Request()
+		if err != nil {
+			t.Fatalf("invalid target: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return &vegeta.Result{Error: err.Error()}
+		}
+		_ = resp.Body.Close()
+		return &vegeta.Result{Code: uint16(resp.StatusCode)}
+	}
+
+	if result := send(); result.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the first request to be sent got %+v", result)
+	}
+	if result := send(); !IsSuppressed(result) {
+		t.Errorf("expected the second request to be suppressed got %+v", result)
+	}
+	if requests, units := GetSuppressed(loadTester); requests != 1 || units != 1 {
+		t.Errorf("expected one suppressed event got %d requests %d units", requests, units)
+	}
+	if _, units := GetPayloadUnits(loadTester, 2); units != 1 {
+		t.Errorf("expected one event sent got %d", units)
+	}
+}
@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// RelayRegisterJob is how a relay registration load test is parameterized
+//
+// Each virtual relay (with its own generated key pair) goes through the registration handshake with the
+// upstream: it requests a challenge (/api/0/relays/register/challenge/) and then sends the challenge token back
+// (/api/0/relays/register/response/). All the virtual relays start unregistered (as if they were all restarted
+// at once) and a registered relay restarts and registers again.
+// example:
+// ```json
+// {
+//  "numRelays": 5000,
+//  "relayVersion": "24.1.0"
+// }
+// ```
+type RelayRegisterJob struct {
+	// NumRelays the number of virtual relays registering (default 1)
+	NumRelays int `json:"numRelays" yaml:"numRelays"`
+	// RelayVersion the version reported by the virtual relays (default 24.1.0)
+	RelayVersion string `json:"relayVersion,omitempty" yaml:"relayVersion,omitempty"`
+}
+
+// registerChallengeRequest the body of a register challenge request
+type registerChallengeRequest struct {
+	RelayId   string `json:"relay_id"`
+	PublicKey string `json:"public_key"`
+	Version   string `json:"version"`
+}
+
+// registerResponseRequest the body of a register response request
+type registerResponseRequest struct {
+	RelayId string `json:"relay_id"`
+	Token   string `json:"token"`
+	Version string `json:"version"`
+}
+
+// registerResult the body of the responses to the register requests (the token is only sent with the challenge)
+type registerResult struct {
+	RelayId string `json:"relay_id"`
+	Token   string `json:"token"`
+}
+
+// registeringRelay is a virtual relay going through the registration handshake
+type registeringRelay struct {
+	id         string
+	publicKey  string
+	privateKey ed25519.PrivateKey
+	// token the challenge token to be sent back (an empty token means the relay needs a new challenge)
+	token string
+}
+
+// relayRegisterLoadTester is used to drive a relay registration load test
+type relayRegisterLoadTester struct {
+	PayloadCounter
+	url              string
+	relayRegisterJob RelayRegisterJob
+	relays           []registeringRelay
+	relaysById       map[string]*registeringRelay
+	// the index of the last relay that sent a request
+	relayIdx uint64
+	// lock to be used when manipulating the tokens of the relays
+	lock sync.Mutex
+}
+
+func newRelayRegisterLoadTester(url string, rawRelayRegister json.RawMessage) LoadTester {
+	var relayRegisterParams RelayRegisterJob
+	err := json.Unmarshal(rawRelayRegister, &relayRegisterParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid relayRegister params received\nraw data\n%s", rawRelayRegister)
+	}
+	relayRegisterParams = relayRegisterJobWithDefaults(relayRegisterParams)
+	log.Trace().Msgf("RelayRegister generation for:\n%+v", relayRegisterParams)
+
+	retVal := &relayRegisterLoadTester{
+		PayloadCounter:   NewPayloadCounter(PayloadRegistrations),
+		url:              strings.TrimSuffix(url, "/"),
+		relayRegisterJob: relayRegisterParams,
+		relays:           make([]registeringRelay, 0, relayRegisterParams.NumRelays),
+		relaysById:       make(map[string]*registeringRelay, relayRegisterParams.NumRelays),
+	}
+	for idx := 0; idx < relayRegisterParams.NumRelays; idx++ {
+		relay, err := newRegisteringRelay()
+		if err != nil {
+			log.Error().Err(err).Msg("could not create virtual relay")
+			continue
+		}
+		retVal.relays = append(retVal.relays, relay)
+	}
+	for idx := range retVal.relays {
+		retVal.relaysById[retVal.relays[idx].id] = &retVal.relays[idx]
+	}
+	return retVal
+}
+
+// newRegisteringRelay creates a virtual relay with a new key pair
+func newRegisteringRelay() (registeringRelay, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return registeringRelay{}, err
+	}
+	return registeringRelay{
+		id:         uuid.New().String(),
+		publicKey:  base64.RawURLEncoding.EncodeToString(publicKey),
+		privateKey: privateKey,
+	}, nil
+}
+
+func (rlt *relayRegisterLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	var version = rlt.relayRegisterJob.RelayVersion
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+		if len(rlt.relays) == 0 {
+			return fmt.Errorf("no virtual relays available")
+		}
+
+		relay := &rlt.relays[atomic.AddUint64(&rlt.relayIdx, 1)%uint64(len(rlt.relays))]
+		token := rlt.takeToken(relay)
+
+		var body []byte
+		var err error
+		if len(token) == 0 {
+			tgt.URL = fmt.Sprintf("%s/api/0/relays/register/challenge/", rlt.url)
+			body, err = json.Marshal(registerChallengeRequest{RelayId: relay.id, PublicKey: relay.publicKey, Version: version})
+		} else {
+			tgt.URL = fmt.Sprintf("%s/api/0/relays/register/response/", rlt.url)
+			body, err = json.Marshal(registerResponseRequest{RelayId: relay.id, Token: token, Version: version})
+		}
+		if err != nil {
+			return err
+		}
+		signature, err := utils.RelayAuthSign(relay.privateKey, body, time.Now().UTC())
+		if err != nil {
+			log.Error().Err(err).Msg("Could not sign request")
+			return err
+		}
+
+		tgt.Method = "POST"
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("Content-Type", "application/json")
+		tgt.Header.Set("X-Sentry-Relay-Id", relay.id)
+		tgt.Header.Set("X-Sentry-Relay-Signature", signature)
+		tgt.Body = body
+		log.Trace().Msgf("Registering relay:%s", relay.id)
+		return nil
+	}, 0
+}
+
+// ProcessResult keeps the challenge tokens (to be sent back by the relays) and counts the completed registrations
+func (rlt *relayRegisterLoadTester) ProcessResult(result *vegeta.Result, _ uint64) {
+	if result == nil || result.Code != http.StatusOK {
+		return // the relay will ask for a new challenge
+	}
+	var registerResponse registerResult
+	if err := json.Unmarshal(result.Body, &registerResponse); err != nil {
+		return
+	}
+	relay, ok := rlt.relaysById[registerResponse.RelayId]
+	if !ok {
+		return
+	}
+	if len(registerResponse.Token) > 0 {
+		rlt.lock.Lock()
+		relay.token = registerResponse.Token
+		rlt.lock.Unlock()
+	} else {
+		// the relay is registered, it restarts with a new challenge
+		rlt.AddUnits(1)
+	}
+}
+
+// takeToken returns the challenge token of a relay (an empty string if the relay needs a new challenge)
+func (rlt *relayRegisterLoadTester) takeToken(relay *registeringRelay) string {
+	rlt.lock.Lock()
+	defer rlt.lock.Unlock()
+	token := relay.token
+	relay.token = ""
+	return token
+}
+
+// relayRegisterJobWithDefaults fills in the defaults for the parameters that were not specified
+func relayRegisterJobWithDefaults(job RelayRegisterJob) RelayRegisterJob {
+	if job.NumRelays <= 0 {
+		job.NumRelays = 1
+	}
+	if len(job.RelayVersion) == 0 {
+		job.RelayVersion = "24.1.0"
+	}
+	return job
+}
+
+// relayRegisterLoadSplitter divides the load for each worker by:
+// 	* dividing the number of total calls per worker
+// 	* dividing the relays per worker (each worker drives its own relays)
+func relayRegisterLoadSplitter(masterParams TestParams, numWorkers int) ([]TestParams, error) {
+	if numWorkers <= 0 {
+		return nil, fmt.Errorf("invalid number of workers %d need at least 1", numWorkers)
+	}
+	// divide attack intensity among workers
+	newParams := masterParams
+	newParams.Per = time.Duration(numWorkers) * masterParams.Per
+	var relayRegisterJob RelayRegisterJob
+	err := json.Unmarshal(masterParams.Params, &relayRegisterJob)
+	if err != nil {
+		log.Error().Err(err).Msg("error unmarshalling relayRegisterJob")
+		return nil, err
+	}
+	relayRegisterJob = relayRegisterJobWithDefaults(relayRegisterJob)
+	if relayRegisterJob.NumRelays < numWorkers {
+		return nil, fmt.Errorf("not enough relays (%d) for %d workers", relayRegisterJob.NumRelays, numWorkers)
+	}
+	splitRelays, err := utils.Divide(relayRegisterJob.NumRelays, numWorkers)
+	if err != nil {
+		log.Error().Err(err).Msg("error splitting the number of relays among workers")
+		return nil, err
+	}
+	retVal := make([]TestParams, 0, numWorkers)
+	for idx := 0; idx < numWorkers; idx++ {
+		// distribute the relays among the workers
+		relayRegisterJob.NumRelays = splitRelays[idx]
+		newParams.Params, err = json.Marshal(relayRegisterJob)
+		if err != nil {
+			return nil, err
+		}
+		retVal = append(retVal, newParams)
+	}
+	return retVal, nil
+}
+
+func init() {
+	RegisterTestType("relayRegister", newRelayRegisterLoadTester, relayRegisterLoadSplitter)
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+// verifyRelaySignature checks the signature of a request signed by a relay
+func verifyRelaySignature(t *testing.T, tgt vegeta.Target, publicKey string) {
+	parts := strings.Split(tgt.Header.Get("X-Sentry-Relay-Signature"), ".")
+	if len(parts) != 2 {
+		t.Fatalf("invalid signature %s", tgt.Header.Get("X-Sentry-Relay-Signature"))
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	header, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	key, _ := base64.RawURLEncoding.DecodeString(publicKey)
+	message := append(append(header, '\x00'), tgt.Body...)
+	if !ed25519.Verify(key, message, signature) {
+		t.Errorf("the signature does not match the body of the request")
+	}
+}
+
+func TestRelayRegisterHandshake(t *testing.T) {
+	loadTester := newRelayRegisterLoadTester("http://sentry/", json.RawMessage(`{"numRelays":2}`)).(*relayRegisterLoadTester)
+	targeter, _ := loadTester.GetTargeter()
+
+	// every relay starts with a challenge
+	challenges := make(map[string]registerChallengeRequest)
+	for idx := 0; idx < 2; idx++ {
+		var tgt vegeta.Target
+		if err := targeter(&tgt); err != nil {
+			t.Fatalf("could not create target: %v", err)
+		}
+		if tgt.URL != "http://sentry/api/0/relays/register/challenge/" {
+			t.Errorf("expected a challenge request got %s", tgt.URL)
+		}
+		var challenge registerChallengeRequest
+		if err := json.Unmarshal(tgt.Body, &challenge); err != nil {
+			t.Fatalf("invalid challenge request: %v", err)
+		}
+		if challenge.RelayId != tgt.Header.Get("X-Sentry-Relay-Id") || challenge.Version != "24.1.0" {
+			t.Errorf("invalid challenge request %+v", challenge)
+		}
+		verifyRelaySignature(t, tgt, challenge.PublicKey)
+		challenges[challenge.RelayId] = challenge
+	}
+	if len(challenges) != 2 {
+		t.Fatalf("expected a challenge from each relay got %d", len(challenges))
+	}
+
+	// the token of the challenge is sent back
+	for relayId := range challenges {
+		loadTester.ProcessResult(&vegeta.Result{Code: 200,
+			Body: []byte(`{"relay_id":"` + relayId + `","token":"token-` + relayId + `"}`)}, 0)
+	}
+	for idx := 0; idx < 2; idx++ {
+		var tgt vegeta.Target
+		if err := targeter(&tgt); err != nil {
+			t.Fatalf("could not create target: %v", err)
+		}
+		if tgt.URL != "http://sentry/api/0/relays/register/response/" {
+			t.Errorf("expected a response request got %s", tgt.URL)
+		}
+		var response registerResponseRequest
+		if err := json.Unmarshal(tgt.Body, &response); err != nil {
+			t.Fatalf("invalid response request: %v", err)
+		}
+		if response.Token != "token-"+response.RelayId {
+			t.Errorf("unexpected token %s for relay %s", response.Token, response.RelayId)
+		}
+		verifyRelaySignature(t, tgt, challenges[response.RelayId].PublicKey)
+		loadTester.ProcessResult(&vegeta.Result{Code: 200, Body: []byte(`{"relay_id":"` + response.RelayId + `"}`)}, 0)
+	}
+	if _, registrations := loadTester.PayloadUnits(); registrations != 2 {
+		t.Errorf("expected 2 registrations got %d", registrations)
+	}
+
+	// registered relays restart
+	var tgt vegeta.Target
+	if err := targeter(&tgt); err != nil {
+		t.Fatalf("could not create target: %v", err)
+	}
+	if !strings.HasSuffix(tgt.URL, "/challenge/") {
+		t.Errorf("expected the relay to restart with a challenge got %s", tgt.URL)
+	}
+}
+
+func TestRelayRegisterLoadSplitter(t *testing.T) {
+	params := TestParams{Params: json.RawMessage(`{"numRelays":5}`)}
+	split, err := relayRegisterLoadSplitter(params, 2)
+	if err != nil {
+		t.Fatalf("could not split the load: %v", err)
+	}
+	total := 0
+	for _, workerParams := range split {
+		var job RelayRegisterJob
+		if err = json.Unmarshal(workerParams.Params, &job); err != nil {
+			t.Fatalf("invalid worker params: %v", err)
+		}
+		total += job.NumRelays
+	}
+	if total != 5 {
+		t.Errorf("expected the 5 relays to be split among the workers got %d", total)
+	}
+	if _, err = relayRegisterLoadSplitter(params, 6); err == nil {
+		t.Errorf("expected an error for more workers than relays")
+	}
+}
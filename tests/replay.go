@@ -0,0 +1,351 @@
+package tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// ReplayJob is how a session replay load test is parameterized
+//
+// Every request sends a segment (a replay_event and a compressed replay_recording) of one of the
+// replays in progress, replays are kept in progress until all their segments are sent (the way a
+// browser SDK sends a segment every few seconds for as long as the session lasts).
+// The segments of a replay are sent segmentInterval apart, a new replay is started only when no replay in
+// progress is due to send a segment (if maxActiveReplays are in progress the segment of the replay that is due
+// first is sent early, so the attack rate should be about maxActiveReplays/segmentInterval).
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "maxActiveReplays": 1000,
+//  "minSegments": 1,
+//  "maxSegments": 20,
+//  "segmentInterval": "5s",
+//  "minSegmentSize": 2000,
+//  "maxSegmentSize": 100000,
+//  "numReleases": 10,
+//  "numEnvironments": 2,
+//  "numUsers": 1000
+// }
+// ```
+type ReplayJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// MaxActiveReplays the maximum number of replays in progress (per worker), new replays are started until the limit is reached (default 100)
+	MaxActiveReplays int `json:"maxActiveReplays,omitempty" yaml:"maxActiveReplays,omitempty"`
+	// MinSegments the minimum number of segments sent for a replay (default 1)
+	MinSegments int `json:"minSegments,omitempty" yaml:"minSegments,omitempty"`
+	// MaxSegments the maximum number of segments sent for a replay (default 10)
+	MaxSegments int `json:"maxSegments,omitempty" yaml:"maxSegments,omitempty"`
+	// SegmentInterval the time between two segments of a replay (default 5s)
+	SegmentInterval utils.StringDuration `json:"segmentInterval,omitempty" yaml:"segmentInterval,omitempty"`
+	// MinSegmentSize the minimum size of a recording segment in bytes, before compression (default 5000)
+	MinSegmentSize int `json:"minSegmentSize,omitempty" yaml:"minSegmentSize,omitempty"`
+	// MaxSegmentSize the maximum size of a recording segment in bytes, before compression (default 50000)
+	MaxSegmentSize int `json:"maxSegmentSize,omitempty" yaml:"maxSegmentSize,omitempty"`
+	// NumReleases specifies the maximum number of unique releases generated in a test
+	NumReleases uint64 `json:"numReleases,omitempty" yaml:"numReleases,omitempty"`
+	// NumEnvironments specifies the number of unique environments generated in a test
+	NumEnvironments int `json:"numEnvironments,omitempty" yaml:"numEnvironments,omitempty"`
+	// NumUsers specifies the maximum number of unique users generated in a test
+	NumUsers uint64 `json:"numUsers,omitempty" yaml:"numUsers,omitempty"`
+}
+
+// ReplayEvent defines the JSON format of a replay_event item
+type ReplayEvent struct {
+	Type                 string   `json:"type"`
+	ReplayId             string   `json:"replay_id"`
+	EventId              string   `json:"event_id"`
+	SegmentId            int      `json:"segment_id"`
+	ReplayType           string   `json:"replay_type"`
+	Timestamp            float64  `json:"timestamp"`
+	ReplayStartTimestamp float64  `json:"replay_start_timestamp"`
+	Platform             string   `json:"platform"`
+	Release              string   `json:"release,omitempty"`
+	Environment          string   `json:"environment,omitempty"`
+	Urls                 []string `json:"urls"`
+	ErrorIds             []string `json:"error_ids"`
+	TraceIds             []string `json:"trace_ids"`
+	User                 User     `json:"user,omitempty"`
+}
+
+// replayState is a replay in progress
+type replayState struct {
+	replayId    string
+	projectId   string
+	projectKey  string
+	started     time.Time
+	release     string
+	environment string
+	user        User
+	url         string
+	numSegments int
+	nextSegment int
+	// nextSend when the next segment is due
+	nextSend time.Time
+}
+
+// replayQueue is a priority queue of the replays in progress (ordered by the time their next segment is due)
+type replayQueue []*replayState
+
+func (q replayQueue) Len() int            { return len(q) }
+func (q replayQueue) Less(i, j int) bool  { return q[i].nextSend.Before(q[j].nextSend) }
+func (q replayQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *replayQueue) Push(x interface{}) { *q = append(*q, x.(*replayState)) }
+func (q *replayQueue) Pop() interface{} {
+	old := *q
+	retVal := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return retVal
+}
+
+// replayLoadTester is used to drive a replay load test
+type replayLoadTester struct {
+	PayloadCounter
+	url         string
+	replayJob   ReplayJob
+	lock        sync.Mutex
+	replays     replayQueue
+	idGen       func() string
+	relGen      func() string
+	userGen     func() User
+	contentSize func() int
+}
+
+func newReplayLoadTester(url string, rawReplay json.RawMessage) LoadTester {
+	var replayParams ReplayJob
+	err := json.Unmarshal(rawReplay, &replayParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid replay params received\nraw data\n%s", rawReplay)
+	}
+	replayParams = replayJobWithDefaults(replayParams)
+	log.Trace().Msgf("Replay generation for:\n%+v", replayParams)
+
+	minSize := replayParams.MinSegmentSize
+	maxSize := replayParams.MaxSegmentSize
+	return &replayLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadSegments),
+		url:            url,
+		replayJob:      replayParams,
+		idGen:          EventIdGenerator(),
+		relGen:         ReleaseGenerator(replayParams.NumReleases),
+		userGen:        UserGenerator(replayParams.NumUsers),
+		contentSize: func() int {
+			return minSize + rand.Intn(maxSize-minSize+1)
+		},
+	}
+}
+
+func (rlt *replayLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		replay, segmentId := rlt.nextSegment(time.Now())
+
+		tgt.Method = "POST"
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", rlt.url, replay.projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(replay.projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		body, err := getReplaySegmentBody(replay, segmentId, rlt.contentSize())
+		if err != nil {
+			return err
+		}
+		tgt.Body = body
+		rlt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", replay.projectId)
+		return nil
+	}, 0
+}
+
+func (rlt *replayLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// nextSegment picks the replay in progress that is due to send a segment (starting a new one if no replay is
+// due and there is room for it) and returns it together with the id of the segment to send
+func (rlt *replayLoadTester) nextSegment(now time.Time) (*replayState, int) {
+	rlt.lock.Lock()
+	defer rlt.lock.Unlock()
+
+	due := len(rlt.replays) > 0 && !rlt.replays[0].nextSend.After(now)
+	if !due && len(rlt.replays) < rlt.replayJob.MaxActiveReplays {
+		// a new replay is due now, it becomes the first in the queue
+		replay := rlt.newReplay()
+		replay.nextSend = now
+		heap.Push(&rlt.replays, replay)
+	}
+	replay := rlt.replays[0]
+	segmentId := replay.nextSegment
+	replay.nextSegment++
+	if replay.nextSegment >= replay.numSegments {
+		// last segment, the replay is done, make room for a new one
+		heap.Pop(&rlt.replays)
+	} else {
+		replay.nextSend = now.Add(time.Duration(rlt.replayJob.SegmentInterval))
+		heap.Fix(&rlt.replays, 0)
+	}
+	return replay, segmentId
+}
+
+// newReplay starts a new replay (must be called with the lock held)
+func (rlt *replayLoadTester) newReplay() *replayState {
+	job := rlt.replayJob
+	projectProvider := utils.GetProjectProvider()
+	projectId := projectProvider.GetProjectId(job.NumProjects)
+	projectInfo := projectProvider.GetProjectInfo(projectId)
+	replayId := rlt.idGen()
+	return &replayState{
+		replayId:    replayId,
+		projectId:   projectId,
+		projectKey:  projectInfo.ProjectKey,
+		started:     time.Now().UTC(),
+		release:     rlt.relGen(),
+		environment: fmt.Sprintf("environment%d", rand.Intn(job.NumEnvironments)),
+		user:        rlt.userGen(),
+		url:         fmt.Sprintf("https://app.example.com/page%d", rand.Intn(100)),
+		numSegments: job.MinSegments + rand.Intn(job.MaxSegments-job.MinSegments+1),
+	}
+}
+
+// getReplaySegmentBody creates an envelope with the replay_event and replay_recording items of a segment
+func getReplaySegmentBody(replay *replayState, segmentId int, contentSize int) ([]byte, error) {
+	now := time.Now().UTC()
+	var urls []string
+	if segmentId == 0 {
+		urls = []string{replay.url}
+	}
+	event := ReplayEvent{
+		Type:                 "replay_event",
+		ReplayId:             replay.replayId,
+		EventId:              replay.replayId,
+		SegmentId:            segmentId,
+		ReplayType:           "session",
+		Timestamp:            toUnixTimestamp(now),
+		ReplayStartTimestamp: toUnixTimestamp(replay.started),
+		Platform:             "javascript",
+		Release:              replay.release,
+		Environment:          replay.environment,
+		Urls:                 urls,
+		ErrorIds:             []string{},
+		TraceIds:             []string{},
+		User:                 replay.user,
+	}
+	eventBody, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	recording, err := ReplayRecording(segmentId, replay.url, now, contentSize)
+	if err != nil {
+		return nil, err
+	}
+	buff, err := utils.EnvelopeFromItems(replay.replayId, now, map[string]string{"public_key": replay.projectKey},
+		utils.EnvelopeItem{Type: "replay_event", Payload: eventBody},
+		utils.EnvelopeItem{Type: "replay_recording", Payload: recording},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// ReplayRecording creates the payload of a replay_recording item: a JSON header with the segment id
+// followed by the zlib compressed rrweb events of the segment (about contentSize bytes before compression)
+func ReplayRecording(segmentId int, url string, timestamp time.Time, contentSize int) ([]byte, error) {
+	var buff bytes.Buffer
+	header, err := json.Marshal(map[string]int{"segment_id": segmentId})
+	if err != nil {
+		return nil, err
+	}
+	buff.Write(header)
+	buff.WriteByte('\n')
+
+	writer := zlib.NewWriter(&buff)
+	if _, err = writer.Write(rrwebEvents(segmentId, url, timestamp, contentSize)); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// rrwebEvents generates a JSON list of rrweb events of about contentSize bytes
+//
+// The first segment of a replay starts with a meta event (the way browser SDKs do), the rest of the
+// content is made of incremental DOM mutations.
+func rrwebEvents(segmentId int, url string, timestamp time.Time, contentSize int) []byte {
+	ts := timestamp.UnixNano() / int64(time.Millisecond)
+	events := make([]string, 0)
+	size := 2
+	if segmentId == 0 {
+		meta := fmt.Sprintf(`{"type":4,"timestamp":%d,"data":{"href":"%s","width":1280,"height":800}}`, ts, url)
+		events = append(events, meta)
+		size += len(meta)
+	}
+	for nodeId := 1; size < contentSize; nodeId++ {
+		mutation := fmt.Sprintf(`{"type":3,"timestamp":%d,"data":{"source":0,"texts":[],"attributes":[],"removes":[],"adds":[{"parentId":%d,"nextId":null,"node":{"type":3,"textContent":"%s","id":%d}}]}}`,
+			ts, rand.Intn(nodeId), strings.Repeat("lorem ipsum ", 1+rand.Intn(10)), nodeId)
+		if len(events) > 0 {
+			size++ // the separator
+		}
+		events = append(events, mutation)
+		size += len(mutation)
+	}
+	return []byte("[" + strings.Join(events, ",") + "]")
+}
+
+// replayJobWithDefaults fills in the defaults for the parameters that were not specified
+func replayJobWithDefaults(job ReplayJob) ReplayJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.MaxActiveReplays <= 0 {
+		job.MaxActiveReplays = 100
+	}
+	if job.MinSegments <= 0 {
+		job.MinSegments = 1
+	}
+	if job.MaxSegments <= 0 {
+		job.MaxSegments = 10
+	}
+	if job.MaxSegments < job.MinSegments {
+		job.MaxSegments = job.MinSegments
+	}
+	if job.SegmentInterval <= 0 {
+		job.SegmentInterval = utils.StringDuration(5 * time.Second)
+	}
+	if job.MinSegmentSize <= 0 {
+		job.MinSegmentSize = 5000
+	}
+	if job.MaxSegmentSize <= 0 {
+		job.MaxSegmentSize = 50000
+	}
+	if job.MaxSegmentSize < job.MinSegmentSize {
+		job.MaxSegmentSize = job.MinSegmentSize
+	}
+	if job.NumEnvironments <= 0 {
+		job.NumEnvironments = 1
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("replay", newReplayLoadTester, nil)
+}
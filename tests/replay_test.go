@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestReplaySegmentsAreSequential(t *testing.T) {
+	loadTester := newReplayLoadTester("http://relay", json.RawMessage(
+		`{"maxActiveReplays":3,"minSegments":2,"maxSegments":5}`)).(*replayLoadTester)
+
+	nextSegment := make(map[string]int)
+	for idx := 0; idx < 100; idx++ {
+		replay, segmentId := loadTester.nextSegment(time.Now())
+		if segmentId != nextSegment[replay.replayId] {
+			t.Fatalf("replay %s expected segment %d got %d", replay.replayId, nextSegment[replay.replayId], segmentId)
+		}
+		nextSegment[replay.replayId] = segmentId + 1
+		if len(loadTester.replays) > 3 {
+			t.Fatalf("expected at most 3 active replays got %d", len(loadTester.replays))
+		}
+	}
+	for _, replay := range loadTester.replays {
+		delete(nextSegment, replay.replayId)
+	}
+	// all replays that are not active anymore sent all their segments
+	for replayId, numSegments := range nextSegment {
+		if numSegments < 2 || numSegments > 5 {
+			t.Errorf("replay %s sent %d segments", replayId, numSegments)
+		}
+	}
+}
+
+func TestReplaySegmentInterval(t *testing.T) {
+	loadTester := newReplayLoadTester("http://relay", json.RawMessage(
+		`{"maxActiveReplays":10,"minSegments":3,"maxSegments":3,"segmentInterval":"1s"}`)).(*replayLoadTester)
+	now := getNow()
+
+	// no replay is due, new replays are started
+	started := make(map[string]bool)
+	for idx := 0; idx < 5; idx++ {
+		replay, segmentId := loadTester.nextSegment(now)
+		if segmentId != 0 || started[replay.replayId] {
+			t.Fatalf("expected a new replay got segment %d of replay %s", segmentId, replay.replayId)
+		}
+		started[replay.replayId] = true
+	}
+	// after the interval the replays in progress send their next segment
+	for idx := 0; idx < 5; idx++ {
+		replay, segmentId := loadTester.nextSegment(now.Add(time.Second))
+		if segmentId != 1 || !started[replay.replayId] {
+			t.Fatalf("expected the second segment of a replay in progress got segment %d", segmentId)
+		}
+	}
+	// the replays are not due again yet
+	if _, segmentId := loadTester.nextSegment(now.Add(time.Second)); segmentId != 0 {
+		t.Errorf("expected a new replay got segment %d", segmentId)
+	}
+	if len(loadTester.replays) != 6 {
+		t.Errorf("expected 6 replays in progress got %d", len(loadTester.replays))
+	}
+}
+
+func TestReplayRecording(t *testing.T) {
+	recording, err := ReplayRecording(3, "https://example.com", time.Now(), 10000)
+	if err != nil {
+		t.Fatalf("could not create recording: %v", err)
+	}
+	headerEnd := bytes.IndexByte(recording, '\n')
+	var header map[string]int
+	if err = json.Unmarshal(recording[:headerEnd], &header); err != nil || header["segment_id"] != 3 {
+		t.Errorf("invalid recording header %s", recording[:headerEnd])
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(recording[headerEnd+1:]))
+	if err != nil {
+		t.Fatalf("recording is not compressed: %v", err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("could not decompress recording: %v", err)
+	}
+	var events []map[string]interface{}
+	if err = json.Unmarshal(content, &events); err != nil {
+		t.Fatalf("invalid rrweb events: %v", err)
+	}
+	if len(content) < 10000 || len(content) > 11000 {
+		t.Errorf("expected about 10000 bytes of recording got %d", len(content))
+	}
+	if len(recording) >= len(content) {
+		t.Errorf("expected the recording to be compressed")
+	}
+}
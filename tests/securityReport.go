@@ -0,0 +1,300 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// SecurityReportJob is how a security report load test is parameterized
+//
+// Security reports are sent by browsers to the security endpoint, authenticated with the sentry_key
+// query parameter. The kind of each report is chosen using the relative weights (if no weight is specified
+// only CSP reports are sent).
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "cspWeight": 90,
+//  "expectCtWeight": 4,
+//  "hpkpWeight": 3,
+//  "expectStapleWeight": 3,
+//  "numBlockedUris": 500,
+//  "numDirectives": 5,
+//  "numDocumentUris": 50,
+//  "numReleases": 10
+// }
+// ```
+type SecurityReportJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// CspWeight the relative weight of Content Security Policy reports
+	CspWeight int64 `json:"cspWeight,omitempty" yaml:"cspWeight,omitempty"`
+	// ExpectCtWeight the relative weight of Expect-CT reports
+	ExpectCtWeight int64 `json:"expectCtWeight,omitempty" yaml:"expectCtWeight,omitempty"`
+	// HpkpWeight the relative weight of HTTP Public Key Pinning reports
+	HpkpWeight int64 `json:"hpkpWeight,omitempty" yaml:"hpkpWeight,omitempty"`
+	// ExpectStapleWeight the relative weight of Expect-Staple reports
+	ExpectStapleWeight int64 `json:"expectStapleWeight,omitempty" yaml:"expectStapleWeight,omitempty"`
+	// NumBlockedUris the number of distinct blocked URIs in CSP reports (default 100)
+	NumBlockedUris int `json:"numBlockedUris,omitempty" yaml:"numBlockedUris,omitempty"`
+	// NumDirectives the number of distinct violated directives in CSP reports (default all the known directives)
+	NumDirectives int `json:"numDirectives,omitempty" yaml:"numDirectives,omitempty"`
+	// NumDocumentUris the number of distinct documents (and hostnames) the reports come from (default 10)
+	NumDocumentUris int `json:"numDocumentUris,omitempty" yaml:"numDocumentUris,omitempty"`
+	// NumReleases the number of distinct releases set on the reports (0 sends no release)
+	NumReleases uint64 `json:"numReleases,omitempty" yaml:"numReleases,omitempty"`
+}
+
+// Kinds of security reports
+const (
+	SecurityReportCsp          = "csp"
+	SecurityReportExpectCt     = "expect_ct"
+	SecurityReportHpkp         = "hpkp"
+	SecurityReportExpectStaple = "expect_staple"
+)
+
+// cspDirectives are the CSP directives (the first numDirectives are used)
+var cspDirectives = []string{"script-src", "style-src", "img-src", "connect-src", "font-src", "frame-src",
+	"media-src", "object-src", "default-src", "worker-src", "manifest-src", "child-src"}
+
+// CspReport defines the JSON format of a CSP violation report
+type CspReport struct {
+	DocumentUri        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	Disposition        string `json:"disposition"`
+	BlockedUri         string `json:"blocked-uri"`
+	StatusCode         int    `json:"status-code"`
+	SourceFile         string `json:"source-file,omitempty"`
+	LineNumber         int    `json:"line-number,omitempty"`
+}
+
+// ExpectCtReport defines the JSON format of an Expect-CT report
+type ExpectCtReport struct {
+	DateTime                  string   `json:"date-time"`
+	Hostname                  string   `json:"hostname"`
+	Port                      int      `json:"port"`
+	EffectiveExpirationDate   string   `json:"effective-expiration-date"`
+	ServedCertificateChain    []string `json:"served-certificate-chain"`
+	ValidatedCertificateChain []string `json:"validated-certificate-chain"`
+	Scts                      []Sct    `json:"scts"`
+}
+
+type Sct struct {
+	Version    int    `json:"version"`
+	Status     string `json:"status"`
+	Source     string `json:"source"`
+	Serialized string `json:"serialized_sct"`
+}
+
+// HpkpReport defines the JSON format of an HTTP Public Key Pinning report
+type HpkpReport struct {
+	DateTime                  string   `json:"date-time"`
+	Hostname                  string   `json:"hostname"`
+	Port                      int      `json:"port"`
+	EffectiveExpirationDate   string   `json:"effective-expiration-date"`
+	IncludeSubdomains         bool     `json:"include-subdomains"`
+	NotedHostname             string   `json:"noted-hostname"`
+	ServedCertificateChain    []string `json:"served-certificate-chain"`
+	ValidatedCertificateChain []string `json:"validated-certificate-chain"`
+	KnownPins                 []string `json:"known-pins"`
+}
+
+// ExpectStapleReport defines the JSON format of an Expect-Staple report
+type ExpectStapleReport struct {
+	DateTime                  string   `json:"date-time"`
+	Hostname                  string   `json:"hostname"`
+	Port                      int      `json:"port"`
+	EffectiveExpirationDate   string   `json:"effective-expiration-date"`
+	ResponseStatus            string   `json:"response-status"`
+	CertStatus                string   `json:"cert-status"`
+	ServedCertificateChain    []string `json:"served-certificate-chain"`
+	ValidatedCertificateChain []string `json:"validated-certificate-chain"`
+}
+
+// securityReportLoadTester is used to drive a security report load test
+type securityReportLoadTester struct {
+	PayloadCounter
+	url               string
+	securityReportJob SecurityReportJob
+	relGen            func() string
+}
+
+func newSecurityReportLoadTester(url string, rawSecurityReport json.RawMessage) LoadTester {
+	var securityReportParams SecurityReportJob
+	err := json.Unmarshal(rawSecurityReport, &securityReportParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid securityReport params received\nraw data\n%s", rawSecurityReport)
+	}
+	securityReportParams = securityReportJobWithDefaults(securityReportParams)
+	log.Trace().Msgf("SecurityReport generation for:\n%+v", securityReportParams)
+
+	return &securityReportLoadTester{
+		PayloadCounter:    NewPayloadCounter(PayloadEvents),
+		url:               url,
+		securityReportJob: securityReportParams,
+		relGen:            ReleaseGenerator(securityReportParams.NumReleases),
+	}
+}
+
+func (srlt *securityReportLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	projectProvider := utils.GetProjectProvider()
+	var numProjects = srlt.securityReportJob.NumProjects
+
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		tgt.Method = "POST"
+
+		projectId := projectProvider.GetProjectId(numProjects)
+		projectInfo := projectProvider.GetProjectInfo(projectId)
+		projectKey := projectInfo.ProjectKey
+
+		query := url.Values{}
+		query.Set("sentry_key", projectKey)
+		if release := srlt.relGen(); len(release) > 0 {
+			query.Set("sentry_release", release)
+		}
+		tgt.URL = fmt.Sprintf("%s/api/%s/security/?%s", srlt.url, projectId, query.Encode())
+
+		kind := securityReportKind(srlt.securityReportJob)
+		contentType, body, err := SecurityReportBody(kind, srlt.securityReportJob)
+		if err != nil {
+			return err
+		}
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("Content-Type", contentType)
+		tgt.Body = body
+		srlt.AddUnits(1)
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (srlt *securityReportLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// securityReportKind chooses the kind of the next report using the weights of the job
+func securityReportKind(job SecurityReportJob) string {
+	kind, err := utils.RandomChoice(
+		[]string{SecurityReportCsp, SecurityReportExpectCt, SecurityReportHpkp, SecurityReportExpectStaple},
+		[]int64{job.CspWeight, job.ExpectCtWeight, job.HpkpWeight, job.ExpectStapleWeight})
+	if err != nil {
+		return SecurityReportCsp
+	}
+	return kind
+}
+
+// SecurityReportBody generates a security report of the specified kind, it returns the content type (as
+// sent by browsers) and the body of the request
+func SecurityReportBody(kind string, job SecurityReportJob) (string, []byte, error) {
+	documentIdx := rand.Intn(job.NumDocumentUris)
+	hostname := fmt.Sprintf("app%d.example.com", documentIdx)
+	now := time.Now().UTC()
+	expiration := toUtcString(now.Add(30 * 24 * time.Hour))
+	certificateChain := []string{fmt.Sprintf("-----BEGIN CERTIFICATE-----\n%s\n-----END CERTIFICATE-----", hostname)}
+
+	var contentType string
+	var report interface{}
+	switch kind {
+	case SecurityReportExpectCt:
+		contentType = "application/expect-ct-report+json"
+		report = map[string]ExpectCtReport{"expect-ct-report": {
+			DateTime:                  toUtcString(now),
+			Hostname:                  hostname,
+			Port:                      443,
+			EffectiveExpirationDate:   expiration,
+			ServedCertificateChain:    certificateChain,
+			ValidatedCertificateChain: certificateChain,
+			Scts: []Sct{{
+				Version:    1,
+				Status:     utils.SimpleRandomChoice([]string{"unknown", "invalid", "valid"}),
+				Source:     "tls-extension",
+				Serialized: "ABCD==",
+			}},
+		}}
+	case SecurityReportHpkp:
+		contentType = "application/json"
+		report = HpkpReport{
+			DateTime:                  toUtcString(now),
+			Hostname:                  hostname,
+			Port:                      443,
+			EffectiveExpirationDate:   expiration,
+			IncludeSubdomains:         Flip(),
+			NotedHostname:             hostname,
+			ServedCertificateChain:    certificateChain,
+			ValidatedCertificateChain: certificateChain,
+			KnownPins:                 []string{`pin-sha256="d6qzRu9zOECb90Uez27xWltNsj0e1Md7GkYYkVoZWmM="`},
+		}
+	case SecurityReportExpectStaple:
+		contentType = "application/json"
+		report = map[string]ExpectStapleReport{"expect-staple-report": {
+			DateTime:                  toUtcString(now),
+			Hostname:                  hostname,
+			Port:                      443,
+			EffectiveExpirationDate:   expiration,
+			ResponseStatus:            utils.SimpleRandomChoice([]string{"MISSING", "PROVIDED", "ERROR_RESPONSE"}),
+			CertStatus:                utils.SimpleRandomChoice([]string{"GOOD", "REVOKED", "UNKNOWN"}),
+			ServedCertificateChain:    certificateChain,
+			ValidatedCertificateChain: certificateChain,
+		}}
+	default:
+		contentType = "application/csp-report"
+		directive := cspDirectives[rand.Intn(job.NumDirectives)]
+		report = map[string]CspReport{"csp-report": {
+			DocumentUri:        fmt.Sprintf("https://%s/page%d", hostname, rand.Intn(10)),
+			Referrer:           "",
+			ViolatedDirective:  directive,
+			EffectiveDirective: directive,
+			OriginalPolicy:     fmt.Sprintf("%s 'self'; report-uri /api/security/", directive),
+			Disposition:        "enforce",
+			BlockedUri:         fmt.Sprintf("https://cdn%d.example.net/resource.js", rand.Intn(job.NumBlockedUris)),
+			StatusCode:         200,
+			SourceFile:         fmt.Sprintf("https://%s/static/app.js", hostname),
+			LineNumber:         1 + rand.Intn(1000),
+		}}
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, body, nil
+}
+
+// securityReportJobWithDefaults fills in the defaults for the parameters that were not specified
+func securityReportJobWithDefaults(job SecurityReportJob) SecurityReportJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.CspWeight <= 0 && job.ExpectCtWeight <= 0 && job.HpkpWeight <= 0 && job.ExpectStapleWeight <= 0 {
+		job.CspWeight = 1
+	}
+	if job.NumBlockedUris <= 0 {
+		job.NumBlockedUris = 100
+	}
+	if job.NumDirectives <= 0 || job.NumDirectives > len(cspDirectives) {
+		job.NumDirectives = len(cspDirectives)
+	}
+	if job.NumDocumentUris <= 0 {
+		job.NumDocumentUris = 10
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("securityReport", newSecurityReportLoadTester, nil)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSecurityReportBody(t *testing.T) {
+	job := securityReportJobWithDefaults(SecurityReportJob{NumDirectives: 2, NumBlockedUris: 3})
+	testCases := []struct {
+		kind        string
+		contentType string
+		rootKey     string
+	}{
+		{kind: SecurityReportCsp, contentType: "application/csp-report", rootKey: "csp-report"},
+		{kind: SecurityReportExpectCt, contentType: "application/expect-ct-report+json", rootKey: "expect-ct-report"},
+		{kind: SecurityReportHpkp, contentType: "application/json", rootKey: "known-pins"},
+		{kind: SecurityReportExpectStaple, contentType: "application/json", rootKey: "expect-staple-report"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.kind, func(t *testing.T) {
+			contentType, body, err := SecurityReportBody(testCase.kind, job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != testCase.contentType {
+				t.Errorf("expected content type %s got %s", testCase.contentType, contentType)
+			}
+			var report map[string]json.RawMessage
+			if err = json.Unmarshal(body, &report); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := report[testCase.rootKey]; !ok {
+				t.Errorf("expected %s in report %s", testCase.rootKey, body)
+			}
+		})
+	}
+}
+
+func TestCspReportCardinality(t *testing.T) {
+	job := securityReportJobWithDefaults(SecurityReportJob{NumDirectives: 2, NumBlockedUris: 3})
+	directives := make(map[string]bool)
+	blockedUris := make(map[string]bool)
+	for idx := 0; idx < 200; idx++ {
+		_, body, err := SecurityReportBody(SecurityReportCsp, job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report map[string]CspReport
+		if err = json.Unmarshal(body, &report); err != nil {
+			t.Fatal(err)
+		}
+		directives[report["csp-report"].ViolatedDirective] = true
+		blockedUris[report["csp-report"].BlockedUri] = true
+	}
+	if len(directives) != 2 || len(blockedUris) != 3 {
+		t.Errorf("expected 2 directives and 3 blocked uris got %d and %d", len(directives), len(blockedUris))
+	}
+}
+
+func TestSecurityReportKindWeights(t *testing.T) {
+	job := securityReportJobWithDefaults(SecurityReportJob{HpkpWeight: 1})
+	for idx := 0; idx < 20; idx++ {
+		if kind := securityReportKind(job); kind != SecurityReportHpkp {
+			t.Errorf("expected only hpkp reports got %s", kind)
+		}
+	}
+	if kind := securityReportKind(securityReportJobWithDefaults(SecurityReportJob{})); kind != SecurityReportCsp {
+		t.Errorf("expected csp reports by default got %s", kind)
+	}
+}
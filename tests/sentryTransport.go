@@ -0,0 +1,462 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// SentryTransportJob controls how the payloads of the Sentry ingestion tests are delivered
+//
+// The fields are specified together with the parameters of the test (all the tests registered with
+// RegisterSentryTestType accept them). The endpoint and the authentication of each envelope are picked by
+// their relative weights, by default envelopes are sent to the envelope endpoint with the X-Sentry-Auth header.
+// Endpoints:
+//   - envelope: the /api/{id}/envelope/ endpoint
+//   - store: the legacy /api/{id}/store/ endpoint, only envelopes with a single event or transaction can be
+//     sent to it, the other envelopes are sent to the envelope endpoint
+//
+// Authentication modes:
+//   - header: the X-Sentry-Auth header
+//   - query: the sentry_key and sentry_version query parameters
+//   - dsn: the dsn envelope header, requests to the store endpoint use the header instead
+//
+// When relays are configured the requests are forwarded the way a downstream relay forwards them to
+// a processing relay: each request is signed by one of the relays (picked at random) and carries the
+// IP of the (simulated) client in the X-Forwarded-For header.
+//
+// The request bodies can be compressed (the way SDKs do) with gzip, deflate, br (brotli) or zstd, the ratio
+// controls the fraction of the requests that are compressed. The size of the bodies before compression is
+// reported (as uncompressedBytesOut) together with the size of the bodies sent.
+//
+// With respectRateLimits the rate limits sent by the upstream (429 responses, X-Sentry-Rate-Limits and
+// Retry-After headers) are respected the way SDKs respect them: until a limit expires, the requests of the
+// project with only rate limited data categories are suppressed (they are not sent and are reported, as
+// suppressedRequests and suppressedUnits, separately from the requests sent).
+//
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "endpointWeights": {"envelope": 3, "store": 1},
+//  "authWeights": {"header": 2, "query": 1, "dsn": 1},
+//  "compression": {"algorithm": "gzip", "ratio": 0.5},
+//  "respectRateLimits": true,
+//  "relays": [
+//    {
+//      "relayId": "aaa12340-a123-123b-4567-0afe1f27e066",
+//      "relayPublicKey": "ftFuDNBFm8-kPpuCuaWMio_mJAW2txCFCsaLMHn2vv0",
+//      "relayPrivateKey": "uZUtRaayN8uuuTTOjbs5EDfqWNwyDfFro6TERx6Wfhs"
+//    }
+//  ]
+// }
+// ```
+type SentryTransportJob struct {
+	// EndpointWeights the relative weights of the endpoints (envelope, store)
+	EndpointWeights map[string]int64 `json:"endpointWeights,omitempty" yaml:"endpointWeights,omitempty"`
+	// AuthWeights the relative weights of the authentication modes (header, query, dsn)
+	AuthWeights map[string]int64 `json:"authWeights,omitempty" yaml:"authWeights,omitempty"`
+	// Relays the internal relays used to sign the requests (by default requests are not signed)
+	Relays []RelayCredentials `json:"relays,omitempty" yaml:"relays,omitempty"`
+	// Compression the compression of the request bodies (by default bodies are not compressed)
+	Compression *CompressionJob `json:"compression,omitempty" yaml:"compression,omitempty"`
+	// RespectRateLimits suppresses the requests that are rate limited by the upstream (default false)
+	RespectRateLimits bool `json:"respectRateLimits,omitempty" yaml:"respectRateLimits,omitempty"`
+}
+
+// CompressionJob controls the compression of the request bodies
+// @doc({"scope":"job"})
+//
+type CompressionJob struct {
+	// Algorithm the compression algorithm (gzip, deflate, br or zstd)
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Ratio the fraction of the requests that are compressed, between 0 (no request is compressed) and 1
+	// (default 1)
+	Ratio *float64 `json:"ratio,omitempty" yaml:"ratio,omitempty"`
+}
+
+// RelayCredentials the credentials of a relay (in the same format as Relay's credentials.json)
+// @doc({"scope":"job"})
+//
+type RelayCredentials struct {
+	// RelayId the id of the relay
+	RelayId string `json:"relayId" yaml:"relayId"`
+	// RelayPublicKey the public key of the relay
+	RelayPublicKey string `json:"relayPublicKey" yaml:"relayPublicKey"`
+	// RelayPrivateKey the private key of the relay
+	RelayPrivateKey string `json:"relayPrivateKey" yaml:"relayPrivateKey"`
+}
+
+// signingRelay is a relay that can sign requests
+type signingRelay struct {
+	id         string
+	privateKey ed25519.PrivateKey
+}
+
+// Endpoints and authentication modes of Sentry requests
+const (
+	EndpointEnvelope = "envelope"
+	EndpointStore    = "store"
+	AuthHeader       = "header"
+	AuthQuery        = "query"
+	AuthDsn          = "dsn"
+)
+
+// sentryTransportLoadTester wraps the load tester of a test that sends Sentry envelopes and changes the
+// requests it generates according to the SentryTransportJob
+type sentryTransportLoadTester struct {
+	LoadTester
+	targetUrl string
+	endpoint  func() string
+	auth      func() string
+	relays    []signingRelay
+	// the compression algorithm (empty if bodies are not compressed) and the fraction of compressed requests
+	compression      string
+	compressionRatio float64
+	requests         uint64
+	// the size of the request bodies before compression
+	uncompressedBytes uint64
+	// the rate limits of the projects (nil if the rate limits are not respected)
+	rateLimits         *RateLimits
+	suppressedRequests uint64
+	suppressedUnits    uint64
+}
+
+// RegisterSentryTestType registers a test type that sends Sentry envelopes (see RegisterTestType), the
+// test also accepts the SentryTransportJob parameters
+func RegisterSentryTestType(name string, tester LoadTesterBuilder, splitter LoadSplitter) {
+	RegisterTestType(name, sentryTransportBuilder(tester), splitter)
+}
+
+// sentryTransportBuilder wraps a LoadTesterBuilder, the load tester is wrapped only if the requests need to change
+func sentryTransportBuilder(tester LoadTesterBuilder) LoadTesterBuilder {
+	return func(targetUrl string, params json.RawMessage) LoadTester {
+		loadTester := tester(targetUrl, params)
+		var transportParams SentryTransportJob
+		// the parameters are mixed with the test parameters, they were already validated by the test
+		_ = json.Unmarshal(params, &transportParams)
+		if isDefaultTransport(transportParams) {
+			return loadTester
+		}
+		log.Trace().Msgf("Sentry transport for:\n%+v", transportParams)
+		retVal := &sentryTransportLoadTester{
+			LoadTester: loadTester,
+			targetUrl:  targetUrl,
+			endpoint:   weightedChoiceGenerator(transportParams.EndpointWeights, EndpointEnvelope),
+			auth:       weightedChoiceGenerator(transportParams.AuthWeights, AuthHeader),
+			relays:     signingRelays(transportParams.Relays),
+		}
+		if transportParams.RespectRateLimits {
+			retVal.rateLimits = NewRateLimits()
+		}
+		if compression := transportParams.Compression; compression != nil {
+			retVal.compression, retVal.compressionRatio = compressionWithDefaults(*compression)
+		}
+		return retVal
+	}
+}
+
+// compressionWithDefaults returns the algorithm and the ratio of the compressed requests (no algorithm if the
+// requests are not compressed)
+func compressionWithDefaults(job CompressionJob) (string, float64) {
+	algorithm := strings.ToLower(job.Algorithm)
+	if algorithm == "brotli" {
+		algorithm = utils.CompressionBrotli
+	}
+	switch algorithm {
+	case utils.CompressionGzip, utils.CompressionDeflate, utils.CompressionBrotli, utils.CompressionZstd:
+	default:
+		log.Error().Msgf("invalid compression algorithm %s, requests will not be compressed", job.Algorithm)
+		return "", 0
+	}
+	if job.Ratio == nil || *job.Ratio > 1 {
+		return algorithm, 1
+	}
+	if *job.Ratio < 0 {
+		return algorithm, 0
+	}
+	return algorithm, *job.Ratio
+}
+
+// signingRelays parses the keys of the relays, relays with invalid keys are ignored
+func signingRelays(credentials []RelayCredentials) []signingRelay {
+	retVal := make([]signingRelay, 0, len(credentials))
+	for _, relay := range credentials {
+		privateKey, err := utils.PrivateKeyFromString(relay.RelayPublicKey, relay.RelayPrivateKey)
+		if err != nil {
+			log.Error().Err(err).Msgf("invalid credentials for relay %s, relay ignored", relay.RelayId)
+			continue
+		}
+		retVal = append(retVal, signingRelay{id: relay.RelayId, privateKey: privateKey})
+	}
+	return retVal
+}
+
+// isDefaultTransport returns true if the requests are sent to the envelope endpoint with the auth header
+// and are not signed by a relay or compressed
+func isDefaultTransport(job SentryTransportJob) bool {
+	if len(job.Relays) > 0 || job.Compression != nil || job.RespectRateLimits {
+		return false
+	}
+	for endpoint, weight := range job.EndpointWeights {
+		if endpoint != EndpointEnvelope && weight > 0 {
+			return false
+		}
+	}
+	for auth, weight := range job.AuthWeights {
+		if auth != AuthHeader && weight > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// weightedChoiceGenerator picks the keys of the map by their relative weights (the default if there are no weights)
+func weightedChoiceGenerator(weights map[string]int64, defaultChoice string) func() string {
+	choices := make([]string, 0, len(weights))
+	for choice := range weights {
+		choices = append(choices, choice)
+	}
+	sort.Strings(choices)
+	relativeWeights := make([]int64, 0, len(choices))
+	for _, choice := range choices {
+		relativeWeights = append(relativeWeights, weights[choice])
+	}
+	return func() string {
+		choice, err := utils.RandomChoice(choices, relativeWeights)
+		if err != nil {
+			return defaultChoice
+		}
+		return choice
+	}
+}
+
+func (stlt *sentryTransportLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	targeter, seq := stlt.LoadTester.GetTargeter()
+	return func(tgt *vegeta.Target) error {
+		if err := targeter(tgt); err != nil {
+			return err
+		}
+		atomic.AddUint64(&stlt.requests, 1)
+		if stlt.rateLimits != nil && stlt.rateLimits.IsLimited(projectIdFromUrl(tgt.URL), requestCategories(tgt), time.Now()) {
+			atomic.AddUint64(&stlt.suppressedRequests, 1)
+			atomic.AddUint64(&stlt.suppressedUnits, GetTargetUnits(stlt.LoadTester, tgt))
+			if tgt.Header == nil {
+				tgt.Header = make(http.Header)
+			}
+			tgt.Header.Set(suppressedHeader, "true")
+			return nil
+		}
+		if strings.HasSuffix(tgt.URL, "/envelope/") {
+			if err := SetSentryTransport(tgt, stlt.endpoint(), stlt.auth(), stlt.targetUrl); err != nil {
+				return err
+			}
+		}
+		atomic.AddUint64(&stlt.uncompressedBytes, uint64(len(tgt.Body)))
+		if len(stlt.compression) > 0 && rand.Float64() < stlt.compressionRatio {
+			if err := setContentEncoding(tgt, stlt.compression); err != nil {
+				return err
+			}
+		}
+		if len(stlt.relays) > 0 {
+			// the signature is over the final body so this must be the last change of the request
+			return signRelayForward(tgt, stlt.relays[rand.Intn(len(stlt.relays))], randomClientIp())
+		}
+		return nil
+	}, seq
+}
+
+// setContentEncoding compresses the body of a request with the specified algorithm
+func setContentEncoding(tgt *vegeta.Target, algorithm string) error {
+	body, err := utils.Compress(algorithm, tgt.Body)
+	if err != nil {
+		return err
+	}
+	if tgt.Header == nil {
+		tgt.Header = make(http.Header)
+	}
+	tgt.Header.Set("Content-Encoding", algorithm)
+	tgt.Body = body
+	return nil
+}
+
+// signRelayForward changes a request to look like it was forwarded by a relay from the specified client
+func signRelayForward(tgt *vegeta.Target, relay signingRelay, clientIp string) error {
+	signature, err := utils.RelayAuthSign(relay.privateKey, tgt.Body, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if tgt.Header == nil {
+		tgt.Header = make(http.Header)
+	}
+	tgt.Header.Set("X-Sentry-Relay-Id", relay.id)
+	tgt.Header.Set("X-Sentry-Relay-Signature", signature)
+	tgt.Header.Set("X-Forwarded-For", clientIp)
+	return nil
+}
+
+// randomClientIp returns a random (public looking) IPv4 address
+func randomClientIp() string {
+	return fmt.Sprintf("%d.%d.%d.%d", 1+rand.Intn(223), rand.Intn(256), rand.Intn(256), 1+rand.Intn(254))
+}
+
+// PayloadUnits returns the payload of the wrapped load tester (without the payload of the suppressed requests)
+func (stlt *sentryTransportLoadTester) PayloadUnits() (string, uint64) {
+	// the units of a request are added to the wrapped load tester before being added to the suppressed units,
+	// reading the suppressed units first keeps the difference from going negative
+	suppressedUnits := atomic.LoadUint64(&stlt.suppressedUnits)
+	unit, units := GetPayloadUnits(stlt.LoadTester, atomic.LoadUint64(&stlt.requests))
+	if suppressedUnits > units {
+		return unit, 0
+	}
+	return unit, units - suppressedUnits
+}
+
+// Suppressed returns the number of requests suppressed because of the rate limits and their payload units
+func (stlt *sentryTransportLoadTester) Suppressed() (uint64, uint64) {
+	return atomic.LoadUint64(&stlt.suppressedRequests), atomic.LoadUint64(&stlt.suppressedUnits)
+}
+
+// WrapRoundTripper keeps track of the rate limits sent by the upstream (if the rate limits are respected)
+func (stlt *sentryTransportLoadTester) WrapRoundTripper(next http.RoundTripper) http.RoundTripper {
+	if stlt.rateLimits == nil {
+		return next
+	}
+	return rateLimitRoundTripper{next: next, limits: stlt.rateLimits}
+}
+
+// UncompressedBytes returns the size of the request bodies before compression
+func (stlt *sentryTransportLoadTester) UncompressedBytes() uint64 {
+	return atomic.LoadUint64(&stlt.uncompressedBytes)
+}
+
+// SetSentryTransport changes an envelope request (sent to the envelope endpoint with the X-Sentry-Auth header)
+// to use the specified endpoint and authentication mode
+func SetSentryTransport(tgt *vegeta.Target, endpoint string, auth string, targetUrl string) error {
+	projectKey := projectKeyFromAuthHeader(tgt.Header.Get("X-Sentry-Auth"))
+	if len(projectKey) == 0 {
+		return nil // nothing we can do without the key
+	}
+
+	if endpoint == EndpointStore {
+		itemType, payload, err := singleEnvelopeItem(tgt.Body)
+		if err != nil {
+			return err
+		}
+		if itemType == "event" || itemType == "transaction" {
+			tgt.URL = strings.TrimSuffix(tgt.URL, "/envelope/") + "/store/"
+			tgt.Header.Set("Content-Type", "application/json")
+			tgt.Body = payload
+			if auth == AuthDsn {
+				auth = AuthHeader // there is no envelope header for the dsn
+			}
+		}
+	}
+
+	switch auth {
+	case AuthQuery:
+		tgt.Header.Del("X-Sentry-Auth")
+		tgt.URL = fmt.Sprintf("%s?sentry_key=%s&sentry_version=7", tgt.URL, url.QueryEscape(projectKey))
+	case AuthDsn:
+		projectId := strings.TrimSuffix(tgt.URL, "/envelope/")
+		projectId = projectId[strings.LastIndexByte(projectId, '/')+1:]
+		dsn, err := Dsn(targetUrl, projectKey, projectId)
+		if err != nil {
+			return err
+		}
+		body, err := setEnvelopeHeader(tgt.Body, "dsn", dsn)
+		if err != nil {
+			return err
+		}
+		tgt.Header.Del("X-Sentry-Auth")
+		tgt.Body = body
+	}
+	return nil
+}
+
+// Dsn returns the DSN of a project (e.g. http://key@relay:3000/42)
+func Dsn(targetUrl string, projectKey string, projectId string) (string, error) {
+	dsn, err := url.Parse(targetUrl)
+	if err != nil {
+		return "", err
+	}
+	dsn.User = url.User(projectKey)
+	dsn.Path = strings.TrimSuffix(dsn.Path, "/") + "/" + projectId
+	return dsn.String(), nil
+}
+
+// projectKeyFromAuthHeader extracts the sentry_key from a X-Sentry-Auth header
+func projectKeyFromAuthHeader(header string) string {
+	header = strings.TrimPrefix(header, "Sentry ")
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "sentry_key=") {
+			return strings.TrimPrefix(part, "sentry_key=")
+		}
+	}
+	return ""
+}
+
+// singleEnvelopeItem returns the type and payload of the item of an envelope with a single item
+// (an empty type is returned for envelopes with more items)
+func singleEnvelopeItem(envelope []byte) (string, []byte, error) {
+	// skip the envelope header
+	headerEnd := bytes.IndexByte(envelope, '\n')
+	if headerEnd < 0 {
+		return "", nil, fmt.Errorf("invalid envelope")
+	}
+	rest := envelope[headerEnd+1:]
+	itemHeaderEnd := bytes.IndexByte(rest, '\n')
+	if itemHeaderEnd < 0 {
+		return "", nil, fmt.Errorf("invalid envelope item")
+	}
+	var itemHeader struct {
+		Type   string `json:"type"`
+		Length int    `json:"length"`
+	}
+	if err := json.Unmarshal(rest[:itemHeaderEnd], &itemHeader); err != nil {
+		return "", nil, err
+	}
+	payload := rest[itemHeaderEnd+1:]
+	if itemHeader.Length > len(payload) {
+		return "", nil, fmt.Errorf("invalid envelope item length %d", itemHeader.Length)
+	}
+	// the payload is followed by a new line, more content means more items
+	if len(bytes.TrimSpace(payload[itemHeader.Length:])) > 0 {
+		return "", nil, nil
+	}
+	return itemHeader.Type, payload[:itemHeader.Length], nil
+}
+
+// setEnvelopeHeader sets a header of an envelope
+func setEnvelopeHeader(envelope []byte, name string, value string) ([]byte, error) {
+	headerEnd := bytes.IndexByte(envelope, '\n')
+	if headerEnd < 0 {
+		return nil, fmt.Errorf("invalid envelope")
+	}
+	var headers map[string]interface{}
+	if err := json.Unmarshal(envelope[:headerEnd], &headers); err != nil {
+		return nil, err
+	}
+	headers[name] = value
+	rawHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	retVal := make([]byte, 0, len(rawHeaders)+len(envelope)-headerEnd)
+	retVal = append(retVal, rawHeaders...)
+	return append(retVal, envelope[headerEnd:]...), nil
+}
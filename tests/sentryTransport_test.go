@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func envelopeTarget(t *testing.T, items ...utils.EnvelopeItem) *vegeta.Target {
+	buff, err := utils.EnvelopeFromItems("", time.Now(), map[string]string{"public_key": "key1"}, items...)
+	if err != nil {
+		t.Fatalf("could not create envelope: %v", err)
+	}
+	tgt := vegeta.Target{
+		Method: "POST",
+		URL:    "http://relay:3000/api/42/envelope/",
+		Header: make(http.Header),
+		Body:   buff.Bytes(),
+	}
+	tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader("key1"))
+	tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+	return &tgt
+}
+
+func TestSetSentryTransportStore(t *testing.T) {
+	event := []byte(`{"event_id":"abc"}`)
+	tgt := envelopeTarget(t, utils.EnvelopeItem{Type: "event", Payload: event})
+	if err := SetSentryTransport(tgt, EndpointStore, AuthQuery, "http://relay:3000"); err != nil {
+		t.Fatalf("could not set transport: %v", err)
+	}
+	if tgt.URL != "http://relay:3000/api/42/store/?sentry_key=key1&sentry_version=7" {
+		t.Errorf("unexpected url %s", tgt.URL)
+	}
+	if string(tgt.Body) != string(event) || tgt.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected the event to be sent to the store endpoint got %s", tgt.Body)
+	}
+	if len(tgt.Header.Get("X-Sentry-Auth")) > 0 {
+		t.Errorf("the auth header should have been removed")
+	}
+
+	// envelopes with other items can't be stored
+	tgt = envelopeTarget(t, utils.EnvelopeItem{Type: "event", Payload: event},
+		utils.EnvelopeItem{Type: "attachment", Payload: []byte("data")})
+	body := tgt.Body
+	if err := SetSentryTransport(tgt, EndpointStore, AuthHeader, "http://relay:3000"); err != nil {
+		t.Fatalf("could not set transport: %v", err)
+	}
+	if !strings.HasSuffix(tgt.URL, "/envelope/") || string(tgt.Body) != string(body) {
+		t.Errorf("expected the envelope to be sent unchanged")
+	}
+}
+
+func TestSetSentryTransportDsn(t *testing.T) {
+	tgt := envelopeTarget(t, utils.EnvelopeItem{Type: "session", Payload: []byte(`{}`)})
+	if err := SetSentryTransport(tgt, EndpointEnvelope, AuthDsn, "http://relay:3000"); err != nil {
+		t.Fatalf("could not set transport: %v", err)
+	}
+	if len(tgt.Header.Get("X-Sentry-Auth")) > 0 {
+		t.Errorf("the auth header should have been removed")
+	}
+	var headers map[string]interface{}
+	if err := json.Unmarshal(tgt.Body[:strings.IndexByte(string(tgt.Body), '\n')], &headers); err != nil {
+		t.Fatalf("invalid envelope header: %v", err)
+	}
+	if headers["dsn"] != "http://key1@relay:3000/42" || headers["public_key"] != "key1" {
+		t.Errorf("unexpected envelope headers %v", headers)
+	}
+	if itemType, _, _ := singleEnvelopeItem(tgt.Body); itemType != "session" {
+		t.Errorf("the items of the envelope should not change")
+	}
+}
+
+func TestSentryTransportBuilder(t *testing.T) {
+	builder := sentryTransportBuilder(newErrorLoadTester)
+	if _, ok := builder("http://relay", json.RawMessage(`{"numProjects":1}`)).(*errorLoadTester); !ok {
+		t.Errorf("the load tester should not be wrapped for the default transport")
+	}
+
+	loadTester := builder("http://relay", json.RawMessage(`{"numProjects":1,"endpointWeights":{"store":1}}`))
+	targeter, _ := loadTester.GetTargeter()
+	var tgt vegeta.Target
+	if err := targeter(&tgt); err != nil {
+		t.Fatalf("could not create target: %v", err)
+	}
+	if !strings.HasSuffix(tgt.URL, "/store/") {
+		t.Errorf("expected a store request got %s", tgt.URL)
+	}
+	if unit, units := GetPayloadUnits(loadTester, 1); unit != PayloadEvents || units != 1 {
+		t.Errorf("expected the payload of the wrapped load tester got %d %s", units, unit)
+	}
+}
+
+func TestSentryTransportRelaySignature(t *testing.T) {
+	builder := sentryTransportBuilder(newErrorLoadTester)
+	loadTester := builder("http://relay", json.RawMessage(`{"numProjects":1,"relays":[
+		{"relayId":"relay1","relayPublicKey":"ftFuDNBFm8-kPCoCaaWMio_mJYC2txJuCtwSeHn2vv0","relayPrivateKey":"uZUtRrryN8jybTTOjbs5EDfqWNwyDfEng4TSRa6Ifhs"},
+		{"relayId":"invalid","relayPublicKey":"abc","relayPrivateKey":"def"}
+	]}`))
+	if relays := loadTester.(*sentryTransportLoadTester).relays; len(relays) != 1 {
+		t.Fatalf("expected the relay with invalid keys to be ignored got %d relays", len(relays))
+	}
+	targeter, _ := loadTester.GetTargeter()
+	var tgt vegeta.Target
+	if err := targeter(&tgt); err != nil {
+		t.Fatalf("could not create target: %v", err)
+	}
+	if tgt.Header.Get("X-Sentry-Relay-Id") != "relay1" || len(tgt.Header.Get("X-Sentry-Auth")) == 0 {
+		t.Errorf("expected a request forwarded by relay1 got headers %v", tgt.Header)
+	}
+	if net.ParseIP(tgt.Header.Get("X-Forwarded-For")) == nil {
+		t.Errorf("invalid client ip %s", tgt.Header.Get("X-Forwarded-For"))
+	}
+
+	verifyRelaySignature(t, tgt, "ftFuDNBFm8-kPCoCaaWMio_mJYC2txJuCtwSeHn2vv0")
+}
+
+func TestSentryTransportCompression(t *testing.T) {
+	builder := sentryTransportBuilder(newErrorLoadTester)
+	loadTester := builder("http://relay", json.RawMessage(`{"numProjects":1,"compression":{"algorithm":"gzip"}}`))
+	targeter, _ := loadTester.GetTargeter()
+	var tgt vegeta.Target
+	if err := targeter(&tgt); err != nil {
+		t.Fatalf("could not create target: %v", err)
+	}
+	if tgt.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip encoded body got %s", tgt.Header.Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(tgt.Body))
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	if itemType, _, _ := singleEnvelopeItem(body); itemType != "event" {
+		t.Errorf("expected the compressed body to be the event envelope")
+	}
+	if uncompressed := GetUncompressedBytes(loadTester, uint64(len(tgt.Body))); uncompressed != uint64(len(body)) {
+		t.Errorf("expected %d uncompressed bytes got %d", len(body), uncompressed)
+	}
+
+	// invalid algorithms are ignored
+	loadTester = builder("http://relay", json.RawMessage(`{"numProjects":1,"compression":{"algorithm":"lzma"}}`))
+	targeter, _ = loadTester.GetTargeter()
+	tgt = vegeta.Target{}
+	if err = targeter(&tgt); err != nil {
+		t.Fatalf("could not create target: %v", err)
+	}
+	if len(tgt.Header.Get("Content-Encoding")) > 0 {
+		t.Errorf("expected an uncompressed body got %s", tgt.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestCompressionWithDefaults(t *testing.T) {
+	ratio := func(val float64) *float64 { return &val }
+	testCases := []struct {
+		job       CompressionJob
+		algorithm string
+		ratio     float64
+	}{
+		{CompressionJob{Algorithm: "gzip"}, "gzip", 1},
+		{CompressionJob{Algorithm: "Brotli", Ratio: ratio(0.5)}, "br", 0.5},
+		{CompressionJob{Algorithm: "zstd", Ratio: ratio(2)}, "zstd", 1},
+		{CompressionJob{Algorithm: "deflate", Ratio: ratio(0)}, "deflate", 0},
+		{CompressionJob{Algorithm: "deflate", Ratio: ratio(-1)}, "deflate", 0},
+		{CompressionJob{Algorithm: "lzma", Ratio: ratio(0.5)}, "", 0},
+	}
+	for _, testCase := range testCases {
+		algorithm, ratio := compressionWithDefaults(testCase.job)
+		if algorithm != testCase.algorithm || ratio != testCase.ratio {
+			t.Errorf("%+v expected %s %f got %s %f", testCase.job, testCase.algorithm, testCase.ratio, algorithm, ratio)
+		}
+	}
+}
@@ -40,6 +40,27 @@ const timeFormat = "2006-01-02T03:04:05.000Z"
 //   "abnormalWeight": 10
 // }
 // ```
+//
+// When aggregates is set the sessions are sent as session aggregates (the way server side SDKs do),
+// each envelope contains a `sessions` item with bucketsPerEnvelope per-minute buckets, the buckets
+// count the sessions by status using the same weights (ok sessions are counted as exited):
+//
+// ```json
+// {
+//   "numProjects": 100,
+//   "numReleases": 3,
+//   "numEnvironments": 2,
+//   "numUsers": 0,
+//   "exitedWeight": 90,
+//   "erroredWeight": 8,
+//   "crashedWeight": 1,
+//   "abnormalWeight": 1,
+//   "aggregates": true,
+//   "bucketsPerEnvelope": 10,
+//   "bucketTimeSpread": "10m",
+//   "maxSessionsPerBucket": 100
+// }
+// ```
 type SessionJob struct {
 	// NumProjects to use in the requests
 	NumProjects int
@@ -63,6 +84,14 @@ type SessionJob struct {
 	CrashedWeight int64
 	// AbnormalWeight represents the relative weight of session with abnormal status
 	AbnormalWeight int64
+	// Aggregates sends session aggregates instead of individual sessions
+	Aggregates bool
+	// BucketsPerEnvelope the number of aggregate buckets sent in an envelope (default 1)
+	BucketsPerEnvelope int64
+	// BucketTimeSpread the started time of the aggregate buckets will be between now and -bucketTimeSpread from now
+	BucketTimeSpread time.Duration
+	// MaxSessionsPerBucket the maximum number of sessions counted in an aggregate bucket (default 10)
+	MaxSessionsPerBucket int64
 }
 
 // Session serialisation format for sessions
@@ -82,7 +111,27 @@ type Session struct {
 	} `json:"attrs"`
 }
 
+// SessionAggregates serialisation format for session aggregates
+type SessionAggregates struct {
+	Aggregates []SessionAggregateBucket `json:"aggregates"`
+	Attributes struct {
+		Release     string `json:"release"`
+		Environment string `json:"environment"`
+	} `json:"attrs"`
+}
+
+// SessionAggregateBucket the session counts for a minute (and optionally a user)
+type SessionAggregateBucket struct {
+	Started  string `json:"started"` // a date time (rounded to the minute)
+	UserId   string `json:"did,omitempty"`
+	Exited   int64  `json:"exited,omitempty"`
+	Errored  int64  `json:"errored,omitempty"`
+	Abnormal int64  `json:"abnormal,omitempty"`
+	Crashed  int64  `json:"crashed,omitempty"`
+}
+
 type sessionLoadTester struct {
+	PayloadCounter
 	url           string
 	sessionParams SessionJob
 }
@@ -99,11 +148,28 @@ func newSessionLoadTester(url string, rawSessionParams json.RawMessage) LoadTest
 		// backward compatibility (if nothing provided fall back on one project)
 		sessionParams.NumProjects = 1
 	}
+	unit := PayloadItems
+	if sessionParams.Aggregates {
+		unit = PayloadBuckets
+		if sessionParams.BucketsPerEnvelope <= 0 {
+			sessionParams.BucketsPerEnvelope = 1
+		}
+		if sessionParams.MaxSessionsPerBucket <= 0 {
+			sessionParams.MaxSessionsPerBucket = 10
+		}
+		if sessionParams.NumReleases <= 0 {
+			sessionParams.NumReleases = 1
+		}
+		if sessionParams.NumEnvironments <= 0 {
+			sessionParams.NumEnvironments = 1
+		}
+	}
 	log.Trace().Msgf("Session generation for:\n%+v", sessionParams)
 
 	return &sessionLoadTester{
-		url:           url,
-		sessionParams: sessionParams,
+		PayloadCounter: NewPayloadCounter(unit),
+		url:            url,
+		sessionParams:  sessionParams,
 	}
 }
 
@@ -127,12 +193,23 @@ func (slt *sessionLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
 		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
 
-		body, err := getSessionBody(slt.sessionParams)
+		var body []byte
+		var err error
+		if slt.sessionParams.Aggregates {
+			body, err = getSessionAggregatesBody(slt.sessionParams)
+		} else {
+			body, err = getSessionBody(slt.sessionParams)
+		}
 		if err != nil {
 			return err
 		}
 
 		tgt.Body = body
+		if slt.sessionParams.Aggregates {
+			slt.AddUnits(int(slt.sessionParams.BucketsPerEnvelope))
+		} else {
+			slt.AddUnits(1)
+		}
 		log.Trace().Msgf("Attacking project:%s", projectId)
 		return nil
 	}, 0
@@ -142,9 +219,38 @@ func (slt *sessionLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
 	return // nothing to do
 }
 
+// TargetUnits returns the number of sessions (or session aggregate buckets) of a request
+func (slt *sessionLoadTester) TargetUnits(_ *vegeta.Target) uint64 {
+	if slt.sessionParams.Aggregates {
+		return uint64(slt.sessionParams.BucketsPerEnvelope)
+	}
+	return 1
+}
+
 func getSessionBody(sp SessionJob) ([]byte, error) {
-	var session Session
 	log.Trace().Msgf("session job: %v", sp)
+	session := SessionGenerator(sp)
+
+	body, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var buff *bytes.Buffer
+	eventId, err := uuid.NewUUID()
+	eventIdStr := utils.UuidAsHex(eventId)
+
+	buff, err = utils.EnvelopeFromBody(eventIdStr, time.Now().UTC(), "session", map[string]string{}, body)
+	if err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+
+}
+
+// SessionGenerator generates a session update following the distribution described by the job
+func SessionGenerator(sp SessionJob) Session {
+	var session Session
 
 	// Logic copied from ingest-load-tester session_event_task_factory
 	maxDurationDeviation := sp.DurationRange
@@ -183,10 +289,8 @@ func getSessionBody(sp SessionJob) ([]byte, error) {
 	}
 
 	userId := fmt.Sprintf("u-%d", rand.Int63n(sp.NumUsers))
-	sessionId, err := uuid.NewUUID()
+	sessionId, _ := uuid.NewUUID()
 	sessionIdStr := utils.UuidAsHex(sessionId)
-	eventId, err := uuid.NewUUID()
-	eventIdStr := utils.UuidAsHex(eventId)
 
 	session = Session{
 		Init:      init,
@@ -201,20 +305,58 @@ func getSessionBody(sp SessionJob) ([]byte, error) {
 	}
 	session.Attributes.Environment = environment
 	session.Attributes.Release = release
+	return session
+}
 
-	body, err := json.Marshal(session)
+// getSessionAggregatesBody creates an envelope with a sessions item containing sp.BucketsPerEnvelope buckets
+func getSessionAggregatesBody(sp SessionJob) ([]byte, error) {
+	now := time.Now().UTC()
+	var aggregates SessionAggregates
+	aggregates.Attributes.Release = fmt.Sprintf("r-1.0.%d", rand.Int63n(sp.NumReleases))
+	aggregates.Attributes.Environment = fmt.Sprintf("environment-%d", rand.Int63n(sp.NumEnvironments))
+	aggregates.Aggregates = make([]SessionAggregateBucket, 0, sp.BucketsPerEnvelope)
+
+	statuses := []string{"exited", "errored", "crashed", "abnormal"}
+	// aggregates do not have an ok status, ok sessions are counted as exited
+	weights := []int64{sp.OkWeight + sp.ExitedWeight, sp.ErroredWeight, sp.CrashedWeight, sp.AbnormalWeight}
+	for idx := int64(0); idx < sp.BucketsPerEnvelope; idx++ {
+		started := now
+		if sp.BucketTimeSpread > 0 {
+			started = now.Add(-time.Duration(rand.Int63n(int64(sp.BucketTimeSpread))))
+		}
+		bucket := SessionAggregateBucket{Started: toUtcString(started.Truncate(time.Minute))}
+		if sp.NumUsers > 0 {
+			bucket.UserId = fmt.Sprintf("u-%d", rand.Int63n(sp.NumUsers))
+		}
+		numSessions := 1 + rand.Int63n(sp.MaxSessionsPerBucket)
+		for sessionIdx := int64(0); sessionIdx < numSessions; sessionIdx++ {
+			status, err := utils.RandomChoice(statuses, weights)
+			if err != nil {
+				status = "exited"
+			}
+			switch status {
+			case "errored":
+				bucket.Errored++
+			case "crashed":
+				bucket.Crashed++
+			case "abnormal":
+				bucket.Abnormal++
+			default:
+				bucket.Exited++
+			}
+		}
+		aggregates.Aggregates = append(aggregates.Aggregates, bucket)
+	}
+
+	body, err := json.Marshal(aggregates)
 	if err != nil {
 		return nil, err
 	}
-
-	var buff *bytes.Buffer
-
-	buff, err = utils.EnvelopeFromBody(eventIdStr, now, "session", map[string]string{}, body)
+	buff, err := utils.EnvelopeFromItems("", now, map[string]string{}, utils.EnvelopeItem{Type: "sessions", Payload: body})
 	if err != nil {
 		return nil, err
 	}
 	return buff.Bytes(), nil
-
 }
 
 // TODO Check if there is a cleaner way to do serialisation.
@@ -253,18 +395,26 @@ func (s SessionJob) MarshalYaml() ([]byte, error) {
 }
 
 func (s SessionJob) intoRaw() sessionJobRaw {
+	var bucketTimeSpread string
+	if s.BucketTimeSpread != 0 {
+		bucketTimeSpread = s.BucketTimeSpread.String()
+	}
 	return sessionJobRaw{
-		NumProjects:     s.NumProjects,
-		StartedRange:    s.StartedRange.String(),
-		DurationRange:   s.DurationRange.String(),
-		NumReleases:     s.NumReleases,
-		NumEnvironments: s.NumEnvironments,
-		NumUsers:        s.NumUsers,
-		OkWeight:        s.OkWeight,
-		ExitedWeight:    s.ExitedWeight,
-		CrashedWeight:   s.CrashedWeight,
-		AbnormalWeight:  s.AbnormalWeight,
-		ErroredWeight:   s.ErroredWeight,
+		NumProjects:          s.NumProjects,
+		StartedRange:         s.StartedRange.String(),
+		DurationRange:        s.DurationRange.String(),
+		NumReleases:          s.NumReleases,
+		NumEnvironments:      s.NumEnvironments,
+		NumUsers:             s.NumUsers,
+		OkWeight:             s.OkWeight,
+		ExitedWeight:         s.ExitedWeight,
+		CrashedWeight:        s.CrashedWeight,
+		AbnormalWeight:       s.AbnormalWeight,
+		ErroredWeight:        s.ErroredWeight,
+		Aggregates:           s.Aggregates,
+		BucketsPerEnvelope:   s.BucketsPerEnvelope,
+		BucketTimeSpread:     bucketTimeSpread,
+		MaxSessionsPerBucket: s.MaxSessionsPerBucket,
 	}
 }
 
@@ -292,6 +442,14 @@ func (raw sessionJobRaw) into(result *SessionJob) error {
 	if err != nil {
 		return fmt.Errorf("deserialization error, invalid duration %s passed to durationRange", raw.DurationRange)
 	}
+	var bucketTimeSpread time.Duration
+
+	if len(raw.BucketTimeSpread) > 0 {
+		bucketTimeSpread, err = time.ParseDuration(raw.BucketTimeSpread)
+	}
+	if err != nil {
+		return fmt.Errorf("deserialization error, invalid duration %s passed to bucketTimeSpread", raw.BucketTimeSpread)
+	}
 	result.NumProjects = raw.NumProjects
 	result.StartedRange = startedRange
 	result.DurationRange = durationRange
@@ -303,24 +461,32 @@ func (raw sessionJobRaw) into(result *SessionJob) error {
 	result.ErroredWeight = raw.ErroredWeight
 	result.CrashedWeight = raw.CrashedWeight
 	result.AbnormalWeight = raw.AbnormalWeight
+	result.Aggregates = raw.Aggregates
+	result.BucketsPerEnvelope = raw.BucketsPerEnvelope
+	result.BucketTimeSpread = bucketTimeSpread
+	result.MaxSessionsPerBucket = raw.MaxSessionsPerBucket
 	return nil
 }
 
 // / Struct used for serialisation
 type sessionJobRaw struct {
-	NumProjects     int    `json:"numProjects" yaml:"numProjects"`
-	StartedRange    string `json:"startedRange" yaml:"startedRange"`
-	DurationRange   string `json:"durationRange" yaml:"durationRange"`
-	NumReleases     int64  `json:"numReleases" yaml:"numReleases"`
-	NumEnvironments int64  `json:"numEnvironments" yaml:"numEnvironments"`
-	NumUsers        int64  `json:"numUsers" yaml:"numUsers"`
-	OkWeight        int64  `json:"okWeight" yaml:"okWeight"`
-	ExitedWeight    int64  `json:"exitedWeight" yaml:"exitedWeight"`
-	ErroredWeight   int64  `json:"erroredWeight" yaml:"erroredWeight"`
-	CrashedWeight   int64  `json:"crashedWeight" yaml:"crashedWeight"`
-	AbnormalWeight  int64  `json:"abnormalWeight" yaml:"abnormalWeight"`
+	NumProjects          int    `json:"numProjects" yaml:"numProjects"`
+	StartedRange         string `json:"startedRange" yaml:"startedRange"`
+	DurationRange        string `json:"durationRange" yaml:"durationRange"`
+	NumReleases          int64  `json:"numReleases" yaml:"numReleases"`
+	NumEnvironments      int64  `json:"numEnvironments" yaml:"numEnvironments"`
+	NumUsers             int64  `json:"numUsers" yaml:"numUsers"`
+	OkWeight             int64  `json:"okWeight" yaml:"okWeight"`
+	ExitedWeight         int64  `json:"exitedWeight" yaml:"exitedWeight"`
+	ErroredWeight        int64  `json:"erroredWeight" yaml:"erroredWeight"`
+	CrashedWeight        int64  `json:"crashedWeight" yaml:"crashedWeight"`
+	AbnormalWeight       int64  `json:"abnormalWeight" yaml:"abnormalWeight"`
+	Aggregates           bool   `json:"aggregates,omitempty" yaml:"aggregates,omitempty"`
+	BucketsPerEnvelope   int64  `json:"bucketsPerEnvelope,omitempty" yaml:"bucketsPerEnvelope,omitempty"`
+	BucketTimeSpread     string `json:"bucketTimeSpread,omitempty" yaml:"bucketTimeSpread,omitempty"`
+	MaxSessionsPerBucket int64  `json:"maxSessionsPerBucket,omitempty" yaml:"maxSessionsPerBucket,omitempty"`
 }
 
 func init() {
-	RegisterTestType("session", newSessionLoadTester, nil)
+	RegisterSentryTestType("session", newSessionLoadTester, nil)
 }
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,18 +23,31 @@ var session = SessionJob{
 	AbnormalWeight:  10,
 }
 
+var sessionAggregates = SessionJob{
+	NumReleases:          3,
+	NumEnvironments:      4,
+	ExitedWeight:         7,
+	ErroredWeight:        8,
+	Aggregates:           true,
+	BucketsPerEnvelope:   5,
+	BucketTimeSpread:     10 * time.Minute,
+	MaxSessionsPerBucket: 20,
+}
+
 func TestSessionJobJsonSerialisation(t *testing.T) {
-	data, err := json.Marshal(&session)
-	if err != nil {
-		t.Error("Could not serialize session to JSON")
-	}
-	var result SessionJob
-	err = json.Unmarshal(data, &result)
-	if err != nil {
-		t.Error("Could not deserialize session")
-	}
-	if diff := cmp.Diff(session, result); diff != "" {
-		t.Errorf("Failed to serialize, session JSON serialisation round trip (-expect +actual)\n %s", diff)
+	for _, job := range []SessionJob{session, sessionAggregates} {
+		data, err := json.Marshal(&job)
+		if err != nil {
+			t.Error("Could not serialize session to JSON")
+		}
+		var result SessionJob
+		err = json.Unmarshal(data, &result)
+		if err != nil {
+			t.Error("Could not deserialize session")
+		}
+		if diff := cmp.Diff(job, result); diff != "" {
+			t.Errorf("Failed to serialize, session JSON serialisation round trip (-expect +actual)\n %s", diff)
+		}
 	}
 }
 func TestSessionJobYamlSerialisation(t *testing.T) {
@@ -50,3 +64,38 @@ func TestSessionJobYamlSerialisation(t *testing.T) {
 		t.Errorf("Failed to session JSON serialisation round trip (-expect +actual)\n %s", diff)
 	}
 }
+
+func TestSessionAggregatesBody(t *testing.T) {
+	now := time.Now().UTC()
+	body, err := getSessionAggregatesBody(sessionAggregates)
+	if err != nil {
+		t.Fatalf("Could not create session aggregates: %v", err)
+	}
+	lines := strings.Split(string(body), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Invalid envelope, expected 4 lines (3 and a trailing newline) got %d", len(lines))
+	}
+	if !strings.Contains(lines[1], `"type":"sessions"`) {
+		t.Errorf("Invalid item header %s", lines[1])
+	}
+	var aggregates SessionAggregates
+	if err = json.Unmarshal([]byte(lines[2]), &aggregates); err != nil {
+		t.Fatalf("Could not deserialize session aggregates: %v", err)
+	}
+	if len(aggregates.Aggregates) != 5 {
+		t.Errorf("Expected 5 buckets got %d", len(aggregates.Aggregates))
+	}
+	for _, bucket := range aggregates.Aggregates {
+		started, err := FromUTCString(bucket.Started)
+		if err != nil {
+			t.Errorf("Invalid bucket start %s", bucket.Started)
+		}
+		if started.Second() != 0 || started.After(now) || started.Before(now.Add(-11*time.Minute)) {
+			t.Errorf("Bucket start %s outside of the time spread", bucket.Started)
+		}
+		total := bucket.Exited + bucket.Errored + bucket.Crashed + bucket.Abnormal
+		if total < 1 || total > 20 || bucket.Crashed != 0 || bucket.Abnormal != 0 {
+			t.Errorf("Invalid bucket counts %+v", bucket)
+		}
+	}
+}
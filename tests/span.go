@@ -0,0 +1,279 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+// SpanJob is how a standalone span load test is parameterized
+//
+// Spans are generated by segments (a segment span and a tree of child spans), the spans of a segment are sent
+// in `span` items, spansPerEnvelope at a time, until all spans of the segment are sent. A trace is made of
+// segmentsPerTrace segments, the segments of a trace have the same trace id and are sent to the same project.
+// example:
+// ```json
+// {
+//  "numProjects": 100,
+//  "minSpans": 5,
+//  "maxSpans": 50,
+//  "segmentsPerTrace": 3,
+//  "spansPerEnvelope": 10,
+//  "segmentDurationMin": "100ms",
+//  "segmentDurationMax": "5s",
+//  "operations": ["http.server", "db", "cache.get"],
+//  "measurements": ["lcp", "fcp"],
+//  "numTags": 5,
+//  "numTagValues": 100
+// }
+// ```
+type SpanJob struct {
+	// NumProjects to use in the requests
+	NumProjects int `json:"numProjects" yaml:"numProjects"`
+	// MinSpans the minimum number of child spans in a segment
+	MinSpans uint64 `json:"minSpans,omitempty" yaml:"minSpans,omitempty"`
+	// MaxSpans the maximum number of child spans in a segment (default 10)
+	MaxSpans uint64 `json:"maxSpans,omitempty" yaml:"maxSpans,omitempty"`
+	// SegmentsPerTrace the number of segments in a trace (default 1)
+	SegmentsPerTrace int `json:"segmentsPerTrace,omitempty" yaml:"segmentsPerTrace,omitempty"`
+	// SpansPerEnvelope the maximum number of spans sent in an envelope (default 1)
+	SpansPerEnvelope int `json:"spansPerEnvelope,omitempty" yaml:"spansPerEnvelope,omitempty"`
+	// SegmentDurationMin the minimum duration of a segment
+	SegmentDurationMin utils.StringDuration `json:"segmentDurationMin,omitempty" yaml:"segmentDurationMin,omitempty"`
+	// SegmentDurationMax the maximum duration of a segment (default 1s)
+	SegmentDurationMax utils.StringDuration `json:"segmentDurationMax,omitempty" yaml:"segmentDurationMax,omitempty"`
+	// Operations specifies the operations of the spans (default http.server and db)
+	Operations []string `json:"operations,omitempty" yaml:"operations,omitempty"`
+	// Measurements the measurements set on segment spans (if not specified NO measurements will be generated)
+	Measurements []string `json:"measurements,omitempty" yaml:"measurements,omitempty"`
+	// NumTags the number of tags set on each span
+	NumTags int `json:"numTags,omitempty" yaml:"numTags,omitempty"`
+	// NumTagValues the number of distinct values generated for each tag (default 1)
+	NumTagValues int `json:"numTagValues,omitempty" yaml:"numTagValues,omitempty"`
+}
+
+// StandaloneSpan defines the JSON format of a span item
+type StandaloneSpan struct {
+	Span
+	SegmentId    string                      `json:"segment_id"`
+	IsSegment    bool                        `json:"is_segment"`
+	Measurements map[string]MeasurementValue `json:"measurements,omitempty"`
+}
+
+type MeasurementValue struct {
+	Value float64 `json:"value"`
+}
+
+// spanTraceState is the trace whose spans are being sent
+type spanTraceState struct {
+	projectId    string
+	projectKey   string
+	traceId      string
+	segmentsLeft int
+	// a span of the previous segment (the parent of the next segment)
+	lastSpanId string
+	// the spans of the current segment that were not sent yet
+	spans []StandaloneSpan
+}
+
+// spanLoadTester is used to drive a standalone span load test
+type spanLoadTester struct {
+	PayloadCounter
+	url        string
+	spanJob    SpanJob
+	spansGen   func(transactionId string, traceId string, transactionStart time.Time, timestamp time.Time) []Span
+	measureGen func() map[string]float64
+	traceGen   func() TraceContext
+	// lock to be used when manipulating the trace
+	lock  sync.Mutex
+	trace *spanTraceState
+}
+
+func newSpanLoadTester(url string, rawSpan json.RawMessage) LoadTester {
+	var spanParams SpanJob
+	err := json.Unmarshal(rawSpan, &spanParams)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid span params received\nraw data\n%s", rawSpan)
+	}
+	spanParams = spanJobWithDefaults(spanParams)
+	log.Trace().Msgf("Span generation for:\n%+v", spanParams)
+
+	return &spanLoadTester{
+		PayloadCounter: NewPayloadCounter(PayloadSpans),
+		url:            url,
+		spanJob:        spanParams,
+		spansGen:       SpansGenerator(spanParams.MinSpans, spanParams.MaxSpans, spanParams.Operations),
+		measureGen:     MeasurementsGenerator(spanParams.Measurements),
+		traceGen:       TraceContextGenerator(spanParams.Operations),
+	}
+}
+
+func (slt *spanLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+
+		projectId, projectKey, spans := slt.nextSpans()
+
+		tgt.Method = "POST"
+		tgt.URL = fmt.Sprintf("%s/api/%s/envelope/", slt.url, projectId)
+		tgt.Header = make(http.Header)
+		tgt.Header.Set("X-Sentry-Auth", utils.GetAuthHeader(projectKey))
+		tgt.Header.Set("Content-Type", "application/x-sentry-envelope")
+
+		items := make([]utils.EnvelopeItem, 0, len(spans))
+		for _, span := range spans {
+			body, err := json.Marshal(span)
+			if err != nil {
+				return err
+			}
+			items = append(items, utils.EnvelopeItem{Type: "span", Payload: body})
+		}
+		extraEnvelopeHeaders := map[string]string{
+			"trace_id":   spans[0].TraceId,
+			"public_key": projectKey,
+		}
+		buff, err := utils.EnvelopeFromItems("", time.Now().UTC(), extraEnvelopeHeaders, items...)
+		if err != nil {
+			return err
+		}
+
+		tgt.Body = buff.Bytes()
+		slt.AddUnits(len(spans))
+		log.Trace().Msgf("Attacking project:%s", projectId)
+		return nil
+	}, 0
+}
+
+func (slt *spanLoadTester) ProcessResult(_ *vegeta.Result, _ uint64) {
+	return // nothing to do
+}
+
+// TargetUnits returns the number of spans of a request
+func (slt *spanLoadTester) TargetUnits(tgt *vegeta.Target) uint64 {
+	return countEnvelopeItems(tgt.Body, "span")
+}
+
+// nextSpans returns the next spans to send (at most SpansPerEnvelope spans of the same segment) and the project
+// they are sent to
+func (slt *spanLoadTester) nextSpans() (string, string, []StandaloneSpan) {
+	slt.lock.Lock()
+	defer slt.lock.Unlock()
+
+	if slt.trace == nil || len(slt.trace.spans) == 0 {
+		slt.nextSegment()
+	}
+	trace := slt.trace
+	numSpans := utils.Min(slt.spanJob.SpansPerEnvelope, len(trace.spans))
+	spans := trace.spans[:numSpans]
+	trace.spans = trace.spans[numSpans:]
+	return trace.projectId, trace.projectKey, spans
+}
+
+// nextSegment generates the spans of the next segment, starting a new trace if all the segments of the
+// current trace were generated (must be called with the lock held)
+func (slt *spanLoadTester) nextSegment() {
+	job := slt.spanJob
+	var parentSpanId string
+	if slt.trace == nil || slt.trace.segmentsLeft == 0 {
+		projectProvider := utils.GetProjectProvider()
+		projectId := projectProvider.GetProjectId(job.NumProjects)
+		slt.trace = &spanTraceState{
+			projectId:    projectId,
+			projectKey:   projectProvider.GetProjectInfo(projectId).ProjectKey,
+			traceId:      slt.traceGen().TraceId,
+			segmentsLeft: job.SegmentsPerTrace,
+		}
+	} else {
+		// the segment is called from the previous segment (e.g. an http request to another service)
+		parentSpanId = slt.trace.lastSpanId
+	}
+	slt.trace.segmentsLeft--
+	slt.trace.spans = SegmentSpansGenerator(job, slt.trace.traceId, parentSpanId, slt.spansGen, slt.measureGen)
+	slt.trace.lastSpanId = slt.trace.spans[len(slt.trace.spans)-1].SpanId
+}
+
+// SegmentSpansGenerator generates the spans of a segment (the segment span first)
+func SegmentSpansGenerator(job SpanJob, traceId string, parentSpanId string,
+	spansGen func(transactionId string, traceId string, transactionStart time.Time, timestamp time.Time) []Span,
+	measureGen func() map[string]float64) []StandaloneSpan {
+	durationRange := int64(job.SegmentDurationMax - job.SegmentDurationMin)
+	duration := time.Duration(job.SegmentDurationMin)
+	if durationRange > 0 {
+		duration += time.Duration(rand.Int63n(durationRange))
+	}
+	timestamp := time.Now().UTC()
+	start := timestamp.Add(-duration)
+
+	segment := CreateSpan(parentSpanId, traceId, toUnixTimestamp(timestamp), toUnixTimestamp(start),
+		utils.SimpleRandomChoice(job.Operations))
+	segment.Description = fmt.Sprintf("GET /api/endpoint%d", rand.Intn(100))
+	segmentId := segment.SpanId
+
+	children := spansGen(segmentId, traceId, start, timestamp)
+	retVal := make([]StandaloneSpan, 0, len(children)+1)
+	retVal = append(retVal, StandaloneSpan{Span: segment, SegmentId: segmentId, IsSegment: true})
+	for _, child := range children {
+		retVal = append(retVal, StandaloneSpan{Span: child, SegmentId: segmentId})
+	}
+
+	for idx := range retVal {
+		span := &retVal[idx]
+		span.ExclusiveTime = (span.Timestamp - span.StartTimestamp) * 1000 // milliseconds
+		if job.NumTags > 0 {
+			span.Tags = make(map[string]string, job.NumTags)
+			for tagIdx := 0; tagIdx < job.NumTags; tagIdx++ {
+				span.Tags[fmt.Sprintf("tag%d", tagIdx)] = fmt.Sprintf("value%d", rand.Intn(job.NumTagValues))
+			}
+		}
+	}
+	if measurements := measureGen(); len(measurements) > 0 {
+		retVal[0].Measurements = make(map[string]MeasurementValue, len(measurements))
+		for name, value := range measurements {
+			retVal[0].Measurements[name] = MeasurementValue{Value: value}
+		}
+	}
+	return retVal
+}
+
+// spanJobWithDefaults fills in the defaults for the parameters that were not specified
+func spanJobWithDefaults(job SpanJob) SpanJob {
+	if job.NumProjects <= 0 {
+		job.NumProjects = 1
+	}
+	if job.MaxSpans <= 0 {
+		job.MaxSpans = 10
+	}
+	if job.SegmentsPerTrace <= 0 {
+		job.SegmentsPerTrace = 1
+	}
+	if job.SpansPerEnvelope <= 0 {
+		job.SpansPerEnvelope = 1
+	}
+	if job.SegmentDurationMax <= 0 {
+		job.SegmentDurationMax = utils.StringDuration(time.Second)
+	}
+	if job.SegmentDurationMax < job.SegmentDurationMin {
+		job.SegmentDurationMax = job.SegmentDurationMin
+	}
+	if len(job.Operations) == 0 {
+		job.Operations = []string{"http.server", "db"}
+	}
+	if job.NumTagValues <= 0 {
+		job.NumTagValues = 1
+	}
+	return job
+}
+
+func init() {
+	RegisterSentryTestType("span", newSpanLoadTester, nil)
+}
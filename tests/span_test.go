@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSpansAreSentBySegment(t *testing.T) {
+	loadTester := newSpanLoadTester("http://relay", json.RawMessage(
+		`{"minSpans":3,"maxSpans":6,"segmentsPerTrace":2,"spansPerEnvelope":4,"measurements":["lcp"],"numTags":2}`)).(*spanLoadTester)
+
+	segments := make(map[string][]StandaloneSpan) // segment id -> spans
+	var segmentOrder []string
+	for idx := 0; idx < 50; idx++ {
+		_, _, spans := loadTester.nextSpans()
+		if len(spans) == 0 || len(spans) > 4 {
+			t.Fatalf("invalid number of spans in an envelope %d", len(spans))
+		}
+		for _, span := range spans {
+			if span.SegmentId != spans[0].SegmentId {
+				t.Fatalf("spans of different segments in the same envelope")
+			}
+			if len(span.Tags) != 2 {
+				t.Errorf("expected 2 tags got %v", span.Tags)
+			}
+		}
+		segmentId := spans[0].SegmentId
+		if _, ok := segments[segmentId]; !ok {
+			segmentOrder = append(segmentOrder, segmentId)
+		}
+		segments[segmentId] = append(segments[segmentId], spans...)
+	}
+
+	// the last segment may not be complete
+	segmentOrder = segmentOrder[:len(segmentOrder)-1]
+	for idx, segmentId := range segmentOrder {
+		spans := segments[segmentId]
+		segment := spans[0]
+		if !segment.IsSegment || segment.SpanId != segmentId || len(segment.Measurements) != 1 {
+			t.Errorf("invalid segment span %+v", segment)
+		}
+		if len(spans) < 4 || len(spans) > 7 {
+			t.Errorf("invalid number of spans in segment %d", len(spans))
+		}
+		for _, span := range spans[1:] {
+			if span.IsSegment || span.TraceId != segment.TraceId {
+				t.Errorf("invalid child span %+v", span)
+			}
+		}
+		if idx%2 == 1 {
+			// second segment of the trace, called from the first segment
+			previous := segments[segmentOrder[idx-1]]
+			if segment.TraceId != previous[0].TraceId || segment.ParentSpanId != previous[len(previous)-1].SpanId {
+				t.Errorf("segment not linked to the previous segment of the trace")
+			}
+		} else if len(segment.ParentSpanId) != 0 {
+			t.Errorf("expected the first segment of a trace to be the root")
+		}
+	}
+}
@@ -192,6 +192,7 @@ type TransactionJobV2 struct {
 
 // transactionLoadTester is used to drive a transaction load test
 type transactionLoadTester struct {
+	PayloadCounter
 	url                   string
 	transactionParams     TransactionJobCommon
 	transactionGenerator  func(duration time.Duration) Transaction
@@ -219,6 +220,7 @@ func newTransactionLoadTester(url string, rawTransaction json.RawMessage) LoadTe
 	transactionGenerator := TransactionGenerator(transactionParams.TransactionJobCommon)
 
 	return &transactionLoadTester{
+		PayloadCounter:       NewPayloadCounter(PayloadEvents),
 		transactionGenerator: transactionGenerator,
 		url:                  url,
 		transactionParams:    transactionParams.TransactionJobCommon,
@@ -242,6 +244,7 @@ func newTransactionLoadTesterV2(url string, rawTransaction json.RawMessage) Load
 	transactionGenerator := TransactionGenerator(transactionParams.TransactionJobCommon)
 
 	return &transactionLoadTester{
+		PayloadCounter:        NewPayloadCounter(PayloadEvents),
 		transactionGenerator:  transactionGenerator,
 		url:                   url,
 		transactionParams:     transactionParams.TransactionJobCommon,
@@ -365,6 +368,7 @@ func (tlt *transactionLoadTester) GetTargeter() (vegeta.Targeter, uint64) {
 		}
 
 		tgt.Body = buff.Bytes()
+		tlt.AddUnits(1)
 		log.Trace().Msgf("Attacking project:%s", projectId)
 		return nil
 	}, 0
@@ -453,6 +457,6 @@ func TransactionGenerator(job TransactionJobCommon) func(time.Duration) Transact
 }
 
 func init() {
-	RegisterTestType("transaction", newTransactionLoadTester, nil)
-	RegisterTestType("transactionV2", newTransactionLoadTesterV2, nil)
+	RegisterSentryTestType("transaction", newTransactionLoadTester, nil)
+	RegisterSentryTestType("transactionV2", newTransactionLoadTesterV2, nil)
 }
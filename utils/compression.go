@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms for request bodies (the values are the Content-Encoding of the compressed bodies)
+const (
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+	CompressionBrotli  = "br"
+	CompressionZstd    = "zstd"
+)
+
+// zstdEncoder is shared by all compressions (EncodeAll is safe for concurrent use)
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// Compress compresses the body with the specified algorithm (one of the Compression constants)
+func Compress(algorithm string, body []byte) ([]byte, error) {
+	var buff bytes.Buffer
+	switch algorithm {
+	case CompressionGzip:
+		writer := gzip.NewWriter(&buff)
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionDeflate:
+		// the HTTP deflate encoding is the zlib format
+		writer := zlib.NewWriter(&buff)
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionBrotli:
+		writer := brotli.NewWriter(&buff)
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(body, make([]byte, 0, len(body))), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %s", algorithm)
+	}
+	return buff.Bytes(), nil
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompress(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"event_id":"abc","message":"hello"}`), 100)
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		CompressionGzip:    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		CompressionDeflate: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		CompressionBrotli:  func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		CompressionZstd:    func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for algorithm, newReader := range readers {
+		compressed, err := Compress(algorithm, body)
+		if err != nil {
+			t.Fatalf("could not compress with %s: %v", algorithm, err)
+		}
+		if len(compressed) >= len(body) {
+			t.Errorf("%s: expected the body to be compressed got %d bytes from %d", algorithm, len(compressed), len(body))
+		}
+		reader, err := newReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("%s: invalid compressed body: %v", algorithm, err)
+		}
+		decompressed, err := ioutil.ReadAll(reader)
+		if err != nil || !bytes.Equal(decompressed, body) {
+			t.Errorf("%s: the decompressed body does not match the original %v", algorithm, err)
+		}
+	}
+	if _, err := Compress("lzma", body); err == nil {
+		t.Errorf("expected an error for an unknown algorithm")
+	}
+}
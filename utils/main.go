@@ -24,13 +24,29 @@ func GetAuthHeader(projectKey string) string {
 // EnvelopeFromBody  creates the body of a session
 // shamelessly stolen and modified from sentry-go/transport.go
 func EnvelopeFromBody(eventID string, sentAt time.Time, eventType string, extraHeaders map[string]string, body json.RawMessage) (*bytes.Buffer, error) {
+	return EnvelopeFromItems(eventID, sentAt, extraHeaders, EnvelopeItem{Type: eventType, Payload: body})
+}
+
+// EnvelopeItem is an item of an envelope
+//
+// The payload is written as is (it may contain binary data, e.g. for attachments), Headers
+// contains the item headers besides type and length (e.g. filename, content_type).
+type EnvelopeItem struct {
+	Type    string
+	Headers map[string]interface{}
+	Payload []byte
+}
 
+// EnvelopeFromItems creates an envelope containing the specified items
+func EnvelopeFromItems(eventID string, sentAt time.Time, extraHeaders map[string]string, items ...EnvelopeItem) (*bytes.Buffer, error) {
 	var b bytes.Buffer
 	enc := json.NewEncoder(&b)
 	// envelope header
 	envelopeHeaders := map[string]interface{}{
-		"event_id": eventID,
-		"sent_at":  sentAt,
+		"sent_at": sentAt,
+	}
+	if len(eventID) > 0 {
+		envelopeHeaders["event_id"] = eventID
 	}
 	for k, v := range extraHeaders {
 		envelopeHeaders[k] = v
@@ -39,21 +55,21 @@ func EnvelopeFromBody(eventID string, sentAt time.Time, eventType string, extraH
 	if err != nil {
 		return nil, err
 	}
-	// item header
-	err = enc.Encode(struct {
-		Type   string `json:"type"`
-		Length int    `json:"length"`
-	}{
-		Type:   eventType,
-		Length: len(body),
-	})
-	if err != nil {
-		return nil, err
-	}
-	// payload
-	err = enc.Encode(body)
-	if err != nil {
-		return nil, err
+	for _, item := range items {
+		// item header
+		itemHeaders := make(map[string]interface{}, len(item.Headers)+2)
+		for k, v := range item.Headers {
+			itemHeaders[k] = v
+		}
+		itemHeaders["type"] = item.Type
+		itemHeaders["length"] = len(item.Payload)
+		err = enc.Encode(itemHeaders)
+		if err != nil {
+			return nil, err
+		}
+		// payload
+		b.Write(item.Payload)
+		b.WriteByte('\n')
 	}
 	return &b, nil
 }
@@ -192,3 +192,25 @@ func TestEnvelopeFromBody(t *testing.T) {
 		t.Errorf("EnvelopeBody error (-expect +actual)\n %s", diff)
 	}
 }
+
+func TestEnvelopeFromItems(t *testing.T) {
+	var d = time.Date(2010, 2, 1, 10, 11, 12, 0, time.UTC)
+	binary := []byte{0, 1, '\n', 0xff}
+	body, err := EnvelopeFromItems("abc", d, nil,
+		EnvelopeItem{Type: "event", Payload: []byte(`{"k1":"v1"}`)},
+		EnvelopeItem{Type: "attachment", Headers: map[string]interface{}{"filename": "a.bin"}, Payload: binary},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create envelope: %v", err)
+	}
+
+	expected := `{"event_id":"abc","sent_at":"2010-02-01T10:11:12Z"}` + "\n" +
+		`{"length":11,"type":"event"}` + "\n" +
+		`{"k1":"v1"}` + "\n" +
+		`{"filename":"a.bin","length":4,"type":"attachment"}` + "\n" +
+		string(binary) + "\n"
+
+	if diff := cmp.Diff(expected, body.String()); diff != "" {
+		t.Errorf("Invalid envelope (-expect +actual)\n %s", diff)
+	}
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Minimal OTLP/HTTP client (JSON encoding) used to export the load tester's own metrics and traces.
+// Only the parts of the OTLP data model that the load tester needs are modeled here.
+// see: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+
+const otlpScopeName = "go-load-tester"
+
+// OTLP span kinds
+const (
+	OtlpSpanKindInternal = 1
+	OtlpSpanKindServer   = 2
+	OtlpSpanKindClient   = 3
+)
+
+// OTLP status codes
+const (
+	OtlpStatusUnset = 0
+	OtlpStatusOk    = 1
+	OtlpStatusError = 2
+)
+
+type OtlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 are serialized as strings in OTLP JSON
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type OtlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value OtlpAnyValue `json:"value"`
+}
+
+type OtlpResource struct {
+	Attributes []OtlpKeyValue `json:"attributes,omitempty"`
+}
+
+type OtlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type OtlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// OtlpSpan is a span in the OTLP JSON format (trace and span ids are hex encoded)
+type OtlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []OtlpKeyValue `json:"attributes,omitempty"`
+	Status            OtlpStatus     `json:"status,omitempty"`
+}
+
+type OtlpScopeSpans struct {
+	Scope OtlpScope  `json:"scope"`
+	Spans []OtlpSpan `json:"spans"`
+}
+
+type OtlpResourceSpans struct {
+	Resource   OtlpResource     `json:"resource"`
+	ScopeSpans []OtlpScopeSpans `json:"scopeSpans"`
+}
+
+// OtlpExportTraceServiceRequest is the body of a POST to the /v1/traces OTLP endpoint
+type OtlpExportTraceServiceRequest struct {
+	ResourceSpans []OtlpResourceSpans `json:"resourceSpans"`
+}
+
+type OtlpNumberDataPoint struct {
+	Attributes   []OtlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsDouble     float64        `json:"asDouble"`
+}
+
+type OtlpGauge struct {
+	DataPoints []OtlpNumberDataPoint `json:"dataPoints"`
+}
+
+type OtlpMetric struct {
+	Name  string    `json:"name"`
+	Unit  string    `json:"unit,omitempty"`
+	Gauge OtlpGauge `json:"gauge"`
+}
+
+type OtlpScopeMetrics struct {
+	Scope   OtlpScope    `json:"scope"`
+	Metrics []OtlpMetric `json:"metrics"`
+}
+
+type OtlpResourceMetrics struct {
+	Resource     OtlpResource       `json:"resource"`
+	ScopeMetrics []OtlpScopeMetrics `json:"scopeMetrics"`
+}
+
+// OtlpExportMetricsServiceRequest is the body of a POST to the /v1/metrics OTLP endpoint
+type OtlpExportMetricsServiceRequest struct {
+	ResourceMetrics []OtlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// OtlpExporter sends metrics and spans to an OTLP/HTTP collector
+//
+// Metrics are sent immediately, spans are buffered (with AddSpan) and sent on Flush.
+type OtlpExporter struct {
+	endpoint string
+	client   http.Client
+	resource OtlpResource
+	lock     sync.Mutex
+	spans    []OtlpSpan
+}
+
+// maxBufferedSpans limits the memory used by spans that could not be delivered yet
+const maxBufferedSpans = 10_000
+
+// GetOtlpExporter creates an exporter that sends data to the OTLP collector at the specified url
+// (e.g. http://localhost:4318). Returns nil if no endpoint is specified.
+func GetOtlpExporter(endpoint string, serviceName string) *OtlpExporter {
+	if len(endpoint) == 0 {
+		log.Warn().Msgf("No OTLP endpoint configured, will not export OpenTelemetry data")
+		return nil
+	}
+	resourceAttributes := map[string]any{"service.name": serviceName}
+	ip, err := GetExternalIPv4()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not get IP, OTLP resource will not be tagged with it")
+	} else {
+		resourceAttributes["host.ip"] = ip
+	}
+	log.Info().Msgf("Initialized OTLP exporter, sending data to: %s", endpoint)
+	return &OtlpExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   http.Client{Timeout: 5 * time.Second},
+		resource: OtlpResource{Attributes: OtlpAttributes(resourceAttributes)},
+	}
+}
+
+// ExportGauges sends the passed gauges (all with the same attributes) to the collector
+func (e *OtlpExporter) ExportGauges(gauges map[string]float64, attributes map[string]any) error {
+	if e == nil || len(gauges) == 0 {
+		return nil
+	}
+	now := OtlpTime(time.Now())
+	attrs := OtlpAttributes(attributes)
+	metrics := make([]OtlpMetric, 0, len(gauges))
+	for name, value := range gauges {
+		metrics = append(metrics, OtlpMetric{
+			Name: name,
+			Gauge: OtlpGauge{DataPoints: []OtlpNumberDataPoint{
+				{Attributes: attrs, TimeUnixNano: now, AsDouble: value},
+			}},
+		})
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+	req := OtlpExportMetricsServiceRequest{
+		ResourceMetrics: []OtlpResourceMetrics{{
+			Resource:     e.resource,
+			ScopeMetrics: []OtlpScopeMetrics{{Scope: OtlpScope{Name: otlpScopeName}, Metrics: metrics}},
+		}},
+	}
+	return e.post("/v1/metrics", req)
+}
+
+// AddSpan buffers a finished span, it will be sent at the next Flush
+func (e *OtlpExporter) AddSpan(span OtlpSpan) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.spans) >= maxBufferedSpans {
+		log.Warn().Msg("Too many OTLP spans buffered, dropping span")
+		return
+	}
+	e.spans = append(e.spans, span)
+}
+
+// Flush sends all buffered spans to the collector
+func (e *OtlpExporter) Flush() error {
+	if e == nil {
+		return nil
+	}
+	e.lock.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.lock.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+	req := OtlpExportTraceServiceRequest{
+		ResourceSpans: []OtlpResourceSpans{{
+			Resource:   e.resource,
+			ScopeSpans: []OtlpScopeSpans{{Scope: OtlpScope{Name: otlpScopeName}, Spans: spans}},
+		}},
+	}
+	return e.post("/v1/traces", req)
+}
+
+func (e *OtlpExporter) post(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP collector returned status %d for %s", resp.StatusCode, path)
+	}
+	return nil
+}
+
+// NewOtlpSpan creates a span, if no traceId is passed a new trace is started
+func NewOtlpSpan(name string, traceId string, parentSpanId string, start time.Time, end time.Time, attributes map[string]any) OtlpSpan {
+	if len(traceId) == 0 {
+		traceId = NewTraceId()
+	}
+	return OtlpSpan{
+		TraceId:           traceId,
+		SpanId:            NewSpanId(),
+		ParentSpanId:      parentSpanId,
+		Name:              name,
+		Kind:              OtlpSpanKindInternal,
+		StartTimeUnixNano: OtlpTime(start),
+		EndTimeUnixNano:   OtlpTime(end),
+		Attributes:        OtlpAttributes(attributes),
+	}
+}
+
+// End sets the end time of the span
+func (s *OtlpSpan) End(end time.Time) {
+	s.EndTimeUnixNano = OtlpTime(end)
+}
+
+// TraceParent returns the W3C traceparent header value that makes the receiver a child of this span
+func (s OtlpSpan) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceId, s.SpanId)
+}
+
+// ParseTraceParent extracts the trace id and the parent span id from a W3C traceparent header
+func ParseTraceParent(traceParent string) (traceId string, spanId string, err error) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", errors.New("invalid traceparent header")
+	}
+	return parts[1], parts[2], nil
+}
+
+// OtlpAttributes converts a map into an OTLP attribute list (sorted by key)
+// strings, bools, integers and floats are converted into the corresponding OTLP values,
+// anything else is converted to a string.
+func OtlpAttributes(attributes map[string]any) []OtlpKeyValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+	retVal := make([]OtlpKeyValue, 0, len(attributes))
+	for key, val := range attributes {
+		var value OtlpAnyValue
+		switch v := val.(type) {
+		case string:
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int:
+			s := fmt.Sprintf("%d", v)
+			value.IntValue = &s
+		case int64:
+			s := fmt.Sprintf("%d", v)
+			value.IntValue = &s
+		case uint64:
+			s := fmt.Sprintf("%d", v)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprintf("%v", v)
+			value.StringValue = &s
+		}
+		retVal = append(retVal, OtlpKeyValue{Key: key, Value: value})
+	}
+	sort.Slice(retVal, func(i, j int) bool { return retVal[i].Key < retVal[j].Key })
+	return retVal
+}
+
+// OtlpTime formats a time as OTLP JSON expects it (nanoseconds since epoch as a string)
+func OtlpTime(t time.Time) string {
+	return fmt.Sprintf("%d", t.UnixNano())
+}
+
+// NewTraceId returns a random 16 bytes trace id (hex encoded)
+func NewTraceId() string {
+	return UuidAsHex(uuid.New())
+}
+
+// NewSpanId returns a random 8 bytes span id (hex encoded)
+func NewSpanId() string {
+	return UuidAsHex(uuid.New())[0:16]
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encoding of the OTLP trace data model, the field numbers come from the OTLP proto definitions
+// see: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+
+// MarshalProto encodes the request in the OTLP protobuf format (the application/x-protobuf OTLP/HTTP encoding)
+func (r OtlpExportTraceServiceRequest) MarshalProto() ([]byte, error) {
+	var b []byte
+	for _, resourceSpans := range r.ResourceSpans {
+		msg, err := resourceSpans.marshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessage(b, 1, msg)
+	}
+	return b, nil
+}
+
+func (r OtlpResourceSpans) marshalProto() ([]byte, error) {
+	b := appendMessage(nil, 1, r.Resource.marshalProto())
+	for _, scopeSpans := range r.ScopeSpans {
+		msg, err := scopeSpans.marshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessage(b, 2, msg)
+	}
+	return b, nil
+}
+
+func (r OtlpResource) marshalProto() []byte {
+	return appendAttributes(nil, 1, r.Attributes)
+}
+
+func (s OtlpScopeSpans) marshalProto() ([]byte, error) {
+	var scope []byte
+	scope = appendString(scope, 1, s.Scope.Name)
+	scope = appendString(scope, 2, s.Scope.Version)
+	b := appendMessage(nil, 1, scope)
+	for _, span := range s.Spans {
+		msg, err := span.marshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessage(b, 2, msg)
+	}
+	return b, nil
+}
+
+func (s OtlpSpan) marshalProto() ([]byte, error) {
+	var b []byte
+	var err error
+	if b, err = appendHexBytes(b, 1, s.TraceId); err != nil {
+		return nil, err
+	}
+	if b, err = appendHexBytes(b, 2, s.SpanId); err != nil {
+		return nil, err
+	}
+	if b, err = appendHexBytes(b, 4, s.ParentSpanId); err != nil {
+		return nil, err
+	}
+	b = appendString(b, 5, s.Name)
+	if s.Kind != 0 {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s.Kind))
+	}
+	if b, err = appendNanos(b, 7, s.StartTimeUnixNano); err != nil {
+		return nil, err
+	}
+	if b, err = appendNanos(b, 8, s.EndTimeUnixNano); err != nil {
+		return nil, err
+	}
+	b = appendAttributes(b, 9, s.Attributes)
+	var status []byte
+	status = appendString(status, 2, s.Status.Message)
+	if s.Status.Code != 0 {
+		status = protowire.AppendTag(status, 3, protowire.VarintType)
+		status = protowire.AppendVarint(status, uint64(s.Status.Code))
+	}
+	if len(status) > 0 {
+		b = appendMessage(b, 15, status)
+	}
+	return b, nil
+}
+
+func appendAttributes(b []byte, num protowire.Number, attributes []OtlpKeyValue) []byte {
+	for _, attribute := range attributes {
+		var value []byte
+		switch {
+		case attribute.Value.StringValue != nil:
+			value = protowire.AppendTag(value, 1, protowire.BytesType)
+			value = protowire.AppendString(value, *attribute.Value.StringValue)
+		case attribute.Value.BoolValue != nil:
+			value = protowire.AppendTag(value, 2, protowire.VarintType)
+			value = protowire.AppendVarint(value, protowire.EncodeBool(*attribute.Value.BoolValue))
+		case attribute.Value.IntValue != nil:
+			intValue, _ := strconv.ParseInt(*attribute.Value.IntValue, 10, 64)
+			value = protowire.AppendTag(value, 3, protowire.VarintType)
+			value = protowire.AppendVarint(value, uint64(intValue))
+		case attribute.Value.DoubleValue != nil:
+			value = protowire.AppendTag(value, 4, protowire.Fixed64Type)
+			value = protowire.AppendFixed64(value, math.Float64bits(*attribute.Value.DoubleValue))
+		}
+		keyValue := appendString(nil, 1, attribute.Key)
+		keyValue = appendMessage(keyValue, 2, value)
+		b = appendMessage(b, num, keyValue)
+	}
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// appendString appends a string field (empty strings are the default value and are not sent)
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if len(s) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendHexBytes appends a bytes field from its hex representation (the way ids are kept in OtlpSpan)
+func appendHexBytes(b []byte, num protowire.Number, s string) ([]byte, error) {
+	if len(s) == 0 {
+		return b, nil
+	}
+	val, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP id %s: %w", s, err)
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, val), nil
+}
+
+// appendNanos appends a fixed64 timestamp field from its OTLP JSON representation
+func appendNanos(b []byte, num protowire.Number, s string) ([]byte, error) {
+	nanos, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP timestamp %s: %w", s, err)
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, nanos), nil
+}
+
+// OtlpProtoSpanCount returns the number of spans of an OTLP trace request encoded in the protobuf format
+func OtlpProtoSpanCount(b []byte) (int, error) {
+	numSpans := 0
+	resourceSpans, err := protoMessages(b, 1)
+	if err != nil {
+		return 0, err
+	}
+	for _, resourceSpan := range resourceSpans {
+		scopeSpans, err := protoMessages(resourceSpan, 2)
+		if err != nil {
+			return 0, err
+		}
+		for _, scopeSpan := range scopeSpans {
+			spans, err := protoMessages(scopeSpan, 2)
+			if err != nil {
+				return 0, err
+			}
+			numSpans += len(spans)
+		}
+	}
+	return numSpans, nil
+}
+
+// protoMessages returns the (length delimited) fields of a message with the specified field number
+func protoMessages(b []byte, num protowire.Number) ([][]byte, error) {
+	var retVal [][]byte
+	for len(b) > 0 {
+		fieldNum, fieldType, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if fieldNum == num && fieldType == protowire.BytesType {
+			msg, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			retVal = append(retVal, msg)
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(fieldNum, fieldType, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return retVal, nil
+}
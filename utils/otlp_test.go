@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpCollector is a stand-in for an OTLP/HTTP collector, it records the bodies received on each path
+type otlpCollector struct {
+	lock     sync.Mutex
+	requests map[string][][]byte
+}
+
+func newOtlpCollector() (*otlpCollector, *httptest.Server) {
+	collector := &otlpCollector{requests: make(map[string][][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		collector.lock.Lock()
+		defer collector.lock.Unlock()
+		collector.requests[r.URL.Path] = append(collector.requests[r.URL.Path], body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	return collector, server
+}
+
+func (c *otlpCollector) get(path string) [][]byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.requests[path]
+}
+
+func TestOtlpExportGauges(t *testing.T) {
+	collector, server := newOtlpCollector()
+	defer server.Close()
+
+	exporter := GetOtlpExporter(server.URL, "test-service")
+	err := exporter.ExportGauges(map[string]float64{"b.gauge": 2, "a.gauge": 1.5}, map[string]any{"l1": "v1"})
+	if err != nil {
+		t.Fatalf("failed to export gauges: %v", err)
+	}
+
+	requests := collector.get("/v1/metrics")
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 metrics request got %d", len(requests))
+	}
+	var req OtlpExportMetricsServiceRequest
+	if err = json.Unmarshal(requests[0], &req); err != nil {
+		t.Fatalf("could not deserialize metrics request: %v", err)
+	}
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 || metrics[0].Name != "a.gauge" || metrics[1].Name != "b.gauge" {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+	dataPoint := metrics[0].Gauge.DataPoints[0]
+	if dataPoint.AsDouble != 1.5 {
+		t.Errorf("expected gauge value 1.5 got %f", dataPoint.AsDouble)
+	}
+	if len(dataPoint.Attributes) != 1 || *dataPoint.Attributes[0].Value.StringValue != "v1" {
+		t.Errorf("unexpected data point attributes %+v", dataPoint.Attributes)
+	}
+}
+
+func TestOtlpExportSpans(t *testing.T) {
+	collector, server := newOtlpCollector()
+	defer server.Close()
+
+	exporter := GetOtlpExporter(server.URL+"/", "test-service")
+	start := time.Unix(100, 0)
+	parent := NewOtlpSpan("parent", "", "", start, start, nil)
+	parent.End(start.Add(time.Second))
+	traceId, parentId, err := ParseTraceParent(parent.TraceParent())
+	if err != nil {
+		t.Fatalf("could not parse traceparent: %v", err)
+	}
+	child := NewOtlpSpan("child", traceId, parentId, start, start.Add(time.Millisecond), map[string]any{"code": 200})
+
+	exporter.AddSpan(parent)
+	exporter.AddSpan(child)
+	if err = exporter.Flush(); err != nil {
+		t.Fatalf("failed to flush spans: %v", err)
+	}
+	// nothing left to send
+	if err = exporter.Flush(); err != nil {
+		t.Fatalf("failed to flush spans: %v", err)
+	}
+
+	requests := collector.get("/v1/traces")
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 traces request got %d", len(requests))
+	}
+	var req OtlpExportTraceServiceRequest
+	if err = json.Unmarshal(requests[0], &req); err != nil {
+		t.Fatalf("could not deserialize traces request: %v", err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if diff := cmp.Diff([]OtlpSpan{parent, child}, spans); diff != "" {
+		t.Errorf("unexpected spans (-expect +actual)\n %s", diff)
+	}
+	if spans[1].TraceId != spans[0].TraceId || spans[1].ParentSpanId != spans[0].SpanId {
+		t.Errorf("child span not linked to parent span")
+	}
+	if spans[0].EndTimeUnixNano != "101000000000" {
+		t.Errorf("unexpected end time %s", spans[0].EndTimeUnixNano)
+	}
+}
+
+func TestParseInvalidTraceParent(t *testing.T) {
+	for _, traceParent := range []string{"", "00-abc-def-01", "garbage"} {
+		if _, _, err := ParseTraceParent(traceParent); err == nil {
+			t.Errorf("expected error parsing '%s'", traceParent)
+		}
+	}
+}
+
+func TestNilOtlpExporter(t *testing.T) {
+	var exporter = GetOtlpExporter("", "test-service")
+	if exporter != nil {
+		t.Fatalf("expected nil exporter when no endpoint is configured")
+	}
+	// all operations on a nil exporter should be noops
+	exporter.AddSpan(OtlpSpan{})
+	if err := exporter.Flush(); err != nil {
+		t.Error(err)
+	}
+	if err := exporter.ExportGauges(map[string]float64{"x": 1}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// protoFields decodes a protobuf message into its fields (only the bytes and fixed64 fields are kept)
+func protoFields(t *testing.T, msg []byte) map[protowire.Number][][]byte {
+	retVal := make(map[protowire.Number][][]byte)
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			t.Fatalf("invalid protobuf tag")
+		}
+		msg = msg[n:]
+		var val []byte
+		switch typ {
+		case protowire.BytesType:
+			val, n = protowire.ConsumeBytes(msg)
+		case protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(msg)
+			val = protowire.AppendFixed64(nil, v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+		}
+		if n < 0 {
+			t.Fatalf("invalid protobuf field %d", num)
+		}
+		msg = msg[n:]
+		retVal[num] = append(retVal[num], val)
+	}
+	return retVal
+}
+
+func TestOtlpTracesMarshalProto(t *testing.T) {
+	start := time.Unix(100, 0)
+	span := NewOtlpSpan("root", "0123456789abcdef0123456789abcdef", "", start, start.Add(time.Second),
+		map[string]any{"code": 200})
+	span.Status = OtlpStatus{Code: OtlpStatusOk}
+	req := OtlpExportTraceServiceRequest{
+		ResourceSpans: []OtlpResourceSpans{{
+			Resource:   OtlpResource{Attributes: OtlpAttributes(map[string]any{"service.name": "test-service"})},
+			ScopeSpans: []OtlpScopeSpans{{Scope: OtlpScope{Name: otlpScopeName}, Spans: []OtlpSpan{span}}},
+		}},
+	}
+	body, err := req.MarshalProto()
+	if err != nil {
+		t.Fatalf("could not encode request: %v", err)
+	}
+
+	resourceSpans := protoFields(t, protoFields(t, body)[1][0])
+	resource := protoFields(t, resourceSpans[1][0])
+	serviceName := protoFields(t, resource[1][0])
+	if string(serviceName[1][0]) != "service.name" || string(protoFields(t, serviceName[2][0])[1][0]) != "test-service" {
+		t.Errorf("invalid resource attribute")
+	}
+	scopeSpans := protoFields(t, resourceSpans[2][0])
+	if string(protoFields(t, scopeSpans[1][0])[1][0]) != otlpScopeName {
+		t.Errorf("invalid scope")
+	}
+	if len(scopeSpans[2]) != 1 {
+		t.Fatalf("expected 1 span got %d", len(scopeSpans[2]))
+	}
+	fields := protoFields(t, scopeSpans[2][0])
+	if hex.EncodeToString(fields[1][0]) != span.TraceId || hex.EncodeToString(fields[2][0]) != span.SpanId {
+		t.Errorf("invalid span ids")
+	}
+	if _, ok := fields[4]; ok {
+		t.Errorf("root span should not have a parent")
+	}
+	if string(fields[5][0]) != "root" {
+		t.Errorf("invalid span name %s", fields[5][0])
+	}
+	if end, _ := protowire.ConsumeFixed64(fields[8][0]); end != 101_000_000_000 {
+		t.Errorf("invalid end time %d", end)
+	}
+	if len(fields[9]) != 1 || len(fields[15]) != 1 {
+		t.Errorf("expected span attributes and status")
+	}
+	if numSpans, err := OtlpProtoSpanCount(body); err != nil || numSpans != 1 {
+		t.Errorf("expected 1 span got %d (%v)", numSpans, err)
+	}
+}
+
+func TestOtlpTracesMarshalProtoInvalidId(t *testing.T) {
+	span := NewOtlpSpan("root", "not-hex", "", time.Unix(100, 0), time.Unix(101, 0), nil)
+	req := OtlpExportTraceServiceRequest{
+		ResourceSpans: []OtlpResourceSpans{{ScopeSpans: []OtlpScopeSpans{{Spans: []OtlpSpan{span}}}}},
+	}
+	if _, err := req.MarshalProto(); err == nil {
+		t.Errorf("expected an error for an invalid trace id")
+	}
+}
@@ -0,0 +1,105 @@
+package web_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/rs/zerolog/log"
+
+	"github.com/getsentry/go-load-tester/tests"
+)
+
+/*
+Contains code for annotating dashboards with the start and stop of test runs
+*/
+
+const (
+	runStarted = "start"
+	runStopped = "stop"
+)
+
+// runAnnotation is the body of the request sent to the annotations webhook
+type runAnnotation struct {
+	Event       string            `json:"event"` // start or stop
+	Timestamp   time.Time         `json:"timestamp"`
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	TestType    string            `json:"testType"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// runAnnotator sends start/stop events for test runs (as DogStatsD events and/or to an annotations webhook)
+// so that dashboards can mark when each (labeled) test was running.
+type runAnnotator struct {
+	statsdClient *statsd.Client
+	webhookUrl   string
+}
+
+func newRunAnnotator(statsdClient *statsd.Client, webhookUrl string) runAnnotator {
+	return runAnnotator{statsdClient: statsdClient, webhookUrl: webhookUrl}
+}
+
+// annotate sends an event for the test run (event should be runStarted or runStopped)
+func (a runAnnotator) annotate(event string, params tests.TestParams) {
+	if a.statsdClient != nil {
+		err := a.statsdClient.Event(annotationStatsdEvent(event, params))
+		if err != nil {
+			log.Error().Err(err).Msg("Could not send statsd event")
+		}
+	}
+	if len(a.webhookUrl) > 0 {
+		go a.sendToWebhook(runAnnotation{
+			Event:       event,
+			Timestamp:   time.Now().UTC(),
+			Name:        params.Name,
+			Description: params.Description,
+			TestType:    params.TestType,
+			Labels:      params.LabelMap(),
+		})
+	}
+}
+
+func (a runAnnotator) sendToWebhook(annotation runAnnotation) {
+	body, err := json.Marshal(annotation)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not serialize annotation")
+		return
+	}
+	client := getDefaultHttpClient()
+	resp, err := client.Post(a.webhookUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not send annotation to %s", a.webhookUrl)
+		return
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		log.Error().Err(err).Msg("could not close response body")
+	}
+	if resp.StatusCode >= 300 {
+		log.Error().Msgf("Annotations webhook %s returned status %d", a.webhookUrl, resp.StatusCode)
+	}
+}
+
+// annotationStatsdEvent creates the DogStatsD event for a test run start or stop
+func annotationStatsdEvent(event string, params tests.TestParams) *statsd.Event {
+	name := params.Name
+	if len(name) == 0 {
+		name = params.TestType
+	}
+	var title string
+	if event == runStarted {
+		title = fmt.Sprintf("Load test started: %s", name)
+	} else {
+		title = fmt.Sprintf("Load test stopped: %s", name)
+	}
+	text := fmt.Sprintf("%s\ntestType: %s, %d messages per %v for %v", params.Description, params.TestType,
+		params.NumMessages, params.Per, params.AttackDuration)
+	retVal := statsd.NewEvent(title, text)
+	retVal.AggregationKey = name
+	retVal.Tags = append([]string{fmt.Sprintf("event:%s", event), fmt.Sprintf("test_type:%s", params.TestType)},
+		params.LabelTags()...)
+	return retVal
+}
@@ -0,0 +1,239 @@
+package web_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+Contains code for comparing run reports (used to detect regressions between runs)
+*/
+
+// RegressionThresholds configures when the difference between two runs is considered a regression.
+// A threshold of 0 disables the corresponding check.
+type RegressionThresholds struct {
+	// MaxLatencyIncrease is the maximum increase (in percent) of the checked latency percentiles
+	MaxLatencyIncrease float64
+	// LatencyPercentiles are the latencies checked against MaxLatencyIncrease (mean, p50, p90, p95, p99, max)
+	LatencyPercentiles []string
+	// MaxThroughputDecrease is the maximum decrease (in percent) of the throughput (successful requests/second)
+	MaxThroughputDecrease float64
+	// MaxErrorRateIncrease is the maximum increase (in percentage points) of the error rate
+	MaxErrorRateIncrease float64
+}
+
+// MetricComparison is the comparison of a metric between a base and a current run
+type MetricComparison struct {
+	Name    string
+	Base    string
+	Current string
+	// Delta is the formatted difference (relative in percent or, for ratios, in percentage points)
+	Delta string
+	// Regression is set if the difference exceeds the configured threshold
+	Regression string
+}
+
+// ReportComparison is the side by side comparison of two run reports
+type ReportComparison struct {
+	Base    RunReport
+	Current RunReport
+	Metrics []MetricComparison
+}
+
+// Regressions returns the description of the metrics exceeding the regression thresholds
+func (c ReportComparison) Regressions() []string {
+	var retVal []string
+	for _, metric := range c.Metrics {
+		if len(metric.Regression) > 0 {
+			retVal = append(retVal, fmt.Sprintf("%s: %s", metric.Name, metric.Regression))
+		}
+	}
+	return retVal
+}
+
+// CompareRunReports compares a run report against a base run report
+func CompareRunReports(base RunReport, current RunReport, thresholds RegressionThresholds) ReportComparison {
+	checkedLatencies := make(map[string]bool, len(thresholds.LatencyPercentiles))
+	for _, percentile := range thresholds.LatencyPercentiles {
+		checkedLatencies[strings.ToLower(percentile)] = true
+	}
+	retVal := ReportComparison{Base: base, Current: current}
+
+	latencies := []struct {
+		name    string
+		base    time.Duration
+		current time.Duration
+	}{
+		{"mean", time.Duration(base.Latencies.Mean), time.Duration(current.Latencies.Mean)},
+		{"p50", time.Duration(base.Latencies.P50), time.Duration(current.Latencies.P50)},
+		{"p90", time.Duration(base.Latencies.P90), time.Duration(current.Latencies.P90)},
+		{"p95", time.Duration(base.Latencies.P95), time.Duration(current.Latencies.P95)},
+		{"p99", time.Duration(base.Latencies.P99), time.Duration(current.Latencies.P99)},
+		{"max", time.Duration(base.Latencies.Max), time.Duration(current.Latencies.Max)},
+	}
+	for _, latency := range latencies {
+		change := relativeChange(float64(latency.base), float64(latency.current))
+		metric := MetricComparison{
+			Name:    fmt.Sprintf("latency %s", latency.name),
+			Base:    latency.base.String(),
+			Current: latency.current.String(),
+			Delta:   formatPercent(change),
+		}
+		if thresholds.MaxLatencyIncrease > 0 && checkedLatencies[latency.name] && change > thresholds.MaxLatencyIncrease {
+			metric.Regression = fmt.Sprintf("increased by %.2f%% (threshold %.2f%%)", change, thresholds.MaxLatencyIncrease)
+		}
+		retVal.Metrics = append(retVal.Metrics, metric)
+	}
+
+	retVal.Metrics = append(retVal.Metrics, MetricComparison{
+		Name:    "requests",
+		Base:    fmt.Sprintf("%d", base.Requests),
+		Current: fmt.Sprintf("%d", current.Requests),
+		Delta:   formatPercent(relativeChange(float64(base.Requests), float64(current.Requests))),
+	}, MetricComparison{
+		Name:    "rate (req/s)",
+		Base:    fmt.Sprintf("%.2f", base.Rate),
+		Current: fmt.Sprintf("%.2f", current.Rate),
+		Delta:   formatPercent(relativeChange(base.Rate, current.Rate)),
+	})
+
+	throughputChange := relativeChange(base.Throughput, current.Throughput)
+	throughput := MetricComparison{
+		Name:    "throughput (req/s)",
+		Base:    fmt.Sprintf("%.2f", base.Throughput),
+		Current: fmt.Sprintf("%.2f", current.Throughput),
+		Delta:   formatPercent(throughputChange),
+	}
+	if thresholds.MaxThroughputDecrease > 0 && -throughputChange > thresholds.MaxThroughputDecrease {
+		throughput.Regression = fmt.Sprintf("decreased by %.2f%% (threshold %.2f%%)", -throughputChange, thresholds.MaxThroughputDecrease)
+	}
+	retVal.Metrics = append(retVal.Metrics, throughput, MetricComparison{
+		Name:    fmt.Sprintf("%s/s", payloadUnit(base, current)),
+		Base:    fmt.Sprintf("%.2f", base.UnitRate),
+		Current: fmt.Sprintf("%.2f", current.UnitRate),
+		Delta:   formatPercent(relativeChange(base.UnitRate, current.UnitRate)),
+	}, MetricComparison{
+		Name:    "bytes/s",
+		Base:    fmt.Sprintf("%.0f", base.ByteRate),
+		Current: fmt.Sprintf("%.0f", current.ByteRate),
+		Delta:   formatPercent(relativeChange(base.ByteRate, current.ByteRate)),
+	})
+
+	baseErrorRate := errorRate(base)
+	currentErrorRate := errorRate(current)
+	errorRateChange := currentErrorRate - baseErrorRate
+	errors := MetricComparison{
+		Name:    "error rate",
+		Base:    fmt.Sprintf("%.2f%%", baseErrorRate),
+		Current: fmt.Sprintf("%.2f%%", currentErrorRate),
+		Delta:   fmt.Sprintf("%+.2fpp", errorRateChange),
+	}
+	if thresholds.MaxErrorRateIncrease > 0 && errorRateChange > thresholds.MaxErrorRateIncrease {
+		errors.Regression = fmt.Sprintf("increased by %.2fpp (threshold %.2fpp)", errorRateChange, thresholds.MaxErrorRateIncrease)
+	}
+	retVal.Metrics = append(retVal.Metrics, errors)
+	return retVal
+}
+
+// Write writes the comparison as a table
+func (c ReportComparison) Write(w io.Writer) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(writer, "\tbase\tcurrent\tdelta\t\n")
+	_, _ = fmt.Fprintf(writer, "run\t%s\t%s\t\t\n", reportTitle(c.Base), reportTitle(c.Current))
+	for _, metric := range c.Metrics {
+		regression := ""
+		if len(metric.Regression) > 0 {
+			regression = "REGRESSION"
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", metric.Name, metric.Base, metric.Current, metric.Delta, regression)
+	}
+	return writer.Flush()
+}
+
+func reportTitle(report RunReport) string {
+	title := report.Name
+	if len(title) == 0 {
+		title = report.TestType
+	}
+	if len(report.RunId) > 0 {
+		title = fmt.Sprintf("%s (%s)", title, report.RunId)
+	}
+	return title
+}
+
+// payloadUnit returns the payload unit of the compared reports
+func payloadUnit(base RunReport, current RunReport) string {
+	if len(base.Unit) > 0 {
+		return base.Unit
+	}
+	if len(current.Unit) > 0 {
+		return current.Unit
+	}
+	return "units"
+}
+
+// relativeChange returns the change from base to current in percent
+func relativeChange(base float64, current float64) float64 {
+	if base == 0 {
+		if current == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (current - base) / base * 100
+}
+
+func formatPercent(value float64) string {
+	return fmt.Sprintf("%+.2f%%", value)
+}
+
+// errorRate returns the ratio of failed requests in percent
+func errorRate(report RunReport) float64 {
+	if report.Requests == 0 {
+		return 0
+	}
+	return (1 - report.Success) * 100
+}
+
+// LoadRunReport loads a run report saved as JSON (as returned by the worker /report/ or the master /runs/{runId}/ urls)
+func LoadRunReport(fileName string) (RunReport, error) {
+	var retVal RunReport
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return retVal, err
+	}
+	if err = json.Unmarshal(content, &retVal); err != nil {
+		return retVal, fmt.Errorf("invalid run report %s: %w", fileName, err)
+	}
+	return retVal, nil
+}
+
+// FetchRunReport retrieves the report of a run from a master
+func FetchRunReport(masterUrl string, runId string) (RunReport, error) {
+	var retVal RunReport
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s/runs/%s/", strings.TrimSuffix(masterUrl, "/"), url.PathEscape(runId)))
+	if err != nil {
+		return retVal, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return retVal, err
+	}
+	if resp.StatusCode >= 300 {
+		return retVal, fmt.Errorf("master returned status %d for run %s: %s", resp.StatusCode, runId, body)
+	}
+	if err = json.Unmarshal(body, &retVal); err != nil {
+		return retVal, fmt.Errorf("invalid report for run %s: %w", runId, err)
+	}
+	return retVal, nil
+}
@@ -0,0 +1,169 @@
+package web_server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/getsentry/go-load-tester/tests"
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func latencies(mean, p50, p90, p95, p99, max time.Duration) LatencyReport {
+	return LatencyReport{
+		Mean: utils.StringDuration(mean),
+		P50:  utils.StringDuration(p50),
+		P90:  utils.StringDuration(p90),
+		P95:  utils.StringDuration(p95),
+		P99:  utils.StringDuration(p99),
+		Max:  utils.StringDuration(max),
+	}
+}
+
+func TestCompareRunReports(t *testing.T) {
+	ms := time.Millisecond
+	base := RunReport{RunId: "base", Requests: 100, Rate: 10, Throughput: 9.5, Success: 0.95,
+		Latencies: latencies(10*ms, 8*ms, 15*ms, 20*ms, 30*ms, 50*ms)}
+	current := RunReport{RunId: "current", Requests: 100, Rate: 10, Throughput: 8, Success: 0.8,
+		Latencies: latencies(12*ms, 9*ms, 16*ms, 25*ms, 30*ms, 60*ms)}
+
+	testCases := []struct {
+		name       string
+		thresholds RegressionThresholds
+		expected   []string
+	}{
+		{
+			name:     "no thresholds",
+			expected: nil,
+		},
+		{
+			name:       "latency",
+			thresholds: RegressionThresholds{MaxLatencyIncrease: 10, LatencyPercentiles: []string{"P95", "p99"}},
+			expected:   []string{"latency p95: increased by 25.00% (threshold 10.00%)"},
+		},
+		{
+			name:       "latency within threshold",
+			thresholds: RegressionThresholds{MaxLatencyIncrease: 30, LatencyPercentiles: []string{"p95", "p99"}},
+			expected:   nil,
+		},
+		{
+			name:       "throughput",
+			thresholds: RegressionThresholds{MaxThroughputDecrease: 10},
+			expected:   []string{"throughput (req/s): decreased by 15.79% (threshold 10.00%)"},
+		},
+		{
+			name:       "error rate",
+			thresholds: RegressionThresholds{MaxErrorRateIncrease: 5},
+			expected:   []string{"error rate: increased by 15.00pp (threshold 5.00pp)"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			comparison := CompareRunReports(base, current, testCase.thresholds)
+			if diff := cmp.Diff(testCase.expected, comparison.Regressions()); diff != "" {
+				t.Errorf("unexpected regressions (-expect +actual)\n %s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteComparison(t *testing.T) {
+	base := RunReport{RunId: "base", Name: "test", Requests: 10, Success: 1}
+	current := RunReport{RunId: "current", Name: "test", Requests: 10, Success: 0.9}
+	comparison := CompareRunReports(base, current, RegressionThresholds{MaxErrorRateIncrease: 1})
+
+	var output strings.Builder
+	if err := comparison.Write(&output); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"test (base)", "test (current)", "+10.00pp", "REGRESSION"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected '%s' in output:\n%s", expected, output.String())
+		}
+	}
+}
+
+func TestMergeRunReports(t *testing.T) {
+	ms := time.Millisecond
+	start := time.Unix(100, 0).UTC()
+	params := tests.TestParams{Name: "run", TestType: "session", Labels: [][]string{{"relay", "1.0"}}}
+	reports := []RunReport{
+		{Start: start, End: start.Add(10 * time.Second), Requests: 100, Rate: 10, Throughput: 10, Success: 1,
+			BytesOut: 1000, Unit: "events", Units: 100, UnitRate: 10, ByteRate: 100,
+			Latencies:   latencies(ms, ms, 2*ms, 3*ms, 4*ms, 5*ms),
+			StatusCodes: map[string]int{"200": 100}},
+		{Start: start.Add(time.Second), End: start.Add(12 * time.Second), Requests: 300, Rate: 30, Throughput: 15, Success: 0.5,
+			BytesOut: 3000, Unit: "events", Units: 300, UnitRate: 30, ByteRate: 300,
+			Latencies:   latencies(3*ms, 2*ms, 2*ms, 2*ms, 6*ms, 6*ms),
+			StatusCodes: map[string]int{"200": 150, "500": 150}, Errors: []string{"500 Internal Server Error"}},
+		// workers without requests are ignored
+		{},
+	}
+
+	expected := RunReport{
+		RunId:       "id",
+		Name:        "run",
+		TestType:    "session",
+		Labels:      map[string]string{"relay": "1.0"},
+		Start:       start,
+		End:         start.Add(12 * time.Second),
+		Requests:    400,
+		Rate:        40,
+		Throughput:  25,
+		Success:     0.625,
+		BytesOut:    4000,
+		Unit:        "events",
+		Units:       400,
+		UnitRate:    40,
+		ByteRate:    400,
+		Latencies:   latencies(2500*time.Microsecond, 2*ms, 2*ms, 3*ms, 6*ms, 6*ms),
+		StatusCodes: map[string]int{"200": 250, "500": 150},
+		Errors:      []string{"500 Internal Server Error"},
+	}
+
+	if diff := cmp.Diff(expected, mergeRunReports("id", params, reports)); diff != "" {
+		t.Errorf("unexpected report (-expect +actual)\n %s", diff)
+	}
+}
+
+func TestCollectRunReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/report/", workerReportHandler)
+	worker := httptest.NewServer(engine)
+	defer worker.Close()
+
+	params := tests.TestParams{Name: "run", TestType: "session", RunId: "run-1"}
+	setLastReport(RunReport{RunId: "run-1", Requests: 10, Rate: 1, Throughput: 1, Success: 1})
+	defer func() { workerReports.last = nil }()
+	savedRuns := runHistory.runs
+	runHistory.runs = nil
+	defer func() { runHistory.runs = savedRuns }()
+
+	addRun("run-1", params, time.Now())
+	setRunWorkers("run-1", []string{worker.URL})
+	collectRunReports("run-1", setRunEnded("run-1", time.Now()))
+
+	report := getRunReport("run-1")
+	if report == nil || report.Requests != 10 || report.Name != "run" {
+		t.Fatalf("unexpected run report %+v", report)
+	}
+	summaries := getRunSummaries()
+	if len(summaries) == 0 || summaries[0].Id != "run-1" || summaries[0].Reports != 1 || summaries[0].Ended.IsZero() {
+		t.Errorf("unexpected run summaries %+v", summaries)
+	}
+	if getRunReport("unknown") != nil {
+		t.Errorf("expected no report for an unknown run")
+	}
+
+	// a run with the same id replaces the previous one
+	addRun("run-1", params, time.Now())
+	if summaries = getRunSummaries(); len(summaries) != 1 || summaries[0].Reports != 0 {
+		t.Errorf("expected the run to be replaced got %+v", summaries)
+	}
+}
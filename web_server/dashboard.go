@@ -0,0 +1,240 @@
+package web_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/getsentry/go-load-tester/tests"
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+/*
+Contains code for the live dashboard served by the master (under /ui)
+*/
+
+// dashboardRefreshPeriod is how often the worker statistics are collected and pushed to the dashboard
+const dashboardRefreshPeriod = 1 * time.Second
+
+// WorkerStatus is the status of a registered worker as seen by the master
+type WorkerStatus struct {
+	Url      string       `json:"url"`
+	Healthy  bool         `json:"healthy"`
+	LastSeen time.Time    `json:"lastSeen,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Stats    *WorkerStats `json:"stats,omitempty"`
+	// Attack are the (split) parameters the master sent to the worker for the current run
+	Attack *AttackInfo `json:"attack,omitempty"`
+}
+
+// RunInfo describes the run currently controlled by the master
+type RunInfo struct {
+	Id      string     `json:"id"`
+	Attack  AttackInfo `json:"attack"`
+	Started time.Time  `json:"started"`
+}
+
+// TotalStats are the aggregated live statistics of all workers
+//
+// The latency percentiles are approximated by the maximum of the worker percentiles.
+type TotalStats struct {
+	Rate      float64       `json:"rate"`
+	Success   float64       `json:"success"`
+	Requests  uint64        `json:"requests"`
+	Unit      string        `json:"unit,omitempty"`
+	Units     uint64        `json:"units"`
+	UnitRate  float64       `json:"unitRate"`
+	ByteRate  float64       `json:"byteRate"`
+	Latencies LatencyReport `json:"latencies"`
+}
+
+// DashboardSnapshot is the data pushed to the dashboard on each refresh
+type DashboardSnapshot struct {
+	Timestamp   time.Time      `json:"timestamp"`
+	DesiredRate float64        `json:"desiredRate"`
+	Run         *RunInfo       `json:"run,omitempty"`
+	Workers     []WorkerStatus `json:"workers"`
+	Total       TotalStats     `json:"total"`
+}
+
+// dashboardState keeps the last known status of each worker
+var dashboardState struct {
+	lock    sync.Mutex
+	workers map[string]WorkerStatus
+}
+
+// collectWorkerStatsLoop regularly collects the live statistics of all registered workers
+func collectWorkerStatsLoop() {
+	for {
+		collectWorkerStats()
+		time.Sleep(dashboardRefreshPeriod)
+	}
+}
+
+func collectWorkerStats() {
+	workerUrls := getWorkers()
+	client := getDefaultHttpClient()
+	statuses := make([]WorkerStatus, len(workerUrls))
+	var wg sync.WaitGroup
+	wg.Add(len(workerUrls))
+	for idx, workerUrl := range workerUrls {
+		go func(idx int, workerUrl string) {
+			defer wg.Done()
+			statuses[idx] = fetchWorkerStatus(&client, workerUrl)
+		}(idx, workerUrl)
+	}
+	wg.Wait()
+
+	dashboardState.lock.Lock()
+	defer dashboardState.lock.Unlock()
+	previous := dashboardState.workers
+	dashboardState.workers = make(map[string]WorkerStatus, len(statuses))
+	for _, status := range statuses {
+		if !status.Healthy {
+			// keep the last seen date from the previous successful call
+			status.LastSeen = previous[status.Url].LastSeen
+		}
+		dashboardState.workers[status.Url] = status
+	}
+}
+
+func fetchWorkerStatus(client *http.Client, workerUrl string) WorkerStatus {
+	retVal := WorkerStatus{Url: workerUrl}
+	resp, err := client.Get(fmt.Sprintf("%s/stats/", workerUrl))
+	if err != nil {
+		retVal.Error = err.Error()
+		return retVal
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		retVal.Error = err.Error()
+		return retVal
+	}
+	if resp.StatusCode >= 300 {
+		retVal.Error = fmt.Sprintf("worker returned status %d", resp.StatusCode)
+		return retVal
+	}
+	var stats WorkerStats
+	if err = json.Unmarshal(body, &stats); err != nil {
+		retVal.Error = err.Error()
+		return retVal
+	}
+	retVal.Healthy = true
+	retVal.LastSeen = time.Now().UTC()
+	retVal.Stats = &stats
+	return retVal
+}
+
+// getDashboardSnapshot assembles the current dashboard data
+func getDashboardSnapshot() DashboardSnapshot {
+	run, workerParams := getRunInfo()
+
+	dashboardState.lock.Lock()
+	workers := make([]WorkerStatus, 0, len(dashboardState.workers))
+	for _, status := range dashboardState.workers {
+		workers = append(workers, status)
+	}
+	dashboardState.lock.Unlock()
+
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Url < workers[j].Url })
+	for idx := range workers {
+		if params, ok := workerParams[workers[idx].Url]; ok {
+			workers[idx].Attack = newAttackInfo(params)
+		}
+	}
+
+	return DashboardSnapshot{
+		Timestamp:   time.Now().UTC(),
+		DesiredRate: globalMasterMetrics.desiredRate,
+		Run:         run,
+		Workers:     workers,
+		Total:       totalStats(workers),
+	}
+}
+
+// totalStats aggregates the statistics of the healthy workers
+func totalStats(workers []WorkerStatus) TotalStats {
+	var retVal TotalStats
+	var successfulRate float64
+	var weightedMean float64
+	for _, worker := range workers {
+		if !worker.Healthy || worker.Stats == nil {
+			continue
+		}
+		stats := worker.Stats
+		retVal.Rate += stats.Rate
+		retVal.Requests += stats.Requests
+		retVal.Units += stats.Units
+		retVal.UnitRate += stats.UnitRate
+		retVal.ByteRate += stats.ByteRate
+		if len(retVal.Unit) == 0 {
+			retVal.Unit = stats.Unit
+		}
+		successfulRate += stats.Rate * stats.Success
+		weightedMean += stats.Rate * float64(stats.Latencies.Mean)
+		latencies := &retVal.Latencies
+		latencies.P50 = maxDuration(latencies.P50, stats.Latencies.P50)
+		latencies.P90 = maxDuration(latencies.P90, stats.Latencies.P90)
+		latencies.P95 = maxDuration(latencies.P95, stats.Latencies.P95)
+		latencies.P99 = maxDuration(latencies.P99, stats.Latencies.P99)
+		latencies.Max = maxDuration(latencies.Max, stats.Latencies.Max)
+	}
+	if retVal.Rate > 0 {
+		retVal.Success = successfulRate / retVal.Rate
+		retVal.Latencies.Mean = utils.StringDuration(weightedMean / retVal.Rate)
+	}
+	return retVal
+}
+
+func maxDuration(a, b utils.StringDuration) utils.StringDuration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// getRunInfo returns the current run and the parameters sent to each worker
+func getRunInfo() (*RunInfo, map[string]tests.TestParams) {
+	masterRun.lock.Lock()
+	defer masterRun.lock.Unlock()
+	if masterRun.params == nil {
+		return nil, nil
+	}
+	return &RunInfo{
+		Id:      masterRun.runId,
+		Attack:  *newAttackInfo(*masterRun.params),
+		Started: masterRun.started,
+	}, masterRun.workerParams
+}
+
+// dashboardHandler serves the dashboard page
+func dashboardHandler(ctx *gin.Context) {
+	ctx.HTML(http.StatusOK, "ui.html", gin.H{})
+}
+
+// dashboardEventsHandler pushes dashboard snapshots as server-sent events until the client disconnects
+func dashboardEventsHandler(ctx *gin.Context) {
+	ticker := time.NewTicker(dashboardRefreshPeriod)
+	defer ticker.Stop()
+	ctx.SSEvent("stats", getDashboardSnapshot())
+	ctx.Writer.Flush()
+	ctx.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			ctx.SSEvent("stats", getDashboardSnapshot())
+			return true
+		}
+	})
+	log.Trace().Msg("Dashboard client disconnected")
+}
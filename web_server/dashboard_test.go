@@ -0,0 +1,90 @@
+package web_server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/tests"
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+func TestTotalStats(t *testing.T) {
+	workers := []WorkerStatus{
+		{Healthy: true, Stats: &WorkerStats{Rate: 10, Success: 1, Requests: 100,
+			Latencies: LatencyReport{Mean: utils.StringDuration(time.Millisecond), P99: utils.StringDuration(5 * time.Millisecond)}}},
+		{Healthy: true, Stats: &WorkerStats{Rate: 30, Success: 0.5, Requests: 300,
+			Latencies: LatencyReport{Mean: utils.StringDuration(3 * time.Millisecond), P99: utils.StringDuration(4 * time.Millisecond)}}},
+		// unhealthy workers are ignored
+		{Healthy: false, Stats: &WorkerStats{Rate: 1000, Success: 0}},
+	}
+
+	total := totalStats(workers)
+
+	if total.Rate != 40 || total.Requests != 400 {
+		t.Errorf("unexpected rate:%f requests:%d", total.Rate, total.Requests)
+	}
+	if total.Success != 0.625 {
+		t.Errorf("expected success 0.625 got %f", total.Success)
+	}
+	if time.Duration(total.Latencies.Mean) != 2500*time.Microsecond {
+		t.Errorf("expected weighted mean of 2.5ms got %v", time.Duration(total.Latencies.Mean))
+	}
+	if time.Duration(total.Latencies.P99) != 5*time.Millisecond {
+		t.Errorf("expected p99 of 5ms got %v", time.Duration(total.Latencies.P99))
+	}
+}
+
+// payloadLoadTester is a LoadTester stand-in that only reports its payload
+type payloadLoadTester struct {
+	tests.PayloadCounter
+}
+
+func (*payloadLoadTester) GetTargeter() (vegeta.Targeter, uint64) { return nil, 0 }
+
+func (*payloadLoadTester) ProcessResult(*vegeta.Result, uint64) {}
+
+func TestCollectWorkerStats(t *testing.T) {
+	start := time.Now()
+	loadTester := &payloadLoadTester{tests.NewPayloadCounter(tests.PayloadRows)}
+	statsStartAttack(newAttackInfo(labeledParams), loadTester)
+	liveStats.windowStart = start
+	for idx := 0; idx < 5; idx++ {
+		loadTester.AddUnits(10)
+		statsAddResult(&vegeta.Result{Code: 200, Timestamp: start, Latency: time.Millisecond, BytesOut: 100})
+	}
+	rotateStatsWindow(start.Add(time.Second))
+	defer statsStartAttack(nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/stats/", workerStatsHandler)
+	worker := httptest.NewServer(engine)
+	defer worker.Close()
+
+	masterState.workers = []string{worker.URL, "http://127.0.0.1:1"}
+	defer func() { masterState.workers = nil }()
+
+	collectWorkerStats()
+	snapshot := getDashboardSnapshot()
+
+	if len(snapshot.Workers) != 2 {
+		t.Fatalf("expected 2 workers got %d", len(snapshot.Workers))
+	}
+	for _, status := range snapshot.Workers {
+		if status.Url == worker.URL {
+			if !status.Healthy || status.Stats == nil || status.Stats.Rate != 5 || status.Stats.Attack.Name != "name" {
+				t.Errorf("unexpected worker status %+v", status)
+			}
+		} else if status.Healthy {
+			t.Errorf("unreachable worker reported as healthy")
+		}
+	}
+	total := snapshot.Total
+	if total.Rate != 5 || total.Success != 1 || total.Unit != tests.PayloadRows || total.UnitRate != 50 || total.ByteRate != 500 {
+		t.Errorf("unexpected total %+v", snapshot.Total)
+	}
+}
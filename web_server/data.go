@@ -11,6 +11,7 @@ type registerWorkerRequest struct {
 type configParams struct {
 	TargetUrl       string `json:"targetUrl,omitempty"`
 	StatsdServerUrl string `json:"statsdServerUrl,omitempty"`
+	OtlpEndpoint    string `json:"otlpEndpoint,omitempty"`
 }
 type registerWorkerResponse struct {
 	Error  string       `json:"error,omitempty"`
@@ -18,12 +19,13 @@ type registerWorkerResponse struct {
 	Params configParams `json:"params,omitempty"`
 }
 
-func sendServerConfig(targetUrl string, statsdServerUrl string) interface{} {
+func sendServerConfig(targetUrl string, statsdServerUrl string, otlpEndpoint string) interface{} {
 	return registerWorkerResponse{
 		Status: "ok",
 		Params: configParams{
 			TargetUrl:       targetUrl,
 			StatsdServerUrl: statsdServerUrl,
+			OtlpEndpoint:    otlpEndpoint,
 		},
 	}
 }
@@ -30,6 +30,19 @@ var globalMasterMetrics struct {
 	desiredRate float64
 }
 
+// masterRun keeps track of the current run (for annotations and OpenTelemetry traces)
+var masterRun struct {
+	lock         sync.Mutex
+	otlpExporter *utils.OtlpExporter
+	annotator    runAnnotator
+	runId        string
+	params       *tests.TestParams
+	started      time.Time
+	workerParams map[string]tests.TestParams // worker url -> the split parameters sent to the worker
+	span         *utils.OtlpSpan
+	timer        *time.Timer
+}
+
 // getWorkers returns a copy of the workers at the moment of calling
 //
 // Use it to safely get a copy and then release the lock on the masterState
@@ -78,8 +91,8 @@ func removeWorker(url string) {
 }
 
 // collectMasterMetricsLoop regularly produces global master metrics
-func collectMasterMetricsLoop(statsdClient *statsd.Client) {
-	if statsdClient == nil {
+func collectMasterMetricsLoop(statsdClient *statsd.Client, otlpExporter *utils.OtlpExporter) {
+	if statsdClient == nil && otlpExporter == nil {
 		return
 	}
 
@@ -88,29 +101,49 @@ func collectMasterMetricsLoop(statsdClient *statsd.Client) {
 	flushPeriod := 1 * time.Second
 
 	for {
-		_ = statsdClient.Gauge("registered-workers", float64(len(masterState.workers)), tags, sampleRate)
-		_ = statsdClient.Gauge("desired-req-sec", globalMasterMetrics.desiredRate, tags, sampleRate)
+		gauges := map[string]float64{
+			"registered-workers": float64(len(getWorkers())),
+			"desired-req-sec":    globalMasterMetrics.desiredRate,
+		}
+		if statsdClient != nil {
+			for name, value := range gauges {
+				_ = statsdClient.Gauge(name, value, tags, sampleRate)
+			}
+		}
+		if otlpExporter != nil {
+			if err := otlpExporter.ExportGauges(gauges, nil); err != nil {
+				log.Error().Err(err).Msg("Could not export OTLP metrics")
+			}
+		}
 
 		time.Sleep(flushPeriod)
 	}
 }
 
-func RunMasterWebServer(port string, statsdAddr string, targetUrl string) {
+func RunMasterWebServer(port string, statsdAddr string, targetUrl string, otlpEndpoint string, annotationsUrl string) {
 	gin.SetMode(gin.ReleaseMode)
 	var engine = gin.Default()
 	var statsdClient = utils.GetStatsd(statsdAddr)
+	var otlpExporter = utils.GetOtlpExporter(otlpEndpoint, "go-load-tester-master")
+	masterRun.otlpExporter = otlpExporter
+	masterRun.annotator = newRunAnnotator(statsdClient, annotationsUrl)
 
-	go collectMasterMetricsLoop(statsdClient)
+	go collectMasterMetricsLoop(statsdClient, otlpExporter)
+	go collectWorkerStatsLoop()
 
 	engine.Static("/static", "./static")
 	engine.LoadHTMLGlob("templates/*.html")
 
 	engine.GET("/docs", mainDocsHandler)
+	engine.GET("/ui", dashboardHandler)
+	engine.GET("/ui/events", dashboardEventsHandler)
 	engine.GET("/stop/", masterStopHandler)
 	engine.POST("/stop/", masterStopHandler)
 	engine.POST("/command/", handlerWithStatsd(statsdClient, masterCommandHandler))
-	engine.POST("/register/", masterRegisterHandlerFactory(statsdAddr, targetUrl))
+	engine.POST("/register/", masterRegisterHandlerFactory(statsdAddr, targetUrl, otlpEndpoint))
 	engine.POST("/unregister/", masterUnregisterHandler)
+	engine.GET("/runs/", masterRunsHandler)
+	engine.GET("/runs/:runId/", masterRunReportHandler)
 	if len(port) > 0 {
 		port = fmt.Sprintf(":%s", port)
 	}
@@ -139,6 +172,8 @@ func ForwardAttack(params tests.TestParams) {
 		log.Error().Err(err).Msg("Error generating request")
 		return
 	}
+	setRunWorkerParams(workerUrls, workerParams)
+	setRunWorkers(params.RunId, workerUrls)
 
 	client := getDefaultHttpClient()
 
@@ -156,6 +191,10 @@ func ForwardAttack(params tests.TestParams) {
 				log.Error().Err(err).Msgf("could not create request for url: `%s`", workerUrl)
 				return
 			}
+			if len(params.TraceParent) > 0 {
+				req.Header.Set("traceparent", params.TraceParent)
+			}
+			req.Header.Set(runIdHeader, params.RunId)
 			resp, err := client.Do(req)
 			if err != nil {
 				log.Error().Err(err).Msgf(" error sending command to client '%s'", workerUrl)
@@ -209,6 +248,7 @@ func masterStopHandler(ctx *gin.Context) {
 	var workerUrls = getWorkers()
 	var client = getDefaultHttpClient()
 	globalMasterMetrics.desiredRate = 0
+	endRun()
 	for _, worker := range workerUrls {
 		go func(workerUrl string) {
 			var stopUrl = fmt.Sprintf("%s/stop/", workerUrl)
@@ -243,16 +283,18 @@ func masterCommandHandler(statsdClient *statsd.Client, ctx *gin.Context) {
 		return
 	}
 	globalMasterMetrics.desiredRate = freq
+	params.RunId, params.TraceParent = startRun(params)
 	go ForwardAttack(params) // no need to wait for sending it to clients
+	ctx.Header(runIdHeader, params.RunId)
 	ctx.JSON(http.StatusOK, "Attack forwarded to workers")
 }
 
-func masterRegisterHandlerFactory(statsdClient string, targetUrl string) func(*gin.Context) {
+func masterRegisterHandlerFactory(statsdClient string, targetUrl string, otlpEndpoint string) func(*gin.Context) {
 	return func(ctx *gin.Context) {
 		var workerReq registerWorkerRequest
 		if err := ctx.ShouldBindJSON(&workerReq); err == nil {
 			addWorker(workerReq.WorkerUrl)
-			ctx.JSON(http.StatusOK, sendServerConfig(targetUrl, statsdClient))
+			ctx.JSON(http.StatusOK, sendServerConfig(targetUrl, statsdClient, otlpEndpoint))
 		} else {
 			log.Error().Err(err).Msg("Error while trying to register worker")
 			ctx.JSON(http.StatusBadRequest, errorJsonResponse("Could not parse registration request"))
@@ -260,6 +302,73 @@ func masterRegisterHandlerFactory(statsdClient string, targetUrl string) func(*g
 	}
 }
 
+// startRun ends the previous run (if still running) and starts tracking the new run (run history,
+// annotations and OpenTelemetry span). It returns the id of the new run and the W3C traceparent that
+// workers should use for their attack spans (empty when not exporting traces).
+func startRun(params tests.TestParams) (string, string) {
+	endRun()
+	masterRun.lock.Lock()
+	defer masterRun.lock.Unlock()
+	masterRun.started = time.Now().UTC()
+	masterRun.runId = newRunId(masterRun.started)
+	params.RunId = masterRun.runId
+	masterRun.params = &params
+	addRun(masterRun.runId, params, masterRun.started)
+	masterRun.annotator.annotate(runStarted, params)
+	// the run ends by itself after the attack duration (if not stopped or replaced earlier)
+	masterRun.timer = time.AfterFunc(params.AttackDuration, endRun)
+	if masterRun.otlpExporter == nil {
+		return masterRun.runId, ""
+	}
+	now := time.Now()
+	span := utils.NewOtlpSpan("master.run", "", "", now, now, params.Attributes())
+	span.Kind = utils.OtlpSpanKindServer
+	masterRun.span = &span
+	return masterRun.runId, span.TraceParent()
+}
+
+// setRunWorkerParams records the parameters sent to each worker for the current run
+func setRunWorkerParams(workerUrls []string, workerParams []tests.TestParams) {
+	masterRun.lock.Lock()
+	defer masterRun.lock.Unlock()
+	masterRun.workerParams = make(map[string]tests.TestParams, len(workerUrls))
+	for idx, workerUrl := range workerUrls {
+		masterRun.workerParams[workerUrl] = workerParams[idx]
+	}
+}
+
+// endRun ends the current run (if any), annotating its end and sending its span to the collector
+func endRun() {
+	masterRun.lock.Lock()
+	defer masterRun.lock.Unlock()
+	if masterRun.params == nil {
+		return
+	}
+	if masterRun.timer != nil {
+		masterRun.timer.Stop()
+		masterRun.timer = nil
+	}
+	masterRun.annotator.annotate(runStopped, *masterRun.params)
+	if workerUrls := setRunEnded(masterRun.runId, time.Now().UTC()); len(workerUrls) > 0 {
+		go collectRunReports(masterRun.runId, workerUrls)
+	}
+	masterRun.runId = ""
+	masterRun.params = nil
+	masterRun.workerParams = nil
+	if masterRun.span == nil {
+		return
+	}
+	span := *masterRun.span
+	masterRun.span = nil
+	span.End(time.Now())
+	masterRun.otlpExporter.AddSpan(span)
+	go func() {
+		if err := masterRun.otlpExporter.Flush(); err != nil {
+			log.Error().Err(err).Msg("Could not export OTLP spans")
+		}
+	}()
+}
+
 func masterUnregisterHandler(ctx *gin.Context) {
 	var workerReq registerWorkerRequest
 	if err := ctx.ShouldBindJSON(&workerReq); err == nil {
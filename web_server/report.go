@@ -0,0 +1,131 @@
+package web_server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/tests"
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+/*
+Contains code for run reports (summaries of the results of an attack)
+*/
+
+// LatencyReport contains the latency statistics of an attack
+type LatencyReport struct {
+	Mean utils.StringDuration `json:"mean"`
+	P50  utils.StringDuration `json:"p50"`
+	P90  utils.StringDuration `json:"p90"`
+	P95  utils.StringDuration `json:"p95"`
+	P99  utils.StringDuration `json:"p99"`
+	Max  utils.StringDuration `json:"max"`
+}
+
+// RunReport summarizes the results of an attack, it is annotated with the attack parameters and labels
+type RunReport struct {
+	RunId                string            `json:"runId,omitempty"`
+	Name                 string            `json:"name,omitempty"`
+	Description          string            `json:"description,omitempty"`
+	TestType             string            `json:"testType"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	Start                time.Time         `json:"start"`
+	End                  time.Time         `json:"end"`
+	Requests             uint64            `json:"requests"`
+	Rate                 float64           `json:"rate"`
+	Throughput           float64           `json:"throughput"`
+	Success              float64           `json:"success"`
+	BytesIn              uint64            `json:"bytesIn"`
+	BytesOut             uint64            `json:"bytesOut"`
+	UncompressedBytesOut uint64            `json:"uncompressedBytesOut"`         // request body bytes before compression
+	SuppressedRequests   uint64            `json:"suppressedRequests,omitempty"` // requests not sent because of rate limits
+	SuppressedUnits      uint64            `json:"suppressedUnits,omitempty"`    // payload units of the suppressed requests
+	Unit                 string            `json:"unit,omitempty"`               // the logical unit carried by the requests (e.g. events, rows)
+	Units                uint64            `json:"units"`
+	UnitRate             float64           `json:"unitRate"` // units/second
+	ByteRate             float64           `json:"byteRate"` // request body bytes/second
+	Latencies            LatencyReport     `json:"latencies"`
+	StatusCodes          map[string]int    `json:"statusCodes,omitempty"`
+	Errors               []string          `json:"errors,omitempty"`
+}
+
+// newRunReport creates a report from the (closed) metrics of an attack and the payload units it sent
+func newRunReport(params tests.TestParams, metrics *vegeta.Metrics, unit string, units uint64) RunReport {
+	if metrics.Requests == 0 {
+		// nothing was sent (vegeta statistics are NaN without requests)
+		return RunReport{
+			RunId:       params.RunId,
+			Name:        params.Name,
+			Description: params.Description,
+			TestType:    params.TestType,
+			Labels:      params.LabelMap(),
+			Unit:        unit,
+		}
+	}
+	var unitRate, byteRate float64
+	if seconds := metrics.Duration.Seconds(); seconds > 0 {
+		unitRate = float64(units) / seconds
+		byteRate = float64(metrics.BytesOut.Total) / seconds
+	}
+	return RunReport{
+		RunId:       params.RunId,
+		Name:        params.Name,
+		Description: params.Description,
+		TestType:    params.TestType,
+		Labels:      params.LabelMap(),
+		Start:       metrics.Earliest,
+		End:         metrics.End,
+		Requests:    metrics.Requests,
+		Rate:        metrics.Rate,
+		Throughput:  metrics.Throughput,
+		Success:     metrics.Success,
+		BytesIn:     metrics.BytesIn.Total,
+		BytesOut:    metrics.BytesOut.Total,
+		Unit:        unit,
+		Units:       units,
+		UnitRate:    unitRate,
+		ByteRate:    byteRate,
+		Latencies: LatencyReport{
+			Mean: utils.StringDuration(metrics.Latencies.Mean),
+			P50:  utils.StringDuration(metrics.Latencies.P50),
+			P90:  utils.StringDuration(metrics.Latencies.Quantile(0.90)),
+			P95:  utils.StringDuration(metrics.Latencies.P95),
+			P99:  utils.StringDuration(metrics.Latencies.P99),
+			Max:  utils.StringDuration(metrics.Latencies.Max),
+		},
+		StatusCodes: metrics.StatusCodes,
+		Errors:      metrics.Errors,
+	}
+}
+
+// workerReports keeps the report of the last finished attack
+var workerReports struct {
+	lock sync.Mutex
+	last *RunReport
+}
+
+func setLastReport(report RunReport) {
+	workerReports.lock.Lock()
+	defer workerReports.lock.Unlock()
+	workerReports.last = &report
+}
+
+func getLastReport() *RunReport {
+	workerReports.lock.Lock()
+	defer workerReports.lock.Unlock()
+	return workerReports.last
+}
+
+// workerReportHandler returns the report of the last finished attack
+func workerReportHandler(ctx *gin.Context) {
+	report := getLastReport()
+	if report == nil {
+		ctx.JSON(http.StatusNotFound, errorJsonResponse("No attack finished yet"))
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
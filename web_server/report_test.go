@@ -0,0 +1,107 @@
+package web_server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/tests"
+)
+
+var labeledParams = tests.TestParams{
+	Name:           "name",
+	TestType:       "session",
+	AttackDuration: time.Minute,
+	NumMessages:    10,
+	Per:            time.Second,
+	Labels:         [][]string{{"relay", "22.10"}, {"env", "test"}},
+}
+
+func TestNewRunReport(t *testing.T) {
+	var metrics vegeta.Metrics
+	start := time.Unix(1000, 0)
+	for idx := 0; idx < 10; idx++ {
+		code := uint16(200)
+		if idx == 0 {
+			code = 500
+		}
+		metrics.Add(&vegeta.Result{
+			Code:      code,
+			Timestamp: start.Add(time.Duration(idx) * time.Second),
+			Latency:   time.Duration(idx+1) * time.Millisecond,
+			BytesOut:  100,
+		})
+	}
+	metrics.Close()
+
+	report := newRunReport(labeledParams, &metrics, tests.PayloadEvents, 45)
+
+	if diff := cmp.Diff(map[string]string{"relay": "22.10", "env": "test"}, report.Labels); diff != "" {
+		t.Errorf("unexpected labels (-expect +actual)\n %s", diff)
+	}
+	if report.Requests != 10 || report.Success != 0.9 {
+		t.Errorf("unexpected requests:%d, success:%f", report.Requests, report.Success)
+	}
+	// the requests were sent over 9 seconds
+	if report.Unit != tests.PayloadEvents || report.Units != 45 || report.UnitRate != 5 || report.ByteRate != 1000.0/9 {
+		t.Errorf("unexpected payload unit:%s units:%d unitRate:%f byteRate:%f", report.Unit, report.Units,
+			report.UnitRate, report.ByteRate)
+	}
+	if time.Duration(report.Latencies.Max) != 10*time.Millisecond {
+		t.Errorf("unexpected max latency %v", time.Duration(report.Latencies.Max))
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("could not serialize report: %v", err)
+	}
+}
+
+func TestNewRunReportWithoutRequests(t *testing.T) {
+	var metrics vegeta.Metrics
+	metrics.Close()
+	report := newRunReport(labeledParams, &metrics, tests.PayloadRequests, 0)
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("could not serialize empty report: %v", err)
+	}
+}
+
+func TestAnnotationStatsdEvent(t *testing.T) {
+	event := annotationStatsdEvent(runStarted, labeledParams)
+	expectedTags := []string{"event:start", "test_type:session", "relay:22.10", "env:test"}
+	if diff := cmp.Diff(expectedTags, event.Tags); diff != "" {
+		t.Errorf("unexpected event tags (-expect +actual)\n %s", diff)
+	}
+	if event.Title != "Load test started: name" {
+		t.Errorf("unexpected event title %s", event.Title)
+	}
+}
+
+func TestAnnotationWebhook(t *testing.T) {
+	received := make(chan runAnnotation, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var annotation runAnnotation
+		if err := json.Unmarshal(body, &annotation); err != nil {
+			t.Errorf("could not deserialize annotation: %v", err)
+		}
+		received <- annotation
+	}))
+	defer server.Close()
+
+	annotator := newRunAnnotator(nil, server.URL)
+	annotator.annotate(runStopped, labeledParams)
+
+	select {
+	case annotation := <-received:
+		if annotation.Event != runStopped || annotation.Name != "name" || annotation.Labels["env"] != "test" {
+			t.Errorf("unexpected annotation %+v", annotation)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("annotation not received by webhook")
+	}
+}
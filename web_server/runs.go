@@ -0,0 +1,313 @@
+package web_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/getsentry/go-load-tester/tests"
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+/*
+Contains code for the run history kept by the master (used to retrieve and compare run reports)
+*/
+
+// runIdHeader is the http header used by the master to pass the run id to the workers
+const runIdHeader = "X-Load-Tester-Run-Id"
+
+// maxRunHistory is the maximum number of runs remembered by the master
+const maxRunHistory = 100
+
+// reportCollectionTimeout is how long the master waits for the workers to finish a run and produce their reports
+const reportCollectionTimeout = 30 * time.Second
+
+// RunSummary describes a run in the run history of the master
+type RunSummary struct {
+	Id       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	TestType string            `json:"testType"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Started  time.Time         `json:"started"`
+	Ended    time.Time         `json:"ended,omitempty"`
+	Workers  int               `json:"workers"`
+	Reports  int               `json:"reports"`
+}
+
+// runRecord keeps the parameters of a run and the reports of the workers that took part in it
+type runRecord struct {
+	id            string
+	params        tests.TestParams
+	started       time.Time
+	ended         time.Time
+	workers       []string
+	workerReports map[string]RunReport // worker url -> report
+}
+
+// runHistory keeps the last maxRunHistory runs (oldest first)
+var runHistory struct {
+	lock sync.Mutex
+	runs []*runRecord
+}
+
+// newRunId creates a (sortable) id for a run
+func newRunId(now time.Time) string {
+	return fmt.Sprintf("%s-%04x", now.UTC().Format("20060102-150405"), rand.Intn(0x10000))
+}
+
+// addRun adds a new run to the run history (a run with the same id is replaced)
+func addRun(runId string, params tests.TestParams, started time.Time) {
+	runHistory.lock.Lock()
+	defer runHistory.lock.Unlock()
+	runs := make([]*runRecord, 0, len(runHistory.runs)+1)
+	for _, run := range runHistory.runs {
+		if run.id != runId {
+			runs = append(runs, run)
+		}
+	}
+	runHistory.runs = append(runs, &runRecord{
+		id:            runId,
+		params:        params,
+		started:       started,
+		workerReports: make(map[string]RunReport),
+	})
+	if len(runHistory.runs) > maxRunHistory {
+		runHistory.runs = runHistory.runs[len(runHistory.runs)-maxRunHistory:]
+	}
+}
+
+// getRun returns the run with the specified id (must be called with the runHistory lock held)
+func getRun(runId string) *runRecord {
+	for _, run := range runHistory.runs {
+		if run.id == runId {
+			return run
+		}
+	}
+	return nil
+}
+
+// setRunWorkers records the workers that took part in a run
+func setRunWorkers(runId string, workerUrls []string) {
+	runHistory.lock.Lock()
+	defer runHistory.lock.Unlock()
+	if run := getRun(runId); run != nil {
+		run.workers = workerUrls
+	}
+}
+
+// setRunEnded marks a run as ended and returns the workers that took part in it
+func setRunEnded(runId string, ended time.Time) []string {
+	runHistory.lock.Lock()
+	defer runHistory.lock.Unlock()
+	if run := getRun(runId); run != nil {
+		run.ended = ended
+		return run.workers
+	}
+	return nil
+}
+
+// addWorkerReport records the report of a worker for a run
+func addWorkerReport(runId string, workerUrl string, report RunReport) {
+	runHistory.lock.Lock()
+	defer runHistory.lock.Unlock()
+	if run := getRun(runId); run != nil {
+		run.workerReports[workerUrl] = report
+	}
+}
+
+// getRunSummaries returns the runs in the run history (most recent first)
+func getRunSummaries() []RunSummary {
+	runHistory.lock.Lock()
+	defer runHistory.lock.Unlock()
+	retVal := make([]RunSummary, 0, len(runHistory.runs))
+	for idx := len(runHistory.runs) - 1; idx >= 0; idx-- {
+		run := runHistory.runs[idx]
+		retVal = append(retVal, RunSummary{
+			Id:       run.id,
+			Name:     run.params.Name,
+			TestType: run.params.TestType,
+			Labels:   run.params.LabelMap(),
+			Started:  run.started,
+			Ended:    run.ended,
+			Workers:  len(run.workers),
+			Reports:  len(run.workerReports),
+		})
+	}
+	return retVal
+}
+
+// getRunReport returns the report of a run, merged from the reports of its workers
+//
+// It returns nil if the run is not known or none of its workers has reported yet.
+func getRunReport(runId string) *RunReport {
+	runHistory.lock.Lock()
+	defer runHistory.lock.Unlock()
+	run := getRun(runId)
+	if run == nil || len(run.workerReports) == 0 {
+		return nil
+	}
+	reports := make([]RunReport, 0, len(run.workerReports))
+	for _, report := range run.workerReports {
+		reports = append(reports, report)
+	}
+	retVal := mergeRunReports(run.id, run.params, reports)
+	return &retVal
+}
+
+// collectRunReports retrieves the reports of the workers that took part in a run
+//
+// Workers may still be finishing the attack when the run ends, so their reports are polled until
+// all of them are available (or until reportCollectionTimeout).
+func collectRunReports(runId string, workerUrls []string) {
+	client := getDefaultHttpClient()
+	pending := make(map[string]bool, len(workerUrls))
+	for _, workerUrl := range workerUrls {
+		pending[workerUrl] = true
+	}
+	deadline := time.Now().Add(reportCollectionTimeout)
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		for workerUrl := range pending {
+			report, err := fetchWorkerReport(&client, workerUrl)
+			if err != nil {
+				log.Trace().Err(err).Msgf("Could not get report from worker %s", workerUrl)
+				continue
+			}
+			if report.RunId != runId {
+				// the worker did not finish the run yet
+				continue
+			}
+			addWorkerReport(runId, workerUrl, *report)
+			delete(pending, workerUrl)
+		}
+	}
+	if len(pending) > 0 {
+		log.Error().Msgf("Could not collect reports for run %s from %d workers", runId, len(pending))
+	} else {
+		log.Info().Msgf("Collected reports for run %s", runId)
+	}
+}
+
+func fetchWorkerReport(client *http.Client, workerUrl string) (*RunReport, error) {
+	resp, err := client.Get(fmt.Sprintf("%s/report/", workerUrl))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("worker returned status %d", resp.StatusCode)
+	}
+	var report RunReport
+	if err = json.Unmarshal(body, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// mergeRunReports combines the reports of the workers that took part in a run into the report of the run
+//
+// Counters and rates are summed, the success ratio and the mean latency are weighted by the number of
+// requests and the latency percentiles are approximated by the maximum of the worker percentiles.
+func mergeRunReports(runId string, params tests.TestParams, reports []RunReport) RunReport {
+	retVal := RunReport{
+		RunId:       runId,
+		Name:        params.Name,
+		Description: params.Description,
+		TestType:    params.TestType,
+		Labels:      params.LabelMap(),
+	}
+	var successful float64
+	var weightedMean float64
+	for _, report := range reports {
+		// a worker may have suppressed all its requests
+		retVal.SuppressedRequests += report.SuppressedRequests
+		retVal.SuppressedUnits += report.SuppressedUnits
+		if report.Requests == 0 {
+			continue
+		}
+		if retVal.Start.IsZero() || report.Start.Before(retVal.Start) {
+			retVal.Start = report.Start
+		}
+		if report.End.After(retVal.End) {
+			retVal.End = report.End
+		}
+		retVal.Requests += report.Requests
+		retVal.Rate += report.Rate
+		retVal.Throughput += report.Throughput
+		retVal.BytesIn += report.BytesIn
+		retVal.BytesOut += report.BytesOut
+		retVal.UncompressedBytesOut += report.UncompressedBytesOut
+		retVal.Units += report.Units
+		retVal.UnitRate += report.UnitRate
+		retVal.ByteRate += report.ByteRate
+		if len(retVal.Unit) == 0 {
+			retVal.Unit = report.Unit
+		}
+		successful += report.Success * float64(report.Requests)
+		weightedMean += float64(report.Latencies.Mean) * float64(report.Requests)
+		latencies := &retVal.Latencies
+		latencies.P50 = maxDuration(latencies.P50, report.Latencies.P50)
+		latencies.P90 = maxDuration(latencies.P90, report.Latencies.P90)
+		latencies.P95 = maxDuration(latencies.P95, report.Latencies.P95)
+		latencies.P99 = maxDuration(latencies.P99, report.Latencies.P99)
+		latencies.Max = maxDuration(latencies.Max, report.Latencies.Max)
+		for code, count := range report.StatusCodes {
+			if retVal.StatusCodes == nil {
+				retVal.StatusCodes = make(map[string]int)
+			}
+			retVal.StatusCodes[code] += count
+		}
+		retVal.Errors = append(retVal.Errors, report.Errors...)
+	}
+	if retVal.Requests > 0 {
+		retVal.Success = successful / float64(retVal.Requests)
+		retVal.Latencies.Mean = utils.StringDuration(weightedMean / float64(retVal.Requests))
+	}
+	retVal.Errors = uniqueStrings(retVal.Errors)
+	return retVal
+}
+
+// uniqueStrings returns the sorted distinct values
+func uniqueStrings(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(values))
+	retVal := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			retVal = append(retVal, value)
+		}
+	}
+	sort.Strings(retVal)
+	return retVal
+}
+
+// masterRunsHandler returns the runs in the run history of the master
+func masterRunsHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, getRunSummaries())
+}
+
+// masterRunReportHandler returns the (merged) report of a run
+func masterRunReportHandler(ctx *gin.Context) {
+	runId := ctx.Param("runId")
+	report := getRunReport(runId)
+	if report == nil {
+		ctx.JSON(http.StatusNotFound, errorJsonResponse(fmt.Sprintf("No report available for run %s", runId)))
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,151 @@
+package web_server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	vegeta "github.com/tsenart/vegeta/lib"
+
+	"github.com/getsentry/go-load-tester/tests"
+	"github.com/getsentry/go-load-tester/utils"
+)
+
+/*
+Contains code for the live statistics of a worker (used by the master dashboard)
+*/
+
+// statsWindow is the period over which the live statistics are calculated
+const statsWindow = 1 * time.Second
+
+// AttackInfo describes the attack a worker is running
+type AttackInfo struct {
+	Name           string               `json:"name,omitempty"`
+	Description    string               `json:"description,omitempty"`
+	TestType       string               `json:"testType"`
+	NumMessages    int                  `json:"numMessages"`
+	Per            utils.StringDuration `json:"per"`
+	AttackDuration utils.StringDuration `json:"attackDuration"`
+	Labels         map[string]string    `json:"labels,omitempty"`
+}
+
+func newAttackInfo(params tests.TestParams) *AttackInfo {
+	return &AttackInfo{
+		Name:           params.Name,
+		Description:    params.Description,
+		TestType:       params.TestType,
+		NumMessages:    params.NumMessages,
+		Per:            utils.StringDuration(params.Per),
+		AttackDuration: utils.StringDuration(params.AttackDuration),
+		Labels:         params.LabelMap(),
+	}
+}
+
+// WorkerStats are the live statistics of a worker, calculated over the last statsWindow
+type WorkerStats struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Attack is the currently running attack (nil if the worker is idle)
+	Attack *AttackInfo `json:"attack,omitempty"`
+	// Requests is the total number of requests sent during the current attack
+	Requests uint64 `json:"requests"`
+	// Rate is the achieved request rate (requests/second)
+	Rate float64 `json:"rate"`
+	// Success is the ratio of successful requests
+	Success float64 `json:"success"`
+	// Unit is the logical unit carried by the requests (e.g. events, rows, projects)
+	Unit string `json:"unit,omitempty"`
+	// Units is the total number of units sent during the current attack
+	Units uint64 `json:"units"`
+	// UnitRate is the rate of the units sent (units/second)
+	UnitRate float64 `json:"unitRate"`
+	// ByteRate is the rate of the request body bytes sent (bytes/second)
+	ByteRate float64 `json:"byteRate"`
+	// Latencies of the requests
+	Latencies LatencyReport `json:"latencies"`
+}
+
+// liveStats accumulates the attack results of the current window
+var liveStats struct {
+	lock        sync.Mutex
+	attack      *AttackInfo
+	loadTester  tests.LoadTester
+	requests    uint64
+	windowUnits uint64 // units sent before the current window
+	window      vegeta.Metrics
+	windowStart time.Time
+	last        WorkerStats
+}
+
+// statsStartAttack resets the live statistics for a new attack (pass nil values when the attack ends)
+func statsStartAttack(attack *AttackInfo, loadTester tests.LoadTester) {
+	liveStats.lock.Lock()
+	defer liveStats.lock.Unlock()
+	liveStats.attack = attack
+	liveStats.loadTester = loadTester
+	liveStats.requests = 0
+	liveStats.windowUnits = 0
+	liveStats.window = vegeta.Metrics{}
+	liveStats.windowStart = time.Now()
+}
+
+// statsAddResult adds an attack result to the current window
+func statsAddResult(res *vegeta.Result) {
+	liveStats.lock.Lock()
+	defer liveStats.lock.Unlock()
+	liveStats.requests++
+	liveStats.window.Add(res)
+}
+
+// rotateStatsWindow closes the current window (making it available through getWorkerStats) and starts a new one
+func rotateStatsWindow(now time.Time) {
+	liveStats.lock.Lock()
+	defer liveStats.lock.Unlock()
+	window := &liveStats.window
+	stats := WorkerStats{
+		Timestamp: now,
+		Attack:    liveStats.attack,
+		Requests:  liveStats.requests,
+	}
+	if liveStats.loadTester != nil {
+		stats.Unit, stats.Units = tests.GetPayloadUnits(liveStats.loadTester, liveStats.requests)
+	}
+	if elapsed := now.Sub(liveStats.windowStart); window.Requests > 0 && elapsed > 0 {
+		window.Close()
+		stats.Rate = float64(window.Requests) / elapsed.Seconds()
+		stats.UnitRate = float64(stats.Units-liveStats.windowUnits) / elapsed.Seconds()
+		stats.ByteRate = float64(window.BytesOut.Total) / elapsed.Seconds()
+		stats.Success = window.Success
+		stats.Latencies = LatencyReport{
+			Mean: utils.StringDuration(window.Latencies.Mean),
+			P50:  utils.StringDuration(window.Latencies.P50),
+			P90:  utils.StringDuration(window.Latencies.Quantile(0.90)),
+			P95:  utils.StringDuration(window.Latencies.P95),
+			P99:  utils.StringDuration(window.Latencies.P99),
+			Max:  utils.StringDuration(window.Latencies.Max),
+		}
+	}
+	liveStats.last = stats
+	liveStats.windowUnits = stats.Units
+	liveStats.window = vegeta.Metrics{}
+	liveStats.windowStart = now
+}
+
+func getWorkerStats() WorkerStats {
+	liveStats.lock.Lock()
+	defer liveStats.lock.Unlock()
+	return liveStats.last
+}
+
+// liveStatsLoop periodically rotates the live statistics window
+func liveStatsLoop() {
+	for {
+		time.Sleep(statsWindow)
+		rotateStatsWindow(time.Now())
+	}
+}
+
+// workerStatsHandler returns the live statistics of the worker
+func workerStatsHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, getWorkerStats())
+}
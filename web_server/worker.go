@@ -9,7 +9,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/DataDog/datadog-go/v5/statsd"
@@ -23,15 +26,32 @@ import (
 
 var globalWorkerMetrics struct {
 	vegetaStats vegeta.Metrics
+	// lock protects attackParams
+	lock sync.Mutex
+	// attackParams are the parameters of the current attack (their labels are used to tag metrics)
+	attackParams tests.TestParams
 }
 
-// collectWorkerMetricsLoop regularly produces global master metrics
-func collectWorkerMetricsLoop(statsdClient *statsd.Client) {
-	if statsdClient == nil {
+// setAttackParams sets the parameters of the currently running attack
+func setAttackParams(params tests.TestParams) {
+	globalWorkerMetrics.lock.Lock()
+	defer globalWorkerMetrics.lock.Unlock()
+	globalWorkerMetrics.attackParams = params
+}
+
+// getAttackParams returns the parameters of the currently running attack
+func getAttackParams() tests.TestParams {
+	globalWorkerMetrics.lock.Lock()
+	defer globalWorkerMetrics.lock.Unlock()
+	return globalWorkerMetrics.attackParams
+}
+
+// collectWorkerMetricsLoop regularly produces global worker metrics
+func collectWorkerMetricsLoop(statsdClient *statsd.Client, otlpExporter *utils.OtlpExporter) {
+	if statsdClient == nil && otlpExporter == nil {
 		return
 	}
 
-	tags := []string{}
 	const sampleRate = 1.0
 	const flushPeriod = 1 * time.Second
 	const success_rate_threshold = 0.9
@@ -45,6 +65,8 @@ func collectWorkerMetricsLoop(statsdClient *statsd.Client) {
 
 	for {
 		invalid_data_marker := 0
+		attackParams := getAttackParams()
+		tags := attackParams.LabelTags()
 
 		// Note: this is a shallow copy, but it should be fine if we don't access any thread-unsafe
 		// attributes like maps/slices.
@@ -80,11 +102,29 @@ func collectWorkerMetricsLoop(statsdClient *statsd.Client) {
 			}
 		}
 
-		_ = statsdClient.Gauge("vegeta.data_invalid", float64(invalid_data_marker), tags, sampleRate)
-		_ = statsdClient.Gauge("vegeta.rate", currentVegetaStats.Rate, tags, sampleRate)
-		_ = statsdClient.Gauge("vegeta.throughput", currentVegetaStats.Throughput, tags, sampleRate)
-		_ = statsdClient.Gauge("vegeta.success_pct", currentVegetaStats.Success, tags, sampleRate)
-		_ = statsdClient.Gauge("vegeta.requests", float64(currentVegetaStats.Requests), tags, sampleRate)
+		workerStats := getWorkerStats()
+		gauges := map[string]float64{
+			"vegeta.data_invalid":   float64(invalid_data_marker),
+			"vegeta.rate":           currentVegetaStats.Rate,
+			"vegeta.throughput":     currentVegetaStats.Throughput,
+			"vegeta.success_pct":    currentVegetaStats.Success,
+			"vegeta.requests":       float64(currentVegetaStats.Requests),
+			"payload.units_per_sec": workerStats.UnitRate,
+			"payload.bytes_per_sec": workerStats.ByteRate,
+		}
+		if statsdClient != nil {
+			for name, value := range gauges {
+				_ = statsdClient.Gauge(name, value, tags, sampleRate)
+			}
+		}
+		if otlpExporter != nil {
+			if err := otlpExporter.ExportGauges(gauges, labelAttributes(attackParams)); err != nil {
+				log.Error().Err(err).Msg("Could not export OTLP metrics")
+			}
+			if err := otlpExporter.Flush(); err != nil {
+				log.Error().Err(err).Msg("Could not export OTLP spans")
+			}
+		}
 
 		lastFlushVegetaStats = currentVegetaStats
 
@@ -92,28 +132,28 @@ func collectWorkerMetricsLoop(statsdClient *statsd.Client) {
 	}
 }
 
-func RunWorkerWebServer(port string, targetUrl string, masterUrl string, statsdAddr string, workers int) {
+func RunWorkerWebServer(port string, targetUrl string, masterUrl string, statsdAddr string, workers int, otlpEndpoint string,
+	requestSampleRate float64, annotationsUrl string) {
 
 	paramChannel := make(chan tests.TestParams)
 	defer close(paramChannel)
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.Default()
-	var statsdClient = utils.GetStatsd(statsdAddr)
-
-	go collectWorkerMetricsLoop(statsdClient)
 
 	engine.GET("/stop/", withParamChannel(paramChannel, workerStopHandler))
 	engine.POST("/stop/", withParamChannel(paramChannel, workerStopHandler))
 	engine.POST("/command/", withParamChannel(paramChannel, workerCommandHandler))
 	engine.GET("/ping", pingHandler)
 	engine.POST("/ping", pingHandler)
+	engine.GET("/report/", workerReportHandler)
+	engine.GET("/stats/", workerStatsHandler)
 	// if working with master first wait to register
 	config, err := registerWithMaster(port, masterUrl)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to register with master, worker stopping")
 		return
 	}
-	go worker(targetUrl, statsdAddr, workers, config, paramChannel)
+	go worker(targetUrl, statsdAddr, otlpEndpoint, requestSampleRate, annotationsUrl, workers, config, paramChannel)
 	if len(port) > 0 {
 		port = fmt.Sprintf(":%s", port)
 	}
@@ -231,6 +271,8 @@ func workerCommandHandler(cmd chan<- tests.TestParams, ctx *gin.Context) {
 	if err != nil {
 		ctx.String(http.StatusBadRequest, "Could not parse body")
 	}
+	params.TraceParent = ctx.GetHeader("traceparent")
+	params.RunId = ctx.GetHeader(runIdHeader)
 	cmd <- params
 	ctx.String(http.StatusOK, "Command Accepted")
 
@@ -258,7 +300,8 @@ func createLoadTester(targetUrl string, params tests.TestParams) tests.LoadTeste
 // The worker uses a command channel to accept new commands
 // Once a command is received the current attack (if there is a current attack)
 // is stopped and a new attack started
-func worker(targetUrl string, statsdAddr string, maxWorkers int, configParams *configParams, paramsChan <-chan tests.TestParams) {
+func worker(targetUrl string, statsdAddr string, otlpEndpoint string, requestSampleRate float64, annotationsUrl string,
+	maxWorkers int, configParams *configParams, paramsChan <-chan tests.TestParams) {
 
 	if configParams != nil && len(configParams.StatsdServerUrl) > 0 {
 		// override configuration with master statsdUrl
@@ -268,11 +311,23 @@ func worker(targetUrl string, statsdAddr string, maxWorkers int, configParams *c
 		// override configuration with master targetUrl
 		targetUrl = configParams.TargetUrl
 	}
-	log.Info().Msgf("Worker started targetUrl=%s, statsdAddr=%s", targetUrl, statsdAddr)
+	if configParams != nil && len(configParams.OtlpEndpoint) > 0 {
+		// override configuration with master OTLP endpoint
+		otlpEndpoint = configParams.OtlpEndpoint
+	}
+	log.Info().Msgf("Worker started targetUrl=%s, statsdAddr=%s, otlpEndpoint=%s", targetUrl, statsdAddr, otlpEndpoint)
 	var loadTester tests.LoadTester
 	var params tests.TestParams
 	var statsdClient = utils.GetStatsd(statsdAddr)
+	var otlpExporter = utils.GetOtlpExporter(otlpEndpoint, "go-load-tester-worker")
+	// when running with a master, the master is responsible for annotating the runs
+	var standalone = configParams == nil
+	var annotator = newRunAnnotator(statsdClient, annotationsUrl)
 	globalWorkerMetrics.vegetaStats = vegeta.Metrics{}
+
+	go collectWorkerMetricsLoop(statsdClient, otlpExporter)
+	go liveStatsLoop()
+
 	for {
 	attack:
 		select {
@@ -280,27 +335,44 @@ func worker(targetUrl string, statsdAddr string, maxWorkers int, configParams *c
 			loadTester = createLoadTester(targetUrl, params)
 		default:
 			if loadTester != nil {
+				attackParams := params
+				if standalone && len(attackParams.RunId) == 0 {
+					attackParams.RunId = newRunId(time.Now())
+				}
+				attackTester := loadTester
+				setAttackParams(attackParams)
+				statsStartAttack(newAttackInfo(attackParams), attackTester)
+				if standalone {
+					annotator.annotate(runStarted, attackParams)
+				}
+				tags := attackParams.LabelTags()
 				rate := vegeta.Rate{Freq: params.NumMessages, Per: params.Per}
-				attacker := vegeta.NewAttacker(vegeta.Timeout(time.Millisecond*500), vegeta.Redirects(0), vegeta.MaxWorkers(uint64(maxWorkers)))
+				attacker := newAttacker(loadTester, maxWorkers)
+				attackSpan := startAttackSpan(params)
 				targeter, seq := loadTester.GetTargeter()
 				for res := range attacker.Attack(targeter, rate, params.AttackDuration, params.Description) {
 					targeter, seq = loadTester.GetTargeter()
-					globalWorkerMetrics.vegetaStats.Add(res)
-					loadTester.ProcessResult(res, seq)
-					if statsdClient != nil {
-						var httpStatus = fmt.Sprintf("status:%d", res.Code)
-						_ = statsdClient.Timing("req-latency", res.Latency, []string{httpStatus}, 1.0)
+					// suppressed requests were never sent (they are reported separately)
+					if !tests.IsSuppressed(res) {
+						globalWorkerMetrics.vegetaStats.Add(res)
+						statsAddResult(res)
+						loadTester.ProcessResult(res, seq)
+						if statsdClient != nil {
+							var httpStatus = fmt.Sprintf("status:%d", res.Code)
+							_ = statsdClient.Timing("req-latency", res.Latency, append([]string{httpStatus}, tags...), 1.0)
+						}
+						if otlpExporter != nil && requestSampleRate > 0 && rand.Float64() < requestSampleRate {
+							otlpExporter.AddSpan(requestSpan(res, attackSpan))
+						}
 					}
 					select {
 					case params = <-paramsChan:
 						loadTester = createLoadTester(targetUrl, params)
 						attacker.Stop()
-
-						// Flush stats
-						globalWorkerMetrics.vegetaStats.Close()
-						log.Debug().Msgf("Vegeta stats: %+v", globalWorkerMetrics.vegetaStats)
-						globalWorkerMetrics.vegetaStats = vegeta.Metrics{}
-
+						finishAttack(attackParams, attackTester, attackSpan, otlpExporter)
+						if standalone {
+							annotator.annotate(runStopped, attackParams)
+						}
 						break attack // starts a new attack
 					default:
 						continue
@@ -308,14 +380,106 @@ func worker(targetUrl string, statsdAddr string, maxWorkers int, configParams *c
 				}
 				// finish current attack, reset timing
 				loadTester = nil
-
-				// Flush stats
-				globalWorkerMetrics.vegetaStats.Close()
-				log.Debug().Msgf("Vegeta stats: %+v", globalWorkerMetrics.vegetaStats)
-				globalWorkerMetrics.vegetaStats = vegeta.Metrics{}
+				finishAttack(attackParams, attackTester, attackSpan, otlpExporter)
+				if standalone {
+					annotator.annotate(runStopped, attackParams)
+				}
 			} else {
 				time.Sleep(1 * time.Second) // sleep a bit, so we don't busy spin when there is no attack
 			}
 		}
 	}
 }
+
+// newAttacker creates the attacker of an attack, load testers that need to see the responses to their
+// requests wrap the transport of the attacker
+func newAttacker(loadTester tests.LoadTester, maxWorkers int) *vegeta.Attacker {
+	opts := make([]func(*vegeta.Attacker), 0, 4)
+	if wrapper, ok := loadTester.(tests.RoundTripperWrapper); ok {
+		// the same transport vegeta uses by default (the client must be set before the other options)
+		dialer := &net.Dialer{
+			LocalAddr: &net.TCPAddr{IP: vegeta.DefaultLocalAddr.IP, Zone: vegeta.DefaultLocalAddr.Zone},
+			KeepAlive: 30 * time.Second,
+		}
+		transport := &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     vegeta.DefaultTLSConfig,
+			MaxIdleConnsPerHost: vegeta.DefaultConnections,
+		}
+		opts = append(opts, vegeta.Client(&http.Client{Transport: wrapper.WrapRoundTripper(transport)}))
+	}
+	opts = append(opts, vegeta.Timeout(time.Millisecond*500), vegeta.Redirects(0), vegeta.MaxWorkers(uint64(maxWorkers)))
+	return vegeta.NewAttacker(opts...)
+}
+
+// finishAttack flushes the stats of the finished attack into a run report and ends the attack span
+func finishAttack(attackParams tests.TestParams, loadTester tests.LoadTester, attackSpan utils.OtlpSpan,
+	otlpExporter *utils.OtlpExporter) {
+	finishAttackSpan(otlpExporter, attackSpan)
+	setAttackParams(tests.TestParams{})
+	statsStartAttack(nil, nil)
+
+	// Flush stats
+	globalWorkerMetrics.vegetaStats.Close()
+	log.Debug().Msgf("Vegeta stats: %+v", globalWorkerMetrics.vegetaStats)
+	unit, units := tests.GetPayloadUnits(loadTester, globalWorkerMetrics.vegetaStats.Requests)
+	report := newRunReport(attackParams, &globalWorkerMetrics.vegetaStats, unit, units)
+	report.UncompressedBytesOut = tests.GetUncompressedBytes(loadTester, report.BytesOut)
+	report.SuppressedRequests, report.SuppressedUnits = tests.GetSuppressed(loadTester)
+	setLastReport(report)
+	if reportJson, err := json.Marshal(report); err == nil {
+		log.Info().Msgf("Attack report: %s", reportJson)
+	}
+	globalWorkerMetrics.vegetaStats = vegeta.Metrics{}
+}
+
+// labelAttributes converts the labels of an attack into OpenTelemetry attributes
+func labelAttributes(params tests.TestParams) map[string]any {
+	labels := params.LabelMap()
+	retVal := make(map[string]any, len(labels))
+	for key, value := range labels {
+		retVal[key] = value
+	}
+	return retVal
+}
+
+// startAttackSpan creates the span covering an attack, if the attack was forwarded by a master
+// the span is created as a child of the master run span.
+func startAttackSpan(params tests.TestParams) utils.OtlpSpan {
+	traceId, parentSpanId, err := utils.ParseTraceParent(params.TraceParent)
+	if err != nil {
+		// no (valid) master run span, start a new trace
+		traceId, parentSpanId = "", ""
+	}
+	now := time.Now()
+	return utils.NewOtlpSpan("worker.attack", traceId, parentSpanId, now, now, params.Attributes())
+}
+
+// finishAttackSpan ends the attack span and sends it (together with any pending request spans) to the collector
+func finishAttackSpan(otlpExporter *utils.OtlpExporter, attackSpan utils.OtlpSpan) {
+	if otlpExporter == nil {
+		return
+	}
+	attackSpan.End(time.Now())
+	otlpExporter.AddSpan(attackSpan)
+	if err := otlpExporter.Flush(); err != nil {
+		log.Error().Err(err).Msg("Could not export OTLP spans")
+	}
+}
+
+// requestSpan creates a span for an individual request, as a child of the attack span
+func requestSpan(res *vegeta.Result, attackSpan utils.OtlpSpan) utils.OtlpSpan {
+	attributes := map[string]any{"http.status_code": int(res.Code)}
+	if len(res.Error) > 0 {
+		attributes["error"] = res.Error
+	}
+	span := utils.NewOtlpSpan("worker.request", attackSpan.TraceId, attackSpan.SpanId, res.Timestamp, res.End(), attributes)
+	span.Kind = utils.OtlpSpanKindClient
+	if len(res.Error) > 0 || res.Code == 0 || res.Code >= 400 {
+		span.Status = utils.OtlpStatus{Code: utils.OtlpStatusError, Message: res.Error}
+	} else {
+		span.Status = utils.OtlpStatus{Code: utils.OtlpStatusOk}
+	}
+	return span
+}